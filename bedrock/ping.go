@@ -0,0 +1,154 @@
+// Package bedrock implements the unconnected ping of Bedrock Edition servers, which is also used by
+// Education Edition servers.
+package bedrock
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/itzg/mc-monitor/utils"
+	"github.com/sandertv/go-raknet"
+)
+
+// Editions reported in the first field of the pong
+const (
+	EditionPocket    = "MCPE"
+	EditionEducation = "MCEE"
+)
+
+// ServerInfo is the status decoded from the semicolon separated fields of the unconnected pong. The fields
+// past MaxPlayers are not reported by all servers and are left as their zero value, or -1 for integers,
+// when absent.
+type ServerInfo struct {
+	// Edition is MCPE for Bedrock Edition or MCEE for Education Edition
+	Edition         string `json:"edition"`
+	ServerName      string `json:"server_name"`
+	ProtocolVersion int    `json:"protocol_version"`
+	Version         string `json:"version"`
+	Players         int    `json:"players"`
+	MaxPlayers      int    `json:"max_players"`
+	ServerGuid      uint64 `json:"server_guid"`
+	// LevelName is typically the second line of the message of the day
+	LevelName string `json:"level_name"`
+	// GameMode is the name of the default game mode, such as Survival
+	GameMode string `json:"game_mode"`
+	// GameModeId is documented as the numeric default game mode: 0 survival, 1 creative, 2 adventure. Servers
+	// built on the CloudburstMC protocol library, such as Geyser, write the Nintendo limited flag there instead.
+	GameModeId int `json:"game_mode_id"`
+	PortIPv4   int `json:"port_ipv4"`
+	PortIPv6   int `json:"port_ipv6"`
+	// NintendoLimited is decoded from the same field as GameModeId, which is 0 when limited and 1 otherwise in
+	// the pong of Geyser
+	NintendoLimited bool `json:"nintendo_limited"`
+
+	// Raw is the pong exactly as returned by the server
+	Raw string `json:"-"`
+	// Rtt is the round trip time of the ping
+	Rtt time.Duration `json:"-"`
+}
+
+// PingOptions configures Ping. The zero value is usable.
+type PingOptions struct {
+	// UseProxy enables prefixing the ping with a PROXY protocol header, which is always version 2
+	// since version 1 does not describe UDP
+	UseProxy bool
+	// ProxySource is reported as the address of the client in the PROXY header instead of the local address, when valid
+	ProxySource netip.AddrPort
+}
+
+// Ping sends an unconnected ping to the given [host:port] address. When the given timeout is zero,
+// the default timeout of raknet.Ping is used.
+func Ping(address string, timeout time.Duration, options *PingOptions) (*ServerInfo, error) {
+	var dialer raknet.Dialer
+	if options != nil && options.UseProxy {
+		dialer.UpstreamDialer = &utils.ProxyDialer{Source: options.ProxySource}
+	}
+
+	start := time.Now()
+	var response []byte
+	var err error
+	if timeout > 0 {
+		response, err = dialer.PingTimeout(address, timeout)
+	} else {
+		response, err = dialer.Ping(address)
+	}
+	rtt := time.Now().Sub(start)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query bedrock server %s: %w", address, err)
+	}
+	if len(response) == 0 {
+		return nil, fmt.Errorf("empty response from bedrock server %s", address)
+	}
+
+	info, err := ParsePong(string(response))
+	if err != nil {
+		return nil, fmt.Errorf("invalid response from bedrock server %s: %w", address, err)
+	}
+	info.Rtt = rtt
+	return info, nil
+}
+
+// ParsePong decodes the fields of the unconnected pong, such as
+// MCPE;Dedicated Server;686;1.21.2;0;10;13253860892328930865;Bedrock level;Survival;1;19132;19133;
+func ParsePong(pong string) (*ServerInfo, error) {
+	parts := strings.Split(pong, ";")
+	if len(parts) < 2 {
+		return nil, errors.New("pong has too few fields")
+	}
+
+	info := &ServerInfo{
+		Edition:         safeStringAt(parts, 0),
+		ServerName:      safeStringAt(parts, 1),
+		ProtocolVersion: safeIntAt(parts, 2),
+		Version:         safeStringAt(parts, 3),
+		// the parts past here are not always present in the response
+		Players:    safeIntAt(parts, 4),
+		MaxPlayers: safeIntAt(parts, 5),
+		LevelName:  safeStringAt(parts, 7),
+		GameMode:   safeStringAt(parts, 8),
+		GameModeId: safeIntAt(parts, 9),
+		PortIPv4:   safeIntAt(parts, 10),
+		PortIPv6:   safeIntAt(parts, 11),
+		// Geyser writes the flag where other servers document the numeric game mode, which is the last field
+		// before the ports in both layouts
+		NintendoLimited: safeStringAt(parts, 9) == "0",
+	}
+	// the GUID is a signed 64-bit value in some implementations
+	if guid := safeStringAt(parts, 6); guid != "" {
+		if unsigned, err := strconv.ParseUint(guid, 10, 64); err == nil {
+			info.ServerGuid = unsigned
+		} else if signed, err := strconv.ParseInt(guid, 10, 64); err == nil {
+			info.ServerGuid = uint64(signed)
+		}
+	}
+	info.Raw = pong
+
+	return info, nil
+}
+
+func safeStringAt(parts []string, index int) string {
+	if index >= 0 && index < len(parts) {
+		return parts[index]
+	}
+	return ""
+}
+
+func safeIntAt(parts []string, index int) int {
+	if index >= 0 && index < len(parts) {
+		return safeParseInt(parts[index])
+	}
+	return -1
+}
+
+func safeParseInt(s string) int {
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		return -1
+	} else {
+		return i
+	}
+}
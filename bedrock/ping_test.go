@@ -0,0 +1,221 @@
+package bedrock
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/pires/go-proxyproto"
+	"github.com/sandertv/go-raknet"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePong(t *testing.T) {
+	tests := []struct {
+		name     string
+		pong     string
+		expected ServerInfo
+	}{
+		{
+			name: "dedicated server",
+			pong: "MCPE;Dedicated Server;686;1.21.2;2;10;13253860892328930865;Bedrock level;Creative;1;19132;19133;",
+			expected: ServerInfo{
+				Edition:         EditionPocket,
+				ServerName:      "Dedicated Server",
+				ProtocolVersion: 686,
+				Version:         "1.21.2",
+				Players:         2,
+				MaxPlayers:      10,
+				ServerGuid:      13253860892328930865,
+				LevelName:       "Bedrock level",
+				GameMode:        "Creative",
+				GameModeId:      1,
+				PortIPv4:        19132,
+				PortIPv6:        19133,
+			},
+		},
+		{
+			// as written by BedrockPong of the CloudburstMC protocol library, which reports the same port twice
+			name: "geyser",
+			pong: "MCPE;Geyser;766;1.21.50;3;100;4731218523479162617;Another Minecraft Server;Survival;1;19132;19132;",
+			expected: ServerInfo{
+				Edition:         EditionPocket,
+				ServerName:      "Geyser",
+				ProtocolVersion: 766,
+				Version:         "1.21.50",
+				Players:         3,
+				MaxPlayers:      100,
+				ServerGuid:      4731218523479162617,
+				LevelName:       "Another Minecraft Server",
+				GameMode:        "Survival",
+				GameModeId:      1,
+				PortIPv4:        19132,
+				PortIPv6:        19132,
+			},
+		},
+		{
+			name: "geyser with nintendo limit",
+			pong: "MCPE;Geyser;766;1.21.50;0;100;4731218523479162617;Another Minecraft Server;Survival;0;19132;19132;",
+			expected: ServerInfo{
+				Edition:         EditionPocket,
+				ServerName:      "Geyser",
+				ProtocolVersion: 766,
+				Version:         "1.21.50",
+				Players:         0,
+				MaxPlayers:      100,
+				ServerGuid:      4731218523479162617,
+				LevelName:       "Another Minecraft Server",
+				GameMode:        "Survival",
+				GameModeId:      0,
+				PortIPv4:        19132,
+				PortIPv6:        19132,
+				NintendoLimited: true,
+			},
+		},
+		{
+			name: "education edition",
+			pong: "MCEE;Classroom;594;1.20.13;0;30;-4953541785036281290;World;Creative;1;19132;-1;",
+			expected: ServerInfo{
+				Edition:         EditionEducation,
+				ServerName:      "Classroom",
+				ProtocolVersion: 594,
+				Version:         "1.20.13",
+				Players:         0,
+				MaxPlayers:      30,
+				ServerGuid:      13493202288673270326,
+				LevelName:       "World",
+				GameMode:        "Creative",
+				GameModeId:      1,
+				PortIPv4:        19132,
+				PortIPv6:        -1,
+			},
+		},
+		{
+			name: "minimal",
+			pong: "MCPE;Proxy;;1.21.2",
+			expected: ServerInfo{
+				Edition:         EditionPocket,
+				ServerName:      "Proxy",
+				ProtocolVersion: -1,
+				Version:         "1.21.2",
+				Players:         -1,
+				MaxPlayers:      -1,
+				GameModeId:      -1,
+				PortIPv4:        -1,
+				PortIPv6:        -1,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := ParsePong(tt.pong)
+			require.NoError(t, err)
+
+			tt.expected.Raw = tt.pong
+			assert.Equal(t, &tt.expected, info)
+		})
+	}
+}
+
+func TestParsePongInvalid(t *testing.T) {
+	_, err := ParsePong("MCPE")
+	assert.Error(t, err)
+}
+
+func TestPing(t *testing.T) {
+	listener, err := raknet.Listen("127.0.0.1:0")
+	require.NoError(t, err)
+	//goland:noinspection GoUnhandledErrorResult
+	defer listener.Close()
+	listener.PongData([]byte("MCEE;Classroom;594;1.20.13;3;30;42;World;Adventure;2;19132;19133;1;"))
+
+	info, err := Ping(listener.Addr().String(), 5*time.Second, nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, EditionEducation, info.Edition)
+	assert.Equal(t, 3, info.Players)
+	assert.Equal(t, uint64(42), info.ServerGuid)
+	assert.Equal(t, 2, info.GameModeId)
+	assert.False(t, info.NintendoLimited)
+	assert.Positive(t, info.Rtt)
+}
+
+// unconnectedMagic is the offline message ID of RakNet that is included in unconnected pings and pongs
+var unconnectedMagic = []byte{0x00, 0xff, 0xff, 0x00, 0xfe, 0xfe, 0xfe, 0xfe, 0xfd, 0xfd, 0xfd, 0xfd, 0x12, 0x34, 0x56, 0x78}
+
+// startProxyAwareServer stands in for a proxy, such as Geyser, that requires a PROXY protocol version 2 header
+// ahead of each datagram. It answers unconnected pings with the given pong and sends each received header
+// to the returned channel.
+func startProxyAwareServer(t *testing.T, pong string) (string, <-chan *proxyproto.Header) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+	headers := make(chan *proxyproto.Header, 10)
+
+	go func() {
+		datagram := make([]byte, 1500)
+		for {
+			n, addr, err := conn.ReadFrom(datagram)
+			if err != nil {
+				return
+			}
+			reader := bufio.NewReader(bytes.NewReader(datagram[:n]))
+			header, err := proxyproto.Read(reader)
+			if err != nil {
+				// like the proxy, ignore datagrams without a valid header
+				continue
+			}
+			headers <- header
+
+			ping := make([]byte, reader.Buffered())
+			_, _ = reader.Read(ping)
+			if len(ping) < 9 || ping[0] != 0x01 {
+				continue
+			}
+
+			response := new(bytes.Buffer)
+			response.WriteByte(0x1c)
+			// echo the ping time
+			response.Write(ping[1:9])
+			_ = binary.Write(response, binary.BigEndian, uint64(42))
+			response.Write(unconnectedMagic)
+			_ = binary.Write(response, binary.BigEndian, uint16(len(pong)))
+			response.WriteString(pong)
+			_, _ = conn.WriteTo(response.Bytes(), addr)
+		}
+	}()
+
+	return conn.LocalAddr().String(), headers
+}
+
+func TestPingProxy(t *testing.T) {
+	address, headers := startProxyAwareServer(t, "MCPE;Behind a proxy;686;1.21.2;2;10;42;Bedrock level;Survival;0;19132;19133;")
+
+	info, err := Ping(address, 5*time.Second, &PingOptions{
+		UseProxy:    true,
+		ProxySource: netip.MustParseAddrPort("203.0.113.7:40000"),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "Behind a proxy", info.ServerName)
+
+	header := <-headers
+	assert.Equal(t, byte(2), header.Version)
+	assert.Equal(t, proxyproto.UDPv4, header.TransportProtocol)
+	assert.Equal(t, "203.0.113.7:40000", header.SourceAddr.String())
+	assert.Equal(t, address, header.DestinationAddr.String())
+}
+
+func TestPingWithoutProxyHeaderIsIgnoredByProxy(t *testing.T) {
+	address, _ := startProxyAwareServer(t, "MCPE;Behind a proxy;686;1.21.2;2;10;42;Bedrock level;Survival;0;19132;19133;")
+
+	_, err := Ping(address, 200*time.Millisecond, nil)
+	assert.Error(t, err)
+}
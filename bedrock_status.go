@@ -2,11 +2,17 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"os"
 
+	"github.com/avast/retry-go"
 	"github.com/google/subcommands"
 	"github.com/itzg/go-flagsfiller"
+	"github.com/itzg/mc-monitor/bedrock"
+	"github.com/itzg/mc-monitor/utils"
 	"go.uber.org/zap"
 
 	"log"
@@ -16,11 +22,20 @@ import (
 )
 
 type statusBedrockCmd struct {
-	Host string `default:"localhost"`
-	Port int    `default:"19132"`
+	Host string `default:"localhost" usage:"hostname of the Minecraft Bedrock server" env:"MC_HOST"`
+	Port int    `default:"19132" usage:"port of the Minecraft Bedrock server" env:"MC_PORT"`
 
 	RetryInterval time.Duration `usage:"if retry-limit is non-zero, status will be retried at this interval" default:"10s"`
 	RetryLimit    int           `usage:"if non-zero, failed status will be retried this many times before exiting"`
+	Timeout       time.Duration `usage:"the timeout the ping can take as a maximum" default:"15s"`
+
+	UseProxy    bool   `usage:"supports contacting servers behind a proxy, such as Geyser, with proxy protocol enabled. Always uses PROXY protocol version 2 since version 1 does not support UDP"`
+	ProxySource string `usage:"[ip:port] reported as the client address in the PROXY protocol header instead of the local address"`
+
+	SkipReadinessCheck bool `usage:"returns success when pinging a server with a max player count of 0"`
+
+	ShowPlayerCount bool `usage:"show just the online player count"`
+	Json            bool `usage:"output server status as JSON"`
 }
 
 func (c *statusBedrockCmd) Name() string {
@@ -43,6 +58,12 @@ func (c *statusBedrockCmd) SetFlags(flags *flag.FlagSet) {
 	}
 }
 
+type statusBedrockResult struct {
+	Host       string              `json:"host"`
+	Port       int                 `json:"port"`
+	ServerInfo *bedrock.ServerInfo `json:"server_info"`
+}
+
 func (c *statusBedrockCmd) Execute(_ context.Context, _ *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
 	logger := args[0].(*zap.Logger)
 	address := net.JoinHostPort(c.Host, strconv.Itoa(c.Port))
@@ -50,23 +71,63 @@ func (c *statusBedrockCmd) Execute(_ context.Context, _ *flag.FlagSet, args ...i
 		c.RetryInterval = 1 * time.Second
 	}
 
-	for {
-		info, err := PingBedrockServer(address, 0, logger)
+	proxySource, err := utils.ParseProxySource(c.ProxySource)
+	if err != nil {
+		printUsageError(err.Error())
+		return subcommands.ExitUsageError
+	}
+	options := &bedrock.PingOptions{
+		UseProxy:    c.UseProxy,
+		ProxySource: proxySource,
+	}
+
+	err = retry.Do(func() error {
+		logger.Debug("pinging")
+		info, err := bedrock.Ping(address, c.Timeout, options)
+		logger.Debug("ping returned", zap.Error(err), zap.Any("info", info))
 		if err != nil {
-			if c.RetryLimit > 0 {
-				c.RetryLimit--
-				time.Sleep(c.RetryInterval)
-				continue
+			return err
+		}
+		logger.Debug("received response from bedrock server", zap.String("address", address), zap.String("response", info.Raw))
+
+		// a server that is starting up or misconfigured may report no player slots, whereas a pong without the
+		// field, which is decoded as -1, comes from servers and proxies that only report the minimal fields
+		if info.MaxPlayers == 0 && !c.SkipReadinessCheck {
+			_, _ = fmt.Fprintf(os.Stderr, "server not ready %s:%d", c.Host, c.Port)
+			return errors.New("server not ready")
+		}
+
+		if c.Json {
+			err := json.NewEncoder(os.Stdout).Encode(statusBedrockResult{
+				Host:       c.Host,
+				Port:       c.Port,
+				ServerInfo: info,
+			})
+
+			if err != nil {
+				logger.Error("failed to encode info", zap.Error(err))
 			}
-			logger.Fatal("Failed to ping Bedrock server", zap.Error(err))
-			return subcommands.ExitFailure
+
+		} else if c.ShowPlayerCount {
+			fmt.Printf("%d\n", info.Players)
+		} else {
+			fmt.Printf("%s : edition=%s version=%s online=%d max=%d motd='%s' level='%s' gamemode=%s\n",
+				address,
+				info.Edition, info.Version, info.Players, info.MaxPlayers, info.ServerName, info.LevelName, info.GameMode)
 		}
 
-		fmt.Printf("%s : version=%s online=%d max=%d",
-			address,
-			info.Version, info.Players, info.MaxPlayers)
+		return nil
+
+	},
+		retry.Delay(c.RetryInterval),
+		retry.DelayType(retry.FixedDelay),
+		retry.Attempts(uint(c.RetryLimit+1)),
+		retry.LastErrorOnly(true))
 
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "failed to ping %s:%d : %s", c.Host, c.Port, err)
+		return subcommands.ExitFailure
+	} else {
 		return subcommands.ExitSuccess
 	}
-
 }
@@ -0,0 +1,97 @@
+// Package chat renders Minecraft text components, such as the message of the day, into plain text,
+// ANSI colored text, and HTML. Legacy § formatting codes within the text are also applied.
+// See https://minecraft.wiki/w/Text_component_format
+package chat
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+)
+
+// Component is a text component, which may be given as a plain string, an object, or an array
+// where the first element is the parent of the remaining elements.
+type Component struct {
+	Text      string      `json:"text,omitempty"`
+	Translate string      `json:"translate,omitempty"`
+	With      []Component `json:"with,omitempty"`
+	// Fallback is used in place of the translation since the language files are not available
+	Fallback string `json:"fallback,omitempty"`
+	Keybind  string `json:"keybind,omitempty"`
+
+	Color         string `json:"color,omitempty"`
+	Bold          *bool  `json:"bold,omitempty"`
+	Italic        *bool  `json:"italic,omitempty"`
+	Underlined    *bool  `json:"underlined,omitempty"`
+	Strikethrough *bool  `json:"strikethrough,omitempty"`
+	Obfuscated    *bool  `json:"obfuscated,omitempty"`
+
+	Extra []Component `json:"extra,omitempty"`
+}
+
+// component avoids recursing into Component.UnmarshalJSON when decoding the object form
+type component Component
+
+func (c *Component) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return errors.New("empty text component")
+	}
+
+	switch data[0] {
+	case '"':
+		*c = Component{}
+		return json.Unmarshal(data, &c.Text)
+
+	case '[':
+		var list []Component
+		err := json.Unmarshal(data, &list)
+		if err != nil {
+			return err
+		}
+		*c = Component{}
+		if len(list) > 0 {
+			*c = list[0]
+			c.Extra = append(c.Extra[:len(c.Extra):len(c.Extra)], list[1:]...)
+		}
+		return nil
+
+	case '{':
+		var decoded component
+		err := json.Unmarshal(data, &decoded)
+		if err != nil {
+			return err
+		}
+		*c = Component(decoded)
+		return nil
+
+	case 'n':
+		// null
+		*c = Component{}
+		return nil
+
+	default:
+		// numbers and booleans are shown as-is
+		*c = Component{Text: string(data)}
+		return nil
+	}
+}
+
+// Parse decodes the JSON of a text component. Empty data results in an empty component.
+func Parse(data json.RawMessage) (*Component, error) {
+	var c Component
+	if len(bytes.TrimSpace(data)) == 0 {
+		return &c, nil
+	}
+	err := json.Unmarshal(data, &c)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// Legacy creates a component from text that may only be formatted with § codes, such as the message of the
+// day reported by the legacy Server List Ping.
+func Legacy(text string) *Component {
+	return &Component{Text: text}
+}
@@ -0,0 +1,359 @@
+package chat
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Format selects how a component is rendered
+type Format string
+
+const (
+	FormatPlain Format = "plain"
+	FormatAnsi  Format = "ansi"
+	FormatHtml  Format = "html"
+)
+
+// ParseFormat validates the given format name
+func ParseFormat(s string) (Format, error) {
+	switch Format(strings.ToLower(s)) {
+	case FormatPlain:
+		return FormatPlain, nil
+	case FormatAnsi:
+		return FormatAnsi, nil
+	case FormatHtml:
+		return FormatHtml, nil
+	}
+	return "", fmt.Errorf("unknown format '%s', must be plain, ansi, or html", s)
+}
+
+type namedColor struct {
+	code byte
+	hex  string
+	ansi int
+}
+
+// namedColors are the colors that may be referenced by name or legacy code, which align with the
+// 16 colors of ANSI terminals
+var namedColors = map[string]namedColor{
+	"black":        {'0', "#000000", 30},
+	"dark_blue":    {'1', "#0000AA", 34},
+	"dark_green":   {'2', "#00AA00", 32},
+	"dark_aqua":    {'3', "#00AAAA", 36},
+	"dark_red":     {'4', "#AA0000", 31},
+	"dark_purple":  {'5', "#AA00AA", 35},
+	"gold":         {'6', "#FFAA00", 33},
+	"gray":         {'7', "#AAAAAA", 37},
+	"dark_gray":    {'8', "#555555", 90},
+	"blue":         {'9', "#5555FF", 94},
+	"green":        {'a', "#55FF55", 92},
+	"aqua":         {'b', "#55FFFF", 96},
+	"red":          {'c', "#FF5555", 91},
+	"light_purple": {'d', "#FF55FF", 95},
+	"yellow":       {'e', "#FFFF55", 93},
+	"white":        {'f', "#FFFFFF", 97},
+}
+
+var legacyColorCodes = func() map[byte]string {
+	codes := make(map[byte]string, len(namedColors))
+	for name, color := range namedColors {
+		codes[color.code] = name
+	}
+	return codes
+}()
+
+// Style is the effective formatting of a run of text
+type Style struct {
+	// Color is either the name of a color or a #RRGGBB value, or empty for the default color
+	Color         string
+	Bold          bool
+	Italic        bool
+	Underlined    bool
+	Strikethrough bool
+	Obfuscated    bool
+}
+
+func (s Style) inherit(c *Component) Style {
+	if c.Color != "" {
+		s.Color = strings.ToLower(c.Color)
+	}
+	applyFlag(&s.Bold, c.Bold)
+	applyFlag(&s.Italic, c.Italic)
+	applyFlag(&s.Underlined, c.Underlined)
+	applyFlag(&s.Strikethrough, c.Strikethrough)
+	applyFlag(&s.Obfuscated, c.Obfuscated)
+	return s
+}
+
+func applyFlag(target *bool, value *bool) {
+	if value != nil {
+		*target = *value
+	}
+}
+
+// hex returns the #RRGGBB value of the color or empty if it is the default or not recognized
+func (s Style) hex() string {
+	if color, ok := namedColors[s.Color]; ok {
+		return color.hex
+	}
+	if isHexColor(s.Color) {
+		return strings.ToUpper(s.Color)
+	}
+	return ""
+}
+
+func isHexColor(s string) bool {
+	if len(s) != 7 || s[0] != '#' {
+		return false
+	}
+	_, err := strconv.ParseUint(s[1:], 16, 32)
+	return err == nil
+}
+
+// Span is a run of text with a single style
+type Span struct {
+	Text  string
+	Style Style
+}
+
+// Spans flattens the component and its children into runs of styled text, applying any legacy § codes
+func (c *Component) Spans() []Span {
+	return c.appendSpans(nil, Style{})
+}
+
+func (c *Component) appendSpans(spans []Span, parent Style) []Span {
+	style := parent.inherit(c)
+
+	switch {
+	case c.Text != "":
+		spans = appendLegacySpans(spans, c.Text, style)
+	case c.Translate != "":
+		spans = c.appendTranslation(spans, style)
+	case c.Keybind != "":
+		spans = appendLegacySpans(spans, c.Keybind, style)
+	}
+
+	for i := range c.Extra {
+		spans = c.Extra[i].appendSpans(spans, style)
+	}
+	return spans
+}
+
+// translationArgPattern matches the %s and %1$s placeholders of a translation along with escaped percent signs
+var translationArgPattern = regexp.MustCompile(`%(?:([0-9]+)\$)?s|%%`)
+
+// appendTranslation renders the fallback, when given, or otherwise the translation key with its arguments
+// substituted since the language files are not available
+func (c *Component) appendTranslation(spans []Span, style Style) []Span {
+	if c.Fallback != "" {
+		return appendLegacySpans(spans, c.Fallback, style)
+	}
+
+	key := c.Translate
+	next := 0
+	last := 0
+	for _, loc := range translationArgPattern.FindAllStringSubmatchIndex(key, -1) {
+		spans = appendLegacySpans(spans, key[last:loc[0]], style)
+		last = loc[1]
+
+		if key[loc[0]:loc[1]] == "%%" {
+			spans = appendLegacySpans(spans, "%", style)
+			continue
+		}
+		index := next
+		if loc[2] >= 0 {
+			position, _ := strconv.Atoi(key[loc[2]:loc[3]])
+			index = position - 1
+		} else {
+			next++
+		}
+		if index >= 0 && index < len(c.With) {
+			spans = c.With[index].appendSpans(spans, style)
+		}
+	}
+	return appendLegacySpans(spans, key[last:], style)
+}
+
+// appendLegacySpans splits the text at its § codes. As with the game, a color code also resets the formatting
+// and a reset code restores the style of the component.
+func appendLegacySpans(spans []Span, text string, base Style) []Span {
+	if text == "" {
+		return spans
+	}
+
+	style := base
+	var current strings.Builder
+	flush := func() {
+		if current.Len() > 0 {
+			spans = append(spans, Span{Text: current.String(), Style: style})
+			current.Reset()
+		}
+	}
+
+	runes := []rune(text)
+	for i := 0; i < len(runes); i++ {
+		if runes[i] != '§' || i+1 >= len(runes) {
+			current.WriteRune(runes[i])
+			continue
+		}
+
+		code := byte(0)
+		if r := runes[i+1]; r < 0x80 {
+			code = byte(strings.ToLower(string(r))[0])
+		}
+		i++
+
+		flush()
+		if name, ok := legacyColorCodes[code]; ok {
+			style = Style{Color: name}
+			continue
+		}
+		switch code {
+		case 'k':
+			style.Obfuscated = true
+		case 'l':
+			style.Bold = true
+		case 'm':
+			style.Strikethrough = true
+		case 'n':
+			style.Underlined = true
+		case 'o':
+			style.Italic = true
+		case 'r':
+			style = base
+		}
+	}
+	flush()
+
+	return spans
+}
+
+// Render formats the component in the given format
+func (c *Component) Render(format Format) string {
+	switch format {
+	case FormatAnsi:
+		return c.Ansi()
+	case FormatHtml:
+		return c.Html()
+	default:
+		return c.Plain()
+	}
+}
+
+// Plain returns the text without any formatting
+func (c *Component) Plain() string {
+	var sb strings.Builder
+	for _, span := range c.Spans() {
+		sb.WriteString(span.Text)
+	}
+	return sb.String()
+}
+
+const ansiReset = "\x1b[0m"
+
+// Ansi returns the text with SGR escape sequences. Named colors use the 16 standard colors and
+// other colors use 24-bit color sequences.
+func (c *Component) Ansi() string {
+	var sb strings.Builder
+	styled := false
+	var previous Style
+	for _, span := range c.Spans() {
+		if span.Style != previous {
+			if styled {
+				sb.WriteString(ansiReset)
+			}
+			if codes := span.Style.ansiCodes(); len(codes) > 0 {
+				sb.WriteString("\x1b[" + strings.Join(codes, ";") + "m")
+				styled = true
+			} else {
+				styled = false
+			}
+			previous = span.Style
+		}
+		sb.WriteString(span.Text)
+	}
+	if styled {
+		sb.WriteString(ansiReset)
+	}
+	return sb.String()
+}
+
+func (s Style) ansiCodes() []string {
+	var codes []string
+	if s.Bold {
+		codes = append(codes, "1")
+	}
+	if s.Italic {
+		codes = append(codes, "3")
+	}
+	if s.Underlined {
+		codes = append(codes, "4")
+	}
+	if s.Strikethrough {
+		codes = append(codes, "9")
+	}
+	if color, ok := namedColors[s.Color]; ok {
+		codes = append(codes, strconv.Itoa(color.ansi))
+	} else if isHexColor(s.Color) {
+		rgb, _ := strconv.ParseUint(s.Color[1:], 16, 32)
+		codes = append(codes, fmt.Sprintf("38;2;%d;%d;%d", rgb>>16&0xFF, rgb>>8&0xFF, rgb&0xFF))
+	}
+	return codes
+}
+
+// Html returns the text as escaped HTML where each styled run is wrapped in a span with an inline style
+// and line breaks are converted to br elements
+func (c *Component) Html() string {
+	var sb strings.Builder
+	for _, span := range c.Spans() {
+		text := strings.ReplaceAll(html.EscapeString(span.Text), "\n", "<br>")
+		css := span.Style.css()
+		if css == "" {
+			sb.WriteString(text)
+			continue
+		}
+		sb.WriteString(`<span style="`)
+		sb.WriteString(css)
+		sb.WriteString(`">`)
+		sb.WriteString(text)
+		sb.WriteString("</span>")
+	}
+	return sb.String()
+}
+
+func (s Style) css() string {
+	var properties []string
+	if hex := s.hex(); hex != "" {
+		properties = append(properties, "color:"+hex)
+	}
+	if s.Bold {
+		properties = append(properties, "font-weight:bold")
+	}
+	if s.Italic {
+		properties = append(properties, "font-style:italic")
+	}
+	var decorations []string
+	if s.Underlined {
+		decorations = append(decorations, "underline")
+	}
+	if s.Strikethrough {
+		decorations = append(decorations, "line-through")
+	}
+	if len(decorations) > 0 {
+		properties = append(properties, "text-decoration:"+strings.Join(decorations, " "))
+	}
+	return strings.Join(properties, ";")
+}
+
+// Render parses the JSON of a text component and formats it in the given format
+func Render(data json.RawMessage, format Format) (string, error) {
+	c, err := Parse(data)
+	if err != nil {
+		return "", err
+	}
+	return c.Render(format), nil
+}
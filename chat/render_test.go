@@ -0,0 +1,120 @@
+package chat
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name  string
+		json  string
+		plain string
+		ansi  string
+		html  string
+	}{
+		{
+			name:  "string",
+			json:  `"A Minecraft Server"`,
+			plain: "A Minecraft Server",
+			ansi:  "A Minecraft Server",
+			html:  "A Minecraft Server",
+		},
+		{
+			name:  "legacy codes in string",
+			json:  `"§aGreen §lbold§r plain"`,
+			plain: "Green bold plain",
+			ansi:  "\x1b[92mGreen \x1b[0m\x1b[1;92mbold\x1b[0m plain",
+			html:  `<span style="color:#55FF55">Green </span><span style="color:#55FF55;font-weight:bold">bold</span> plain`,
+		},
+		{
+			name:  "empty text with extra",
+			json:  `{"text":"","extra":[{"text":"Hello","color":"gold"},{"text":" world","bold":true}]}`,
+			plain: "Hello world",
+			ansi:  "\x1b[33mHello\x1b[0m\x1b[1m world\x1b[0m",
+			html:  `<span style="color:#FFAA00">Hello</span><span style="font-weight:bold"> world</span>`,
+		},
+		{
+			name:  "inherited style",
+			json:  `{"text":"a","color":"red","italic":true,"extra":[{"text":"b","italic":false},{"text":"c","underlined":true,"strikethrough":true}]}`,
+			plain: "abc",
+			ansi:  "\x1b[3;91ma\x1b[0m\x1b[91mb\x1b[0m\x1b[3;4;9;91mc\x1b[0m",
+			html:  `<span style="color:#FF5555;font-style:italic">a</span><span style="color:#FF5555">b</span><span style="color:#FF5555;font-style:italic;text-decoration:underline line-through">c</span>`,
+		},
+		{
+			name:  "hex color",
+			json:  `{"text":"hex","color":"#12ab34"}`,
+			plain: "hex",
+			ansi:  "\x1b[38;2;18;171;52mhex\x1b[0m",
+			html:  `<span style="color:#12AB34">hex</span>`,
+		},
+		{
+			name:  "array",
+			json:  `["",{"text":"one"},"§9two"]`,
+			plain: "onetwo",
+			ansi:  "one\x1b[94mtwo\x1b[0m",
+			html:  `one<span style="color:#5555FF">two</span>`,
+		},
+		{
+			name:  "translate fallback",
+			json:  `{"translate":"custom.motd","fallback":"Welcome"}`,
+			plain: "Welcome",
+			ansi:  "Welcome",
+			html:  "Welcome",
+		},
+		{
+			name:  "translate with arguments",
+			json:  `{"translate":"%2$s and %1$s at 100%%","with":["first",{"text":"second"}]}`,
+			plain: "second and first at 100%",
+			ansi:  "second and first at 100%",
+			html:  "second and first at 100%",
+		},
+		{
+			name:  "reset restores component style",
+			json:  `{"text":"§cred§r back","color":"aqua"}`,
+			plain: "red back",
+			ansi:  "\x1b[91mred\x1b[0m\x1b[96m back\x1b[0m",
+			html:  `<span style="color:#FF5555">red</span><span style="color:#55FFFF"> back</span>`,
+		},
+		{
+			name:  "escaped html and line breaks",
+			json:  `"<b>one</b>\ntwo & three"`,
+			plain: "<b>one</b>\ntwo & three",
+			ansi:  "<b>one</b>\ntwo & three",
+			html:  "&lt;b&gt;one&lt;/b&gt;<br>two &amp; three",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := Parse(json.RawMessage(tt.json))
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.plain, c.Render(FormatPlain))
+			assert.Equal(t, tt.ansi, c.Render(FormatAnsi))
+			assert.Equal(t, tt.html, c.Render(FormatHtml))
+		})
+	}
+}
+
+func TestRenderEmpty(t *testing.T) {
+	rendered, err := Render(nil, FormatPlain)
+	require.NoError(t, err)
+	assert.Empty(t, rendered)
+}
+
+func TestLegacy(t *testing.T) {
+	assert.Equal(t, "A Server", Legacy("§6A §lServer").Plain())
+}
+
+func TestParseFormat(t *testing.T) {
+	format, err := ParseFormat("ANSI")
+	require.NoError(t, err)
+	assert.Equal(t, FormatAnsi, format)
+
+	_, err = ParseFormat("markdown")
+	assert.Error(t, err)
+}
@@ -0,0 +1,506 @@
+// Package config loads the configuration file of the long-running commands, which declares the targets to
+// monitor along with defaults and the settings of each sink. The file is YAML, which includes JSON.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/itzg/mc-monitor/slp"
+	"github.com/itzg/mc-monitor/utils"
+	"go.yaml.in/yaml/v3"
+)
+
+// Sinks whose settings are applied by File.ApplyFlags
+const (
+	SinkPrometheus    = "prometheus"
+	SinkTelegraf      = "telegraf"
+	SinkOpenTelemetry = "otel"
+)
+
+// File is the content of a configuration file
+type File struct {
+	Defaults Defaults `yaml:"defaults"`
+	Targets  []Target `yaml:"targets"`
+	Sinks    Sinks    `yaml:"sinks"`
+	// Modules are selected by name by the /probe endpoint of export-for-prometheus
+	Modules map[string]*Module `yaml:"modules"`
+
+	targets []*utils.Target
+	// path and content are those given to Parse, which Watch compares to detect changes
+	path    string
+	content []byte
+}
+
+// Defaults are applied to the flags of the same name that were not given, where the labels are
+// instead added to each of the targets of the file
+type Defaults struct {
+	Timeout            string            `yaml:"timeout"`
+	Proxy              string            `yaml:"proxy"`
+	ProxySource        string            `yaml:"proxy-source"`
+	SkipSrvLookup      *bool             `yaml:"skip-srv-lookup"`
+	ProtocolVersion    int               `yaml:"protocol-version"`
+	ClientVersion      string            `yaml:"client-version"`
+	LoginProbe         *bool             `yaml:"login-probe"`
+	LoginProbeUsername string            `yaml:"login-probe-username"`
+	ExportModInfo      *bool             `yaml:"export-mod-info"`
+	Labels             map[string]string `yaml:"labels"`
+}
+
+// Target declares a server to monitor, where the address may also be given as a URI accepted by
+// utils.ParseTarget. The other fields take precedence over the options of the URI.
+type Target struct {
+	Edition         string            `yaml:"edition"`
+	Address         string            `yaml:"address"`
+	Timeout         string            `yaml:"timeout"`
+	Proxy           string            `yaml:"proxy"`
+	ProxySource     string            `yaml:"proxy-source"`
+	Probe           string            `yaml:"probe"`
+	ProtocolVersion int               `yaml:"protocol-version"`
+	ClientVersion   string            `yaml:"client-version"`
+	Labels          map[string]string `yaml:"labels"`
+}
+
+// Module declares the options of the servers probed with it, where the fields take precedence over the
+// options of the URI given as target
+type Module struct {
+	Timeout         string `yaml:"timeout"`
+	Proxy           string `yaml:"proxy"`
+	ProxySource     string `yaml:"proxy-source"`
+	Probe           string `yaml:"probe"`
+	ProtocolVersion int    `yaml:"protocol-version"`
+	ClientVersion   string `yaml:"client-version"`
+
+	// protocolVersion is resolved from the protocol or client version
+	protocolVersion int32
+}
+
+// Apply sets the options of the module on the given target, which fails when an option doesn't apply
+// to the edition of the target
+func (m *Module) Apply(target *utils.Target) error {
+	for _, option := range m.options() {
+		if err := target.SetOption(option.name, option.value); err != nil {
+			return err
+		}
+	}
+	if m.protocolVersion != 0 {
+		if target.Edition != utils.JavaEdition {
+			return errors.New("protocol and client versions only apply to Java servers")
+		}
+		target.ProtocolVersion = m.protocolVersion
+	}
+	return nil
+}
+
+type moduleOption struct {
+	// key is the field of the module and name is the corresponding option of targets
+	key, name, value string
+}
+
+func (m *Module) options() []moduleOption {
+	var options []moduleOption
+	add := func(key string, name string, value string) {
+		if value != "" {
+			options = append(options, moduleOption{key: key, name: name, value: value})
+		}
+	}
+	add("timeout", "timeout", m.Timeout)
+	add("proxy", "proxy", m.Proxy)
+	add("proxy-source", "proxy-source", m.ProxySource)
+	add("probe", "slp", m.Probe)
+	return options
+}
+
+type Sinks struct {
+	Prometheus    PrometheusSink    `yaml:"prometheus"`
+	Telegraf      TelegrafSink      `yaml:"telegraf"`
+	OpenTelemetry OpenTelemetrySink `yaml:"otel"`
+}
+
+type PrometheusSink struct {
+	Port int `yaml:"port"`
+}
+
+type TelegrafSink struct {
+	Address  string `yaml:"address"`
+	Interval string `yaml:"interval"`
+}
+
+type OpenTelemetrySink struct {
+	Endpoint string `yaml:"endpoint"`
+	Timeout  string `yaml:"timeout"`
+	Interval string `yaml:"interval"`
+}
+
+// Problem is an error found at a line of the configuration file
+type Problem struct {
+	Line    int
+	Message string
+}
+
+// Error reports every problem found in a configuration file
+type Error struct {
+	Path     string
+	Problems []Problem
+}
+
+func (e *Error) Error() string {
+	var b strings.Builder
+	for i, problem := range e.Problems {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		_, _ = fmt.Fprintf(&b, "%s:%d: %s", e.Path, problem.Line, problem.Message)
+	}
+	return b.String()
+}
+
+var (
+	yamlLinePattern         = regexp.MustCompile(`^(?:yaml: )?line (\d+): (.*)$`)
+	yamlUnknownFieldPattern = regexp.MustCompile(`^field (\S+) not found in type \S+$`)
+)
+
+// Load reads and validates the configuration file at the given path. When the file is invalid, the returned
+// error is an *Error with every problem that was found.
+func Load(path string) (*File, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read configuration file: %w", err)
+	}
+	return Parse(path, content)
+}
+
+// Parse validates the given content of the configuration file at path, which is only used to report problems
+func Parse(path string, content []byte) (*File, error) {
+	v := &validator{err: &Error{Path: path}}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(content, &root); err != nil {
+		v.addYamlError(err)
+		return nil, v.err
+	}
+
+	file := &File{path: path, content: content}
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(file); err != nil && !errors.Is(err, io.EOF) {
+		v.addYamlError(err)
+	}
+
+	var document *yaml.Node
+	if len(root.Content) > 0 {
+		document = root.Content[0]
+	}
+	v.validateDefaults(&file.Defaults, child(document, "defaults"))
+	v.validateSinks(&file.Sinks, child(document, "sinks"))
+	modulesNode := child(document, "modules")
+	for _, name := range slices.Sorted(maps.Keys(file.Modules)) {
+		// a module declared without any fields uses the options of the command
+		if file.Modules[name] == nil {
+			file.Modules[name] = &Module{}
+		}
+		v.validateModule(file.Modules[name], child(modulesNode, name))
+	}
+
+	targetsNode := child(document, "targets")
+	for i := range file.Targets {
+		var node *yaml.Node
+		if targetsNode != nil && targetsNode.Kind == yaml.SequenceNode && i < len(targetsNode.Content) {
+			node = targetsNode.Content[i]
+		}
+		if target := v.buildTarget(&file.Targets[i], file.Defaults.Labels, node); target != nil {
+			file.targets = append(file.targets, target)
+		}
+	}
+
+	if len(v.err.Problems) > 0 {
+		slices.SortStableFunc(v.err.Problems, func(a, b Problem) int {
+			return a.Line - b.Line
+		})
+		return nil, v.err
+	}
+	return file, nil
+}
+
+// TargetSpecs returns the targets of the file, which include the labels of the defaults
+func (f *File) TargetSpecs() []*utils.Target {
+	return f.targets
+}
+
+// ApplyFlags sets the flags that correspond to the defaults and the settings of the given sink, except those
+// already given on the command line or by environment variable. Flags the command does not have are skipped.
+func (f *File) ApplyFlags(flags *flag.FlagSet, sink string) error {
+	given := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+	// environment variables are applied as values rather than parsed arguments
+	flags.VisitAll(func(f *flag.Flag) {
+		if f.Value.String() != f.DefValue {
+			given[f.Name] = true
+		}
+	})
+
+	for name, value := range f.flagValues(sink) {
+		if given[name] || flags.Lookup(name) == nil {
+			continue
+		}
+		if err := flags.Set(name, value); err != nil {
+			return fmt.Errorf("failed to apply %s from the configuration file: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// flagValues returns the values of the defaults and given sink by the name of the corresponding flag
+func (f *File) flagValues(sink string) map[string]string {
+	values := make(map[string]string)
+	setString := func(name string, value string) {
+		if value != "" {
+			values[name] = value
+		}
+	}
+	setBool := func(name string, value *bool) {
+		if value != nil {
+			values[name] = strconv.FormatBool(*value)
+		}
+	}
+	setInt := func(name string, value int) {
+		if value != 0 {
+			values[name] = strconv.Itoa(value)
+		}
+	}
+
+	d := f.Defaults
+	setString("timeout", d.Timeout)
+	if d.Proxy == proxyNone || d.Proxy == "0" {
+		values["use-proxy"] = "false"
+	} else if d.Proxy != "" {
+		values["use-proxy"] = "true"
+		values["proxy-version"] = d.Proxy
+	}
+	setString("proxy-source", d.ProxySource)
+	setBool("skip-srv-lookup", d.SkipSrvLookup)
+	setInt("protocol-version", d.ProtocolVersion)
+	setString("client-version", d.ClientVersion)
+	setBool("login-probe", d.LoginProbe)
+	setString("login-probe-username", d.LoginProbeUsername)
+	setBool("export-mod-info", d.ExportModInfo)
+
+	switch sink {
+	case SinkPrometheus:
+		setInt("port", f.Sinks.Prometheus.Port)
+	case SinkTelegraf:
+		setString("telegraf-address", f.Sinks.Telegraf.Address)
+		setString("interval", f.Sinks.Telegraf.Interval)
+	case SinkOpenTelemetry:
+		setString("otel-collector-endpoint", f.Sinks.OpenTelemetry.Endpoint)
+		setString("otel-collector-timeout", f.Sinks.OpenTelemetry.Timeout)
+		setString("interval", f.Sinks.OpenTelemetry.Interval)
+	}
+	return values
+}
+
+const proxyNone = "none"
+
+type validator struct {
+	err *Error
+}
+
+func (v *validator) add(line int, format string, args ...any) {
+	v.err.Problems = append(v.err.Problems, Problem{Line: line, Message: fmt.Sprintf(format, args...)})
+}
+
+// addYamlError adds the problems reported by the YAML parser or decoder, which include the line in the message
+func (v *validator) addYamlError(err error) {
+	messages := []string{err.Error()}
+	var typeError *yaml.TypeError
+	if errors.As(err, &typeError) {
+		messages = typeError.Errors
+	}
+	for _, message := range messages {
+		line := 0
+		if match := yamlLinePattern.FindStringSubmatch(message); match != nil {
+			line, _ = strconv.Atoi(match[1])
+			message = match[2]
+		}
+		if match := yamlUnknownFieldPattern.FindStringSubmatch(message); match != nil {
+			message = fmt.Sprintf("unknown field '%s'", match[1])
+		}
+		v.add(line, "%s", message)
+	}
+}
+
+func (v *validator) validateDefaults(d *Defaults, node *yaml.Node) {
+	v.validateDuration(d.Timeout, "timeout", node)
+	if d.Proxy != "" && d.Proxy != proxyNone && d.Proxy != "0" {
+		version, err := strconv.ParseUint(d.Proxy, 10, 8)
+		if err == nil {
+			err = utils.ValidateProxyVersion(uint(version))
+		}
+		if err != nil {
+			v.add(lineOf(node, "proxy"), "invalid proxy '%s', must be 1, 2, or none", d.Proxy)
+		}
+	}
+	if _, err := utils.ParseProxySource(d.ProxySource); err != nil {
+		v.add(lineOf(node, "proxy-source"), "%s", err)
+	}
+	if _, err := slp.ResolveProtocolVersion(d.ProtocolVersion, d.ClientVersion); err != nil {
+		v.add(lineOf(node, "client-version", "protocol-version"), "%s", err)
+	}
+	var labels utils.Target
+	labelsNode := child(node, "labels")
+	for _, name := range slices.Sorted(maps.Keys(d.Labels)) {
+		if err := labels.SetOption("label."+name, d.Labels[name]); err != nil {
+			v.add(lineOf(labelsNode, name), "%s", err)
+		}
+	}
+}
+
+func (v *validator) validateSinks(s *Sinks, node *yaml.Node) {
+	prometheus := child(node, SinkPrometheus)
+	if s.Prometheus.Port < 0 || s.Prometheus.Port > 65535 {
+		v.add(lineOf(prometheus, "port"), "invalid port %d", s.Prometheus.Port)
+	}
+
+	telegraf := child(node, SinkTelegraf)
+	if s.Telegraf.Address != "" {
+		if _, _, explicit, err := utils.ParseHostPort(s.Telegraf.Address, 0); err != nil || !explicit {
+			v.add(lineOf(telegraf, "address"), "invalid address '%s', must be host:port", s.Telegraf.Address)
+		}
+	}
+	v.validateDuration(s.Telegraf.Interval, "interval", telegraf)
+
+	otel := child(node, SinkOpenTelemetry)
+	v.validateDuration(s.OpenTelemetry.Timeout, "timeout", otel)
+	v.validateDuration(s.OpenTelemetry.Interval, "interval", otel)
+}
+
+func (v *validator) validateModule(m *Module, node *yaml.Node) {
+	// options that only apply to Java servers are checked when applied to a target
+	target := &utils.Target{Edition: utils.JavaEdition}
+	for _, option := range m.options() {
+		if err := target.SetOption(option.name, option.value); err != nil {
+			v.add(lineOf(node, option.key), "%s", err)
+		}
+	}
+	protocolVersion, err := slp.ResolveProtocolVersion(m.ProtocolVersion, m.ClientVersion)
+	if err != nil {
+		v.add(lineOf(node, "client-version", "protocol-version"), "%s", err)
+	}
+	m.protocolVersion = protocolVersion
+}
+
+func (v *validator) validateDuration(value string, key string, node *yaml.Node) {
+	if value == "" {
+		return
+	}
+	if duration, err := time.ParseDuration(value); err != nil || duration <= 0 {
+		v.add(lineOf(node, key), "invalid %s '%s'", key, value)
+	}
+}
+
+// buildTarget converts the target declared by the file, returning nil when it has problems
+func (v *validator) buildTarget(t *Target, defaultLabels map[string]string, node *yaml.Node) *utils.Target {
+	problems := len(v.err.Problems)
+
+	edition := utils.JavaEdition
+	if t.Edition != "" {
+		if !utils.ValidEdition(t.Edition) {
+			v.add(lineOf(node, "edition"), "invalid edition '%s', must be java or bedrock", t.Edition)
+			return nil
+		}
+		edition = utils.ServerEdition(t.Edition)
+	}
+	if t.Address == "" {
+		v.add(lineOf(node), "target requires an address")
+		return nil
+	}
+	target, err := utils.ParseTarget(t.Address, edition)
+	if err != nil {
+		v.add(lineOf(node, "address"), "invalid address '%s': %s", t.Address, err)
+		return nil
+	}
+	if t.Edition != "" && target.Edition != edition {
+		v.add(lineOf(node, "edition"), "edition %s conflicts with the scheme of the address", t.Edition)
+		return nil
+	}
+
+	setOption := func(key string, option string, value string) {
+		if value == "" {
+			return
+		}
+		if err := target.SetOption(option, value); err != nil {
+			v.add(lineOf(node, key), "%s", err)
+		}
+	}
+	setOption("timeout", "timeout", t.Timeout)
+	setOption("proxy", "proxy", t.Proxy)
+	setOption("proxy-source", "proxy-source", t.ProxySource)
+	setOption("probe", "slp", t.Probe)
+
+	for name, value := range defaultLabels {
+		if _, exists := target.Labels[name]; !exists {
+			// problems with the default labels are reported once by validateDefaults
+			_ = target.SetOption("label."+name, value)
+		}
+	}
+	labelsNode := child(node, "labels")
+	for _, name := range slices.Sorted(maps.Keys(t.Labels)) {
+		if err := target.SetOption("label."+name, t.Labels[name]); err != nil {
+			v.add(lineOf(labelsNode, name), "%s", err)
+		}
+	}
+
+	if t.ProtocolVersion != 0 || t.ClientVersion != "" {
+		if target.Edition != utils.JavaEdition {
+			v.add(lineOf(node, "client-version", "protocol-version"), "protocol and client versions only apply to Java servers")
+		} else if protocolVersion, err := slp.ResolveProtocolVersion(t.ProtocolVersion, t.ClientVersion); err != nil {
+			v.add(lineOf(node, "client-version", "protocol-version"), "%s", err)
+		} else {
+			target.ProtocolVersion = protocolVersion
+		}
+	}
+
+	if len(v.err.Problems) > problems {
+		return nil
+	}
+	return target
+}
+
+// child returns the value of the given key of the mapping node, or nil when absent
+func child(mapping *yaml.Node, key string) *yaml.Node {
+	if mapping == nil || mapping.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// lineOf returns the line of the first of the given keys found in the mapping node, or else the line of
+// the node itself. Zero is returned when the node is nil.
+func lineOf(mapping *yaml.Node, keys ...string) int {
+	if mapping == nil {
+		return 0
+	}
+	for _, key := range keys {
+		if value := child(mapping, key); value != nil {
+			return value.Line
+		}
+	}
+	return mapping.Line
+}
@@ -0,0 +1,214 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/itzg/mc-monitor/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const validConfig = `
+defaults:
+  timeout: 5s
+  proxy: 2
+  labels:
+    env: prod
+targets:
+  - address: mc.example.com
+    probe: legacy
+    labels:
+      team: survival
+  - address: java://lobby.example.com:25570?label.env=staging
+    client-version: 1.20.4
+  - edition: bedrock
+    address: bedrock.example.com
+    timeout: 2s
+    proxy: none
+sinks:
+  prometheus:
+    port: 9150
+  telegraf:
+    address: telegraf:8094
+    interval: 30s
+`
+
+func TestParse(t *testing.T) {
+	file, err := Parse("mc-monitor.yaml", []byte(validConfig))
+	require.NoError(t, err)
+
+	targets := file.TargetSpecs()
+	require.Len(t, targets, 3)
+
+	assert.Equal(t, &utils.Target{
+		Edition:    utils.JavaEdition,
+		Host:       "mc.example.com",
+		Port:       25565,
+		SlpVariant: "legacy",
+		Labels:     map[string]string{"env": "prod", "team": "survival"},
+	}, targets[0])
+
+	// labels of the URI take precedence over the defaults
+	assert.Equal(t, map[string]string{"env": "staging"}, targets[1].Labels)
+	assert.Equal(t, int32(765), targets[1].ProtocolVersion)
+	assert.True(t, targets[1].ExplicitPort)
+
+	assert.Equal(t, utils.BedrockEdition, targets[2].Edition)
+	assert.Equal(t, uint16(19132), targets[2].Port)
+	assert.Equal(t, 2*time.Second, targets[2].Timeout)
+	require.NotNil(t, targets[2].ProxyVersion)
+	assert.Equal(t, byte(0), *targets[2].ProxyVersion)
+}
+
+func TestParseJson(t *testing.T) {
+	file, err := Parse("mc-monitor.json", []byte(`{
+  "targets": [
+    {"address": "mc.example.com:25566", "labels": {"env": "prod"}}
+  ]
+}`))
+	require.NoError(t, err)
+
+	require.Len(t, file.TargetSpecs(), 1)
+	assert.Equal(t, uint16(25566), file.TargetSpecs()[0].Port)
+}
+
+func TestParseReportsEveryProblem(t *testing.T) {
+	content := `defaults:
+  timeout: soon
+  proxy: 3
+targets:
+  - address: mc.example.com
+    retries: 3
+  - edition: bedrock
+    address: bedrock.example.com
+    probe: legacy
+  - address: java://mc.example.com?label.1env=prod
+  - labels:
+      env: prod
+  - address: mc.example.com
+    client-version: 0.1
+sinks:
+  prometheus:
+    port: 70000
+  telegraf:
+    address: telegraf
+`
+	_, err := Parse("mc-monitor.yaml", []byte(content))
+	var configErr *Error
+	require.ErrorAs(t, err, &configErr)
+
+	assert.Equal(t, []Problem{
+		{Line: 2, Message: "invalid timeout 'soon'"},
+		{Line: 3, Message: "invalid proxy '3', must be 1, 2, or none"},
+		{Line: 6, Message: "unknown field 'retries'"},
+		{Line: 9, Message: "slp only applies to Java servers"},
+		{Line: 10, Message: "invalid address 'java://mc.example.com?label.1env=prod': invalid label name '1env'"},
+		{Line: 11, Message: "target requires an address"},
+		{Line: 14, Message: "unknown client version '0.1', use the protocol version instead"},
+		{Line: 17, Message: "invalid port 70000"},
+		{Line: 19, Message: "invalid address 'telegraf', must be host:port"},
+	}, configErr.Problems)
+	assert.Contains(t, err.Error(), "mc-monitor.yaml:6: unknown field 'retries'\n")
+}
+
+func TestParseSyntaxError(t *testing.T) {
+	_, err := Parse("mc-monitor.yaml", []byte("targets:\n  - address: [mc.example.com\n"))
+	var configErr *Error
+	require.ErrorAs(t, err, &configErr)
+	require.Len(t, configErr.Problems, 1)
+	assert.NotZero(t, configErr.Problems[0].Line)
+}
+
+func TestParseModules(t *testing.T) {
+	file, err := Parse("mc-monitor.yaml", []byte(`
+modules:
+  legacy:
+    timeout: 3s
+    probe: legacy
+    client-version: 1.20.4
+  proxied:
+    proxy: 2
+  plain:
+`))
+	require.NoError(t, err)
+	require.Len(t, file.Modules, 3)
+
+	target := &utils.Target{Edition: utils.JavaEdition, Host: "mc.example.com", Port: 25565, Timeout: time.Second}
+	require.NoError(t, file.Modules["legacy"].Apply(target))
+	assert.Equal(t, 3*time.Second, target.Timeout)
+	assert.Equal(t, "legacy", target.SlpVariant)
+	assert.Equal(t, int32(765), target.ProtocolVersion)
+
+	bedrock := &utils.Target{Edition: utils.BedrockEdition, Host: "bedrock.example.com", Port: 19132}
+	assert.EqualError(t, file.Modules["legacy"].Apply(bedrock), "slp only applies to Java servers")
+	require.NoError(t, file.Modules["proxied"].Apply(bedrock))
+	assert.Equal(t, byte(2), *bedrock.ProxyVersion)
+	require.NoError(t, file.Modules["plain"].Apply(bedrock))
+
+	_, err = Parse("mc-monitor.yaml", []byte(`modules:
+  broken:
+    timeout: soon
+    proxy: 3
+    protocol-version: -1
+`))
+	var configErr *Error
+	require.ErrorAs(t, err, &configErr)
+	assert.Equal(t, []Problem{
+		{Line: 3, Message: "invalid timeout 'soon'"},
+		{Line: 4, Message: "proxy version must be 1 or 2"},
+		{Line: 5, Message: "invalid protocol version -1"},
+	}, configErr.Problems)
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mc-monitor.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(validConfig), 0o644))
+
+	file, err := Load(path)
+	require.NoError(t, err)
+	assert.Len(t, file.TargetSpecs(), 3)
+
+	_, err = Load(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.ErrorContains(t, err, "failed to read configuration file")
+}
+
+func TestApplyFlags(t *testing.T) {
+	file, err := Parse("mc-monitor.yaml", []byte(validConfig))
+	require.NoError(t, err)
+
+	flags := flag.NewFlagSet("export-for-prometheus", flag.ContinueOnError)
+	timeout := flags.Duration("timeout", time.Minute, "")
+	useProxy := flags.Bool("use-proxy", false, "")
+	proxyVersion := flags.Uint("proxy-version", 1, "")
+	port := flags.Int("port", 8080, "")
+	require.NoError(t, flags.Parse([]string{"-port", "9000"}))
+
+	require.NoError(t, file.ApplyFlags(flags, SinkPrometheus))
+
+	assert.Equal(t, 5*time.Second, *timeout)
+	assert.True(t, *useProxy)
+	assert.Equal(t, uint(2), *proxyVersion)
+	// flags given on the command line take precedence
+	assert.Equal(t, 9000, *port)
+}
+
+func TestApplyFlagsSkipsValuesFromEnvironment(t *testing.T) {
+	file, err := Parse("mc-monitor.yaml", []byte(validConfig))
+	require.NoError(t, err)
+
+	flags := flag.NewFlagSet("gather-for-telegraf", flag.ContinueOnError)
+	address := flags.String("telegraf-address", "localhost:8094", "")
+	interval := flags.Duration("interval", time.Minute, "")
+	// the same as flagsfiller does for environment variables
+	require.NoError(t, flags.Lookup("telegraf-address").Value.Set("telegraf.example.com:8094"))
+	require.NoError(t, flags.Parse(nil))
+
+	require.NoError(t, file.ApplyFlags(flags, SinkTelegraf))
+
+	assert.Equal(t, "telegraf.example.com:8094", *address)
+	assert.Equal(t, 30*time.Second, *interval)
+}
@@ -0,0 +1,63 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// watchInterval is how often Watch checks if the content of the file has changed
+var watchInterval = 5 * time.Second
+
+// NotifyReload returns a channel that receives SIGHUP, which is meant for Watch. SIGHUP is only caught once this
+// is called, so that processes without a configuration file still terminate on SIGHUP as before.
+func NotifyReload() <-chan os.Signal {
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	return reload
+}
+
+// Watch loads the given file again whenever a value is received from reload, such as SIGHUP, or when its
+// content changes, which is checked periodically. The apply function is called with each version of the file
+// that loads without problems, where problems are logged and the previously applied version stays in effect.
+// Watch returns when the context is done.
+func Watch(ctx context.Context, file *File, reload <-chan os.Signal, logger *zap.Logger, apply func(*File)) {
+	path, content := file.path, file.content
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+
+	for {
+		var forced bool
+		select {
+		case <-ctx.Done():
+			return
+		case <-reload:
+			forced = true
+		case <-ticker.C:
+		}
+
+		updated, err := os.ReadFile(path)
+		if err != nil {
+			logger.Error("failed to read configuration file", zap.String("path", path), zap.Error(err))
+			continue
+		}
+		if !forced && bytes.Equal(updated, content) {
+			continue
+		}
+		content = updated
+
+		logger.Info("reloading configuration file", zap.String("path", path), zap.Bool("signaled", forced))
+		file, err = Parse(path, content)
+		if err != nil {
+			logger.Error("configuration file is invalid, keeping the current targets",
+				zap.String("path", path), zap.Error(err))
+			continue
+		}
+		apply(file)
+	}
+}
@@ -0,0 +1,55 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestWatch(t *testing.T) {
+	previousInterval := watchInterval
+	watchInterval = 10 * time.Millisecond
+	t.Cleanup(func() {
+		watchInterval = previousInterval
+	})
+
+	path := filepath.Join(t.TempDir(), "mc-monitor.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("targets:\n  - address: a.example.com\n"), 0o644))
+	file, err := Load(path)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	reload := make(chan os.Signal)
+	applied := make(chan *File)
+	go Watch(ctx, file, reload, zap.NewNop(), func(file *File) {
+		applied <- file
+	})
+
+	// an invalid version is not applied
+	require.NoError(t, os.WriteFile(path, []byte("targets:\n  - address: a.example.com\n    retries: 3\n"), 0o644))
+	require.NoError(t, os.WriteFile(path, []byte("targets:\n  - address: b.example.com\n"), 0o644))
+	select {
+	case file := <-applied:
+		require.Len(t, file.TargetSpecs(), 1)
+		assert.Equal(t, "b.example.com", file.TargetSpecs()[0].Host)
+	case <-time.After(5 * time.Second):
+		t.Fatal("change of the file was not applied")
+	}
+
+	// a signal reloads the file even when unchanged
+	reload <- syscall.SIGHUP
+	select {
+	case file := <-applied:
+		assert.Equal(t, "b.example.com", file.TargetSpecs()[0].Host)
+	case <-time.After(5 * time.Second):
+		t.Fatal("signal did not reload the file")
+	}
+}
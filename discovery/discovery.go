@@ -0,0 +1,158 @@
+// Package discovery finds targets to monitor from sources other than the flags and configuration file,
+// such as the Services and Pods of Kubernetes, and combines the targets of every source.
+package discovery
+
+import (
+	"context"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/itzg/mc-monitor/utils"
+	"go.uber.org/zap"
+)
+
+// Names of the sources of targets other than the discoverers
+const (
+	FlagsSource  = "flags"
+	ConfigSource = "config"
+)
+
+var invalidLabelNameChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+// Config creates the discoverer of a source, which is nil when the source is not enabled
+type Config interface {
+	NewDiscoverer(logger *zap.Logger) (Discoverer, error)
+}
+
+// NewDiscoverers creates the discoverers of the enabled sources
+func NewDiscoverers(logger *zap.Logger, configs ...Config) ([]Discoverer, error) {
+	var discoverers []Discoverer
+	for _, config := range configs {
+		discoverer, err := config.NewDiscoverer(logger)
+		if err != nil {
+			return nil, err
+		}
+		if discoverer != nil {
+			discoverers = append(discoverers, discoverer)
+		}
+	}
+	return discoverers, nil
+}
+
+// Discoverer finds the targets of one source
+type Discoverer interface {
+	// Name identifies the source in logs and in Targets
+	Name() string
+	// Run sends the complete list of discovered targets each time it changes until the context is done
+	Run(ctx context.Context, updates chan<- []*utils.Target) error
+}
+
+// Targets combines the latest targets of each source, where the targets of sources are ordered by
+// when each source was first set
+type Targets struct {
+	mu      sync.Mutex
+	names   []string
+	targets map[string][]*utils.Target
+}
+
+// Set replaces the targets of the given source and returns the targets of all sources
+func (t *Targets) Set(source string, targets []*utils.Target) []*utils.Target {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.targets == nil {
+		t.targets = make(map[string][]*utils.Target)
+	}
+	if _, exists := t.targets[source]; !exists {
+		t.names = append(t.names, source)
+	}
+	t.targets[source] = targets
+
+	combined := make([][]*utils.Target, 0, len(t.names))
+	for _, name := range t.names {
+		combined = append(combined, t.targets[name])
+	}
+	return slices.Concat(combined...)
+}
+
+// Run runs each of the discoverers and calls update with the name and targets of a discoverer whenever it reports
+// a change, where update may be called concurrently for different discoverers. A discoverer that fails is logged
+// and its last targets are kept.
+func Run(ctx context.Context, discoverers []Discoverer, update func(source string, targets []*utils.Target), logger *zap.Logger) {
+	for _, discoverer := range discoverers {
+		updates := make(chan []*utils.Target)
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case discovered := <-updates:
+					logger.Debug("discovered targets",
+						zap.String("source", discoverer.Name()), zap.Int("count", len(discovered)))
+					update(discoverer.Name(), discovered)
+				}
+			}
+		}()
+		go func() {
+			if err := discoverer.Run(ctx, updates); err != nil {
+				logger.Error("target discovery failed", zap.String("source", discoverer.Name()), zap.Error(err))
+			}
+		}()
+	}
+}
+
+// publisher sends the targets of a discoverer when they differ from the ones last sent, where the first
+// targets are always sent, even when there are none
+type publisher struct {
+	updates chan<- []*utils.Target
+	sent    bool
+	keys    []string
+}
+
+// publish returns false when the context is done before the targets could be sent
+func (p *publisher) publish(ctx context.Context, targets []*utils.Target) bool {
+	// sources list their resources in no particular order
+	slices.SortFunc(targets, func(a, b *utils.Target) int {
+		return strings.Compare(a.Key(), b.Key())
+	})
+	keys := targetKeys(targets)
+	if p.sent && slices.Equal(keys, p.keys) {
+		return true
+	}
+
+	select {
+	case p.updates <- targets:
+		p.sent, p.keys = true, keys
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// addLabels sets the labels of a resource as label options of the target, where only the names that are allowed,
+// or all of them when * is allowed, are converted into valid label names and added
+func addLabels(target *utils.Target, labels map[string]string, allowed []string, logger *zap.Logger) {
+	for _, name := range slices.Sorted(maps.Keys(labels)) {
+		if !slices.Contains(allowed, "*") && !slices.Contains(allowed, name) {
+			continue
+		}
+		labelName := invalidLabelNameChars.ReplaceAllString(name, "_")
+		if labelName[0] >= '0' && labelName[0] <= '9' {
+			labelName = "_" + labelName
+		}
+		if err := target.SetOption("label."+labelName, labels[name]); err != nil {
+			logger.Debug("skipping label", zap.String("label", name), zap.Error(err))
+		}
+	}
+}
+
+func targetKeys(targets []*utils.Target) []string {
+	keys := make([]string, 0, len(targets))
+	for _, target := range targets {
+		keys = append(keys, target.Key())
+	}
+	return keys
+}
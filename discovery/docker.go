@@ -0,0 +1,369 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/itzg/mc-monitor/utils"
+	"go.uber.org/zap"
+)
+
+// Labels of containers that are read by the Docker discovery
+const (
+	DockerLabelPrefix = "mc-monitor."
+	// DockerEditionLabel is java or bedrock, which takes precedence over the EDITION environment variable
+	DockerEditionLabel = DockerLabelPrefix + "edition"
+	// DockerPortLabel is the port of the server within the container, which takes precedence over the
+	// SERVER_PORT environment variable
+	DockerPortLabel = DockerLabelPrefix + "port"
+	// DockerEnableLabel set to false excludes a container that would otherwise be discovered by its image
+	DockerEnableLabel = DockerLabelPrefix + "enable"
+)
+
+// bedrockImage is the image whose containers are Bedrock servers unless declared otherwise
+const bedrockImage = "itzg/minecraft-bedrock-server"
+
+// dockerRetryInterval is how long Docker.Run waits to connect again after losing the Docker API
+var dockerRetryInterval = 5 * time.Second
+
+// DockerConfig declares the discovery of servers from the containers of Docker
+type DockerConfig struct {
+	Enabled       bool     `usage:"discovers servers from the containers of Docker"`
+	Endpoint      string   `default:"unix:///var/run/docker.sock" usage:"address of the Docker API given as unix:// or tcp://"`
+	Images        []string `default:"itzg/minecraft-server,itzg/minecraft-bedrock-server" override-value:"true" usage:"images of the containers to discover along with containers that have an mc-monitor label, where a tag is only compared when given"`
+	Network       string   `usage:"name of the Docker network whose addresses of containers are monitored. When empty, the published port of the server is monitored or else the address on the first network"`
+	PublishedHost string   `default:"localhost" usage:"host used to reach published ports that are bound to all interfaces of the Docker host"`
+	Labels        []string `default:"com.docker.compose.project,com.docker.compose.service" override-value:"true" usage:"container labels added to the metrics of discovered servers, where * adds all of them. Names are converted into valid label names, such as com.docker.compose.service into com_docker_compose_service"`
+}
+
+// NewDiscoverer creates the discoverer when enabled, otherwise it returns nil
+func (c *DockerConfig) NewDiscoverer(logger *zap.Logger) (Discoverer, error) {
+	if !c.Enabled {
+		return nil, nil
+	}
+	return NewDocker(*c, logger)
+}
+
+// Docker discovers servers from the running containers of the Docker API that use one of the images or have an
+// mc-monitor label. The edition and port within the container are given by labels or the EDITION and SERVER_PORT
+// environment variables used by the itzg images.
+type Docker struct {
+	client  *http.Client
+	baseURL string
+	config  DockerConfig
+	logger  *zap.Logger
+}
+
+func NewDocker(config DockerConfig, logger *zap.Logger) (*Docker, error) {
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Docker endpoint: %w", err)
+	}
+
+	// timeouts are left to the contexts of requests since events are streamed
+	transport := &http.Transport{}
+	var baseURL string
+	switch endpoint.Scheme {
+	case "unix":
+		var dialer net.Dialer
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", endpoint.Path)
+		}
+		baseURL = "http://docker"
+	case "tcp":
+		baseURL = "http://" + endpoint.Host
+	default:
+		return nil, fmt.Errorf("invalid Docker endpoint '%s', must be a unix:// or tcp:// address", config.Endpoint)
+	}
+
+	return &Docker{
+		client:  &http.Client{Transport: transport},
+		baseURL: baseURL,
+		config:  config,
+		logger:  logger.Named("docker"),
+	}, nil
+}
+
+func (d *Docker) Name() string {
+	return "docker"
+}
+
+func (d *Docker) Run(ctx context.Context, updates chan<- []*utils.Target) error {
+	publisher := publisher{updates: updates}
+	for {
+		err := d.watch(ctx, &publisher)
+		if ctx.Err() != nil {
+			return nil
+		}
+		d.logger.Warn("lost the Docker API, keeping the current targets",
+			zap.Duration("retryIn", dockerRetryInterval), zap.Error(err))
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(dockerRetryInterval):
+		}
+	}
+}
+
+// watch lists the containers each time one starts or stops until the events can't be received
+func (d *Docker) watch(ctx context.Context, publisher *publisher) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// events are subscribed before listing so that no change is missed in between
+	filters := `{"type":["container"],"event":["start","die"]}`
+	events, err := d.get(ctx, "/events?filters="+url.QueryEscape(filters))
+	if err != nil {
+		return err
+	}
+	//goland:noinspection GoUnhandledErrorResult
+	defer events.Close()
+
+	// events only signal that the containers need to be listed again, so they are coalesced
+	changed := make(chan struct{}, 1)
+	notify := func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	}
+	failed := make(chan error, 1)
+	go func() {
+		decoder := json.NewDecoder(events)
+		for {
+			var event struct{}
+			if err := decoder.Decode(&event); err != nil {
+				failed <- fmt.Errorf("failed to receive events: %w", err)
+				return
+			}
+			notify()
+		}
+	}()
+	notify()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-failed:
+			return err
+		case <-changed:
+		}
+
+		targets, err := d.targets(ctx)
+		if err != nil {
+			return err
+		}
+		if !publisher.publish(ctx, targets) {
+			return nil
+		}
+	}
+}
+
+// dockerContainer is the part of an inspected container used by the discovery
+type dockerContainer struct {
+	Name   string
+	Config struct {
+		Image  string
+		Env    []string
+		Labels map[string]string
+	}
+	NetworkSettings struct {
+		Ports map[string][]struct {
+			HostIp   string
+			HostPort string
+		}
+		Networks map[string]struct {
+			IPAddress string
+		}
+	}
+}
+
+func (d *Docker) targets(ctx context.Context) ([]*utils.Target, error) {
+	var containers []struct {
+		Id     string
+		Image  string
+		Labels map[string]string
+	}
+	if err := d.getJSON(ctx, "/containers/json", &containers); err != nil {
+		return nil, fmt.Errorf("failed to list containers: %w", err)
+	}
+
+	var targets []*utils.Target
+	for _, summary := range containers {
+		if !d.selected(summary.Image, summary.Labels) {
+			continue
+		}
+
+		var container dockerContainer
+		if err := d.getJSON(ctx, "/containers/"+summary.Id+"/json", &container); err != nil {
+			// the container may have been removed since listing
+			d.logger.Debug("skipping container that could not be inspected", zap.String("id", summary.Id), zap.Error(err))
+			continue
+		}
+		target, err := d.target(&container)
+		if err != nil {
+			d.logger.Warn("skipping container", zap.String("name", strings.TrimPrefix(container.Name, "/")), zap.Error(err))
+			continue
+		}
+		targets = append(targets, target)
+	}
+	return targets, nil
+}
+
+func (d *Docker) selected(image string, labels map[string]string) bool {
+	if labels[DockerEnableLabel] == "false" {
+		return false
+	}
+	for name := range labels {
+		if strings.HasPrefix(name, DockerLabelPrefix) {
+			return true
+		}
+	}
+	return slices.ContainsFunc(d.config.Images, func(candidate string) bool {
+		return imageMatches(image, candidate)
+	})
+}
+
+func (d *Docker) target(container *dockerContainer) (*utils.Target, error) {
+	env := make(map[string]string, len(container.Config.Env))
+	for _, entry := range container.Config.Env {
+		name, value, _ := strings.Cut(entry, "=")
+		env[name] = value
+	}
+
+	edition := utils.JavaEdition
+	if imageMatches(container.Config.Image, bedrockImage) {
+		edition = utils.BedrockEdition
+	}
+	if value := firstNonEmpty(container.Config.Labels[DockerEditionLabel], env["EDITION"]); value != "" {
+		value = strings.ToLower(value)
+		if !utils.ValidEdition(value) {
+			return nil, fmt.Errorf("invalid edition '%s'", value)
+		}
+		edition = utils.ServerEdition(value)
+	}
+
+	port := utils.DefaultPort(edition)
+	if value := firstNonEmpty(container.Config.Labels[DockerPortLabel], env["SERVER_PORT"]); value != "" {
+		parsed, err := strconv.ParseUint(value, 10, 16)
+		if err != nil || parsed == 0 {
+			return nil, fmt.Errorf("invalid port '%s'", value)
+		}
+		port = uint16(parsed)
+	}
+
+	host, port, err := d.address(container, edition, port)
+	if err != nil {
+		return nil, err
+	}
+	target := &utils.Target{
+		Edition: edition,
+		Host:    host,
+		Port:    port,
+		// containers are addressed directly, so there is no SRV record to look up
+		ExplicitPort: true,
+	}
+	addLabels(target, container.Config.Labels, d.config.Labels, d.logger)
+	return target, nil
+}
+
+// address returns the address of the container on the configured network or else the published port of the server,
+// or else the address of the container on its first network
+func (d *Docker) address(container *dockerContainer, edition utils.ServerEdition, port uint16) (string, uint16, error) {
+	networks := container.NetworkSettings.Networks
+	if d.config.Network != "" {
+		network, exists := networks[d.config.Network]
+		if !exists || network.IPAddress == "" {
+			return "", 0, fmt.Errorf("not attached to network '%s'", d.config.Network)
+		}
+		return network.IPAddress, port, nil
+	}
+
+	protocol := "tcp"
+	if edition == utils.BedrockEdition {
+		protocol = "udp"
+	}
+	for _, binding := range container.NetworkSettings.Ports[fmt.Sprintf("%d/%s", port, protocol)] {
+		published, err := strconv.ParseUint(binding.HostPort, 10, 16)
+		if err != nil {
+			continue
+		}
+		host := binding.HostIp
+		if host == "" || net.ParseIP(host).IsUnspecified() {
+			host = d.config.PublishedHost
+		}
+		return host, uint16(published), nil
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(networks)) {
+		if address := networks[name].IPAddress; address != "" {
+			return address, port, nil
+		}
+	}
+	return "", 0, fmt.Errorf("port %d/%s is not published and there is no network address", port, protocol)
+}
+
+func (d *Docker) get(ctx context.Context, path string) (io.ReadCloser, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, d.baseURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := d.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		_ = response.Body.Close()
+		return nil, fmt.Errorf("unexpected status from Docker API: %s", response.Status)
+	}
+	return response.Body, nil
+}
+
+func (d *Docker) getJSON(ctx context.Context, path string, value any) error {
+	body, err := d.get(ctx, path)
+	if err != nil {
+		return err
+	}
+	//goland:noinspection GoUnhandledErrorResult
+	defer body.Close()
+	return json.NewDecoder(body).Decode(value)
+}
+
+// imageMatches indicates if the image of a container is the candidate, where the tag is only compared when
+// the candidate has one and the default registry is ignored
+func imageMatches(image string, candidate string) bool {
+	image, _, _ = strings.Cut(image, "@")
+	repository, tag := splitImage(image)
+	candidateRepository, candidateTag := splitImage(candidate)
+	return repository == candidateRepository && (candidateTag == "" || tag == candidateTag)
+}
+
+// splitImage returns the repository, without the default registry, and the tag of an image reference
+func splitImage(image string) (string, string) {
+	image = strings.TrimPrefix(strings.TrimPrefix(image, "docker.io/"), "library/")
+	if colon := strings.LastIndex(image, ":"); colon > strings.LastIndex(image, "/") {
+		return image[:colon], image[colon+1:]
+	}
+	return image, ""
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
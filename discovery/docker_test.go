@@ -0,0 +1,125 @@
+package discovery
+
+import (
+	"testing"
+
+	"github.com/itzg/mc-monitor/discovery/dockertest"
+	"github.com/itzg/mc-monitor/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestDockerContainers(t *testing.T) {
+	server := dockertest.NewServer()
+	t.Cleanup(server.Close)
+	server.Start(dockertest.Container{
+		ID:    "a1",
+		Name:  "survival",
+		Image: "itzg/minecraft-server:java21",
+		Labels: map[string]string{
+			"com.docker.compose.project": "games",
+			"com.docker.compose.service": "survival",
+			"com.docker.compose.version": "2.29.1",
+		},
+		Env:      []string{"EULA=TRUE", "SERVER_PORT=25566"},
+		Ports:    []dockertest.Port{{ContainerPort: 25566, HostIP: "0.0.0.0", HostPort: 25570}},
+		Networks: map[string]string{"games_default": "172.18.0.2"},
+	})
+	server.Start(dockertest.Container{
+		ID:       "b2",
+		Name:     "pocket",
+		Image:    "itzg/minecraft-bedrock-server",
+		Networks: map[string]string{"games_default": "172.18.0.3"},
+	})
+	// not a server, so not discovered
+	server.Start(dockertest.Container{ID: "c3", Name: "web", Image: "nginx"})
+
+	discoverer, err := NewDocker(DockerConfig{
+		Endpoint:      server.Endpoint(),
+		Images:        []string{"itzg/minecraft-server", "itzg/minecraft-bedrock-server"},
+		PublishedHost: "localhost",
+		Labels:        []string{"com.docker.compose.project", "com.docker.compose.service"},
+	}, zap.NewNop())
+	require.NoError(t, err)
+	updates := runDiscoverer(t, discoverer)
+
+	targets := receiveTargets(t, updates)
+	require.Len(t, targets, 2)
+	assert.Equal(t, &utils.Target{
+		Edition:      utils.BedrockEdition,
+		Host:         "172.18.0.3",
+		Port:         19132,
+		ExplicitPort: true,
+	}, targets[0])
+	assert.Equal(t, &utils.Target{
+		Edition:      utils.JavaEdition,
+		Host:         "localhost",
+		Port:         25570,
+		ExplicitPort: true,
+		Labels:       map[string]string{"com_docker_compose_project": "games", "com_docker_compose_service": "survival"},
+	}, targets[1])
+
+	server.Start(dockertest.Container{
+		ID:     "d4",
+		Name:   "custom",
+		Image:  "example/bedrock-proxy",
+		Labels: map[string]string{DockerPortLabel: "19133"},
+		Env:    []string{"EDITION=BEDROCK"},
+		Ports:  []dockertest.Port{{ContainerPort: 19133, Protocol: "udp", HostIP: "192.168.1.10", HostPort: 19133}},
+	})
+	targets = receiveTargets(t, updates)
+	assert.Equal(t, []string{
+		"bedrock://172.18.0.3:19132",
+		"bedrock://192.168.1.10:19133",
+		"java://localhost:25570?label.com_docker_compose_project=games&label.com_docker_compose_service=survival",
+	}, targetKeys(targets))
+
+	server.Stop("a1")
+	targets = receiveTargets(t, updates)
+	assert.Equal(t, []string{"bedrock://172.18.0.3:19132", "bedrock://192.168.1.10:19133"}, targetKeys(targets))
+}
+
+func TestDockerNetwork(t *testing.T) {
+	server := dockertest.NewServer()
+	t.Cleanup(server.Close)
+	server.Start(dockertest.Container{
+		ID:       "a1",
+		Name:     "survival",
+		Image:    "itzg/minecraft-server",
+		Ports:    []dockertest.Port{{ContainerPort: 25565, HostPort: 25565}},
+		Networks: map[string]string{"bridge": "172.17.0.2", "monitoring": "172.20.0.2"},
+	})
+	server.Start(dockertest.Container{
+		ID:     "b2",
+		Name:   "excluded",
+		Image:  "itzg/minecraft-server",
+		Labels: map[string]string{DockerEnableLabel: "false"},
+	})
+
+	discoverer, err := NewDocker(DockerConfig{
+		Endpoint: server.Endpoint(),
+		Images:   []string{"itzg/minecraft-server"},
+		Network:  "monitoring",
+	}, zap.NewNop())
+	require.NoError(t, err)
+	updates := runDiscoverer(t, discoverer)
+
+	targets := receiveTargets(t, updates)
+	assert.Equal(t, []string{"java://172.20.0.2:25565"}, targetKeys(targets))
+}
+
+func TestNewDockerRejectsInvalidEndpoint(t *testing.T) {
+	_, err := NewDocker(DockerConfig{Endpoint: "npipe:////./pipe/docker_engine"}, zap.NewNop())
+	assert.ErrorContains(t, err, "invalid Docker endpoint")
+}
+
+func TestImageMatches(t *testing.T) {
+	assert.True(t, imageMatches("itzg/minecraft-server", "itzg/minecraft-server"))
+	assert.True(t, imageMatches("itzg/minecraft-server:java21", "itzg/minecraft-server"))
+	assert.True(t, imageMatches("docker.io/itzg/minecraft-server:latest@sha256:abc", "itzg/minecraft-server:latest"))
+	assert.True(t, imageMatches("localhost:5000/minecraft", "localhost:5000/minecraft"))
+	assert.False(t, imageMatches("itzg/minecraft-server:java8", "itzg/minecraft-server:java21"))
+	assert.False(t, imageMatches("itzg/minecraft-server", "itzg/minecraft-bedrock-server"))
+	assert.False(t, imageMatches("localhost:5000/minecraft", "localhost"))
+}
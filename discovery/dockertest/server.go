@@ -0,0 +1,223 @@
+// Package dockertest provides an in-process stand-in for the Docker API listening on a Unix socket, similar to httptest
+package dockertest
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Port is a port exposed by a container, which is published when HostPort is not zero
+type Port struct {
+	ContainerPort uint16
+	// Protocol is tcp or udp, where tcp is used when empty
+	Protocol string
+	HostIP   string
+	HostPort uint16
+}
+
+// Container is a running container served by the stand-in
+type Container struct {
+	ID     string
+	Name   string
+	Image  string
+	Labels map[string]string
+	Env    []string
+	Ports  []Port
+	// Networks maps the names of networks to the IP address of the container on them
+	Networks map[string]string
+}
+
+// Server serves the containers, inspection, and events endpoints of the Docker API
+type Server struct {
+	dir    string
+	server *http.Server
+	wg     sync.WaitGroup
+
+	mu          sync.Mutex
+	containers  map[string]Container
+	subscribers map[chan string]struct{}
+}
+
+// NewServer starts a server without any containers
+func NewServer() *Server {
+	// the path of a Unix socket is limited in length, so it is kept short
+	dir, err := os.MkdirTemp("", "dockertest")
+	if err != nil {
+		panic("dockertest: failed to create directory: " + err.Error())
+	}
+	listener, err := net.Listen("unix", filepath.Join(dir, "docker.sock"))
+	if err != nil {
+		panic("dockertest: failed to listen: " + err.Error())
+	}
+
+	s := &Server{
+		dir:         dir,
+		containers:  make(map[string]Container),
+		subscribers: make(map[chan string]struct{}),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /containers/json", s.handleList)
+	mux.HandleFunc("GET /containers/{id}/json", s.handleInspect)
+	mux.HandleFunc("GET /events", s.handleEvents)
+	s.server = &http.Server{Handler: mux}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		_ = s.server.Serve(listener)
+	}()
+	return s
+}
+
+// Endpoint returns the unix:// address of the server
+func (s *Server) Endpoint() string {
+	return "unix://" + filepath.Join(s.dir, "docker.sock")
+}
+
+// Start adds the running container and sends its start event
+func (s *Server) Start(container Container) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.containers[container.ID] = container
+	s.publish("start", container)
+}
+
+// Stop removes the container and sends its die event
+func (s *Server) Stop(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	container, exists := s.containers[id]
+	if !exists {
+		return
+	}
+	delete(s.containers, id)
+	s.publish("die", container)
+}
+
+// Close stops the server, including any streams of events
+func (s *Server) Close() {
+	_ = s.server.Close()
+	s.wg.Wait()
+	_ = os.RemoveAll(s.dir)
+}
+
+// publish sends an event to the subscribers, where the lock must be held
+func (s *Server) publish(action string, container Container) {
+	event, _ := json.Marshal(map[string]any{
+		"Type":   "container",
+		"Action": action,
+		"Actor": map[string]any{
+			"ID":         container.ID,
+			"Attributes": map[string]string{"image": container.Image, "name": container.Name},
+		},
+		"time": time.Now().Unix(),
+	})
+	for subscriber := range s.subscribers {
+		subscriber <- string(event)
+	}
+}
+
+func (s *Server) handleList(w http.ResponseWriter, _ *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	summaries := make([]map[string]any, 0, len(s.containers))
+	for _, id := range slices.Sorted(maps.Keys(s.containers)) {
+		container := s.containers[id]
+		summaries = append(summaries, map[string]any{
+			"Id":     container.ID,
+			"Names":  []string{"/" + container.Name},
+			"Image":  container.Image,
+			"Labels": container.Labels,
+			"State":  "running",
+		})
+	}
+	writeJSON(w, http.StatusOK, summaries)
+}
+
+func (s *Server) handleInspect(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	container, exists := s.containers[r.PathValue("id")]
+	s.mu.Unlock()
+	if !exists {
+		writeJSON(w, http.StatusNotFound, map[string]string{"message": "No such container: " + r.PathValue("id")})
+		return
+	}
+
+	ports := make(map[string][]map[string]string)
+	for _, port := range container.Ports {
+		protocol := port.Protocol
+		if protocol == "" {
+			protocol = "tcp"
+		}
+		key := fmt.Sprintf("%d/%s", port.ContainerPort, protocol)
+		if port.HostPort == 0 {
+			ports[key] = nil
+			continue
+		}
+		ports[key] = append(ports[key], map[string]string{
+			"HostIp":   port.HostIP,
+			"HostPort": fmt.Sprint(port.HostPort),
+		})
+	}
+	networks := make(map[string]map[string]string)
+	for name, address := range container.Networks {
+		networks[name] = map[string]string{"IPAddress": address}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"Id":   container.ID,
+		"Name": "/" + container.Name,
+		"Config": map[string]any{
+			"Image":  container.Image,
+			"Env":    container.Env,
+			"Labels": container.Labels,
+		},
+		"NetworkSettings": map[string]any{
+			"Ports":    ports,
+			"Networks": networks,
+		},
+	})
+}
+
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	// buffered so that publishing while holding the lock doesn't wait on slow subscribers
+	events := make(chan string, 16)
+	s.mu.Lock()
+	s.subscribers[events] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.subscribers, events)
+		s.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.(http.Flusher).Flush()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event := <-events:
+			if _, err := fmt.Fprintln(w, event); err != nil {
+				return
+			}
+			w.(http.Flusher).Flush()
+		}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(value)
+}
@@ -0,0 +1,180 @@
+package discovery
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/itzg/mc-monitor/utils"
+	"go.uber.org/zap"
+	"go.yaml.in/yaml/v3"
+)
+
+// FileSDEditionLabel is the label of a file_sd group whose value, java or bedrock, is the edition of its targets
+const FileSDEditionLabel = "edition"
+
+// fileSDInterval is how often FileSD checks if the files have changed
+var fileSDInterval = 5 * time.Second
+
+// FileSDConfig declares the discovery of servers from files in the format of Prometheus file_sd
+type FileSDConfig struct {
+	Files []string `usage:"paths of Prometheus file_sd JSON or YAML files declaring servers and their labels, which may be patterns such as /etc/mc-monitor/*.json"`
+}
+
+// NewDiscoverer creates the discoverer when files are given, otherwise it returns nil
+func (c *FileSDConfig) NewDiscoverer(logger *zap.Logger) (Discoverer, error) {
+	if len(c.Files) == 0 {
+		return nil, nil
+	}
+	return NewFileSD(c.Files, logger)
+}
+
+// FileSD discovers servers from the groups of files in the format of Prometheus file_sd, such as
+//
+//	[{"targets": ["mc.example.com:25565"], "labels": {"env": "prod", "edition": "java"}}]
+//
+// where the edition label declares the edition of the targets in the group and labels starting with __ are
+// ignored, like Prometheus does. The targets may also be java:// or bedrock:// URIs. The files are checked
+// for changes periodically, where a file with problems keeps its previous targets.
+type FileSD struct {
+	patterns []string
+	logger   *zap.Logger
+	// files holds the last content read from each file and its targets
+	files map[string]*fileSDFile
+}
+
+type fileSDFile struct {
+	content []byte
+	targets []*utils.Target
+}
+
+func NewFileSD(patterns []string, logger *zap.Logger) (*FileSD, error) {
+	for _, pattern := range patterns {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid file_sd path '%s': %w", pattern, err)
+		}
+	}
+	return &FileSD{
+		patterns: patterns,
+		logger:   logger.Named("file_sd"),
+		files:    make(map[string]*fileSDFile),
+	}, nil
+}
+
+func (f *FileSD) Name() string {
+	return "file_sd"
+}
+
+func (f *FileSD) Run(ctx context.Context, updates chan<- []*utils.Target) error {
+	ticker := time.NewTicker(fileSDInterval)
+	defer ticker.Stop()
+
+	publisher := publisher{updates: updates}
+	for {
+		if !publisher.publish(ctx, f.refresh()) {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// refresh reads the files that currently match the patterns and returns their targets, where files
+// that no longer match are dropped
+func (f *FileSD) refresh() []*utils.Target {
+	paths := make(map[string]struct{})
+	for _, pattern := range f.patterns {
+		// the patterns were validated, so there are no errors
+		matches, _ := filepath.Glob(pattern)
+		for _, path := range matches {
+			paths[path] = struct{}{}
+		}
+	}
+
+	files := make(map[string]*fileSDFile, len(paths))
+	var targets []*utils.Target
+	for _, path := range slices.Sorted(maps.Keys(paths)) {
+		file := f.read(path)
+		if file != nil {
+			files[path] = file
+			targets = append(targets, file.targets...)
+		}
+	}
+	f.files = files
+	return targets
+}
+
+// read returns the file with its targets parsed again when its content changed, or else the previous version of
+// the file, which is nil when there isn't one
+func (f *FileSD) read(path string) *fileSDFile {
+	previous := f.files[path]
+	content, err := os.ReadFile(path)
+	if err != nil {
+		f.logger.Error("failed to read file", zap.String("path", path), zap.Error(err))
+		return previous
+	}
+	if previous != nil && bytes.Equal(content, previous.content) {
+		return previous
+	}
+
+	targets, err := ParseFileSD(content)
+	if err != nil {
+		f.logger.Error("file is invalid, keeping its current targets", zap.String("path", path), zap.Error(err))
+		// the content is remembered so that the problem is only logged once per change
+		if previous == nil {
+			return &fileSDFile{content: content}
+		}
+		return &fileSDFile{content: content, targets: previous.targets}
+	}
+	f.logger.Debug("loaded file", zap.String("path", path), zap.Int("count", len(targets)))
+	return &fileSDFile{content: content, targets: targets}
+}
+
+// ParseFileSD parses the groups of targets and labels of a Prometheus file_sd file given as JSON or YAML
+func ParseFileSD(content []byte) ([]*utils.Target, error) {
+	var groups []struct {
+		Targets []string          `yaml:"targets"`
+		Labels  map[string]string `yaml:"labels"`
+	}
+	if err := yaml.Unmarshal(content, &groups); err != nil {
+		return nil, err
+	}
+
+	var targets []*utils.Target
+	for i, group := range groups {
+		edition := utils.JavaEdition
+		if value, exists := group.Labels[FileSDEditionLabel]; exists {
+			if !utils.ValidEdition(value) {
+				return nil, fmt.Errorf("group %d: invalid edition '%s'", i+1, value)
+			}
+			edition = utils.ServerEdition(value)
+		}
+
+		for _, value := range group.Targets {
+			target, err := utils.ParseTarget(value, edition)
+			if err != nil {
+				return nil, fmt.Errorf("group %d: invalid target '%s': %w", i+1, value, err)
+			}
+			for _, name := range slices.Sorted(maps.Keys(group.Labels)) {
+				if name == FileSDEditionLabel || strings.HasPrefix(name, "__") {
+					continue
+				}
+				if err := target.SetOption("label."+name, group.Labels[name]); err != nil {
+					return nil, fmt.Errorf("group %d: %w", i+1, err)
+				}
+			}
+			targets = append(targets, target)
+		}
+	}
+	return targets, nil
+}
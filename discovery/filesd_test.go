@@ -0,0 +1,96 @@
+package discovery
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/itzg/mc-monitor/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestFileSD(t *testing.T) {
+	fileSDInterval = 10 * time.Millisecond
+	t.Cleanup(func() { fileSDInterval = 5 * time.Second })
+
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "java.json"), `[
+  {"targets": ["mc.example.com:25566", "lobby.example.com"], "labels": {"env": "prod", "__meta_source": "inventory"}}
+]`)
+	writeFile(t, filepath.Join(dir, "bedrock.yml"), `
+- targets: [bedrock.example.com]
+  labels:
+    edition: bedrock
+`)
+	// not matched by the patterns
+	writeFile(t, filepath.Join(dir, "notes.txt"), "not a file_sd file")
+
+	discoverer, err := NewFileSD([]string{filepath.Join(dir, "*.json"), filepath.Join(dir, "*.yml")}, zap.NewNop())
+	require.NoError(t, err)
+	updates := runDiscoverer(t, discoverer)
+
+	targets := receiveTargets(t, updates)
+	require.Len(t, targets, 3)
+	assert.Equal(t, &utils.Target{
+		Edition: utils.BedrockEdition,
+		Host:    "bedrock.example.com",
+		Port:    19132,
+	}, targets[0])
+	assert.Equal(t, []string{
+		"bedrock://bedrock.example.com",
+		"java://lobby.example.com?label.env=prod",
+		"java://mc.example.com:25566?label.env=prod",
+	}, targetKeys(targets))
+
+	// an invalid file keeps its targets until it is fixed
+	writeFile(t, filepath.Join(dir, "java.json"), `[{"targets": ["java://mc.example.com?timeout=soon"]}]`)
+	writeFile(t, filepath.Join(dir, "more.json"), `[{"targets": ["java://survival.example.com?slp=legacy"]}]`)
+	targets = receiveTargets(t, updates)
+	assert.Equal(t, []string{
+		"bedrock://bedrock.example.com",
+		"java://lobby.example.com?label.env=prod",
+		"java://mc.example.com:25566?label.env=prod",
+		"java://survival.example.com?slp=legacy",
+	}, targetKeys(targets))
+
+	require.NoError(t, os.Remove(filepath.Join(dir, "bedrock.yml")))
+	writeFile(t, filepath.Join(dir, "java.json"), `[{"targets": ["mc.example.com"]}]`)
+	targets = receiveTargets(t, updates)
+	if len(targets) != 2 {
+		// the removal and the change may be seen separately
+		targets = receiveTargets(t, updates)
+	}
+	assert.Equal(t, []string{"java://mc.example.com", "java://survival.example.com?slp=legacy"}, targetKeys(targets))
+}
+
+func TestParseFileSD(t *testing.T) {
+	targets, err := ParseFileSD([]byte(`[{"targets": ["bedrock://pocket.example.com:19133", "play.example.com"], "labels": {"team": "builders"}}]`))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"bedrock://pocket.example.com:19133?label.team=builders", "java://play.example.com?label.team=builders"},
+		targetKeys(targets))
+
+	targets, err = ParseFileSD(nil)
+	require.NoError(t, err)
+	assert.Empty(t, targets)
+
+	_, err = ParseFileSD([]byte(`[{"targets": ["mc.example.com"], "labels": {"edition": "pocket"}}]`))
+	assert.EqualError(t, err, "group 1: invalid edition 'pocket'")
+
+	_, err = ParseFileSD([]byte(`[{"targets": ["mc.example.com"]}, {"targets": ["mc.example.com"], "labels": {"server-name": "lobby"}}]`))
+	assert.EqualError(t, err, "group 2: invalid label name 'server-name'")
+
+	_, err = ParseFileSD([]byte(`{"targets": ["mc.example.com"]}`))
+	assert.Error(t, err)
+}
+
+func TestNewFileSDRejectsInvalidPattern(t *testing.T) {
+	_, err := NewFileSD([]string{"/etc/mc-monitor/[.json"}, zap.NewNop())
+	assert.ErrorContains(t, err, "invalid file_sd path")
+}
+
+func writeFile(t *testing.T, path string, content string) {
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+}
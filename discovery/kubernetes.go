@@ -0,0 +1,302 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/itzg/mc-monitor/utils"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// Annotations of Services and Pods that are read by the Kubernetes discovery
+const (
+	KubernetesAnnotationPrefix = "mc-monitor.itzg.me/"
+	// EditionAnnotation is java or bedrock, where java is the default
+	EditionAnnotation = KubernetesAnnotationPrefix + "edition"
+	// PortAnnotation is the number or name of the port of the server
+	PortAnnotation = KubernetesAnnotationPrefix + "port"
+)
+
+// Kinds of resources accepted by KubernetesConfig.Resource
+const (
+	KubernetesServices = "service"
+	KubernetesPods     = "pod"
+)
+
+// minecraftPortName is the name of the port used when no port is annotated, which is the name used by
+// the Helm charts of itzg/minecraft-server and itzg/minecraft-bedrock-server
+const minecraftPortName = "minecraft"
+
+// KubernetesConfig declares the discovery of servers from the Services or Pods of Kubernetes
+type KubernetesConfig struct {
+	Enabled       bool     `usage:"discovers servers from the Services or Pods of Kubernetes"`
+	Resource      string   `default:"service" usage:"kind of resource to discover: service or pod"`
+	Namespace     string   `usage:"namespace to discover within, where empty discovers within all namespaces"`
+	LabelSelector string   `usage:"label selector of the resources to discover, such as app=minecraft. When empty, resources with an mc-monitor.itzg.me annotation are discovered"`
+	Labels        []string `default:"*" override-value:"true" usage:"Kubernetes labels added to the metrics of discovered servers, where * adds all of them. Names are converted into valid label names, such as app.kubernetes.io/name into app_kubernetes_io_name"`
+	Kubeconfig    string   `usage:"path of a kubeconfig file, where empty uses the in-cluster configuration"`
+}
+
+// NewDiscoverer creates the discoverer when enabled, otherwise it returns nil
+func (c *KubernetesConfig) NewDiscoverer(logger *zap.Logger) (Discoverer, error) {
+	if !c.Enabled {
+		return nil, nil
+	}
+
+	var restConfig *rest.Config
+	var err error
+	if c.Kubeconfig != "" {
+		restConfig, err = clientcmd.BuildConfigFromFlags("", c.Kubeconfig)
+	} else {
+		restConfig, err = rest.InClusterConfig()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load Kubernetes client configuration: %w", err)
+	}
+	client, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Kubernetes client: %w", err)
+	}
+	return NewKubernetes(client, *c, logger)
+}
+
+// Kubernetes discovers servers from the Services or Pods that match the label selector or, without a selector,
+// that have an mc-monitor.itzg.me annotation. Services are monitored at their cluster DNS name and Pods
+// at their IP address, where the port is the annotated one, the one named minecraft, the first one using the
+// protocol of the edition, or else the default port of the edition.
+type Kubernetes struct {
+	client   kubernetes.Interface
+	config   KubernetesConfig
+	selector labels.Selector
+	logger   *zap.Logger
+}
+
+func NewKubernetes(client kubernetes.Interface, config KubernetesConfig, logger *zap.Logger) (*Kubernetes, error) {
+	if config.Resource != KubernetesServices && config.Resource != KubernetesPods {
+		return nil, fmt.Errorf("invalid Kubernetes resource '%s', must be %s or %s",
+			config.Resource, KubernetesServices, KubernetesPods)
+	}
+	selector, err := labels.Parse(config.LabelSelector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Kubernetes label selector: %w", err)
+	}
+	return &Kubernetes{
+		client:   client,
+		config:   config,
+		selector: selector,
+		logger:   logger.Named("kubernetes"),
+	}, nil
+}
+
+func (k *Kubernetes) Name() string {
+	return "kubernetes"
+}
+
+func (k *Kubernetes) Run(ctx context.Context, updates chan<- []*utils.Target) error {
+	factory := informers.NewSharedInformerFactoryWithOptions(k.client, 0,
+		informers.WithNamespace(k.config.Namespace),
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.LabelSelector = k.config.LabelSelector
+		}),
+	)
+
+	var informer cache.SharedIndexInformer
+	var list func() ([]*utils.Target, error)
+	if k.config.Resource == KubernetesPods {
+		pods := factory.Core().V1().Pods()
+		informer = pods.Informer()
+		list = func() ([]*utils.Target, error) {
+			resources, err := pods.Lister().List(labels.Everything())
+			if err != nil {
+				return nil, err
+			}
+			return k.podTargets(resources), nil
+		}
+	} else {
+		services := factory.Core().V1().Services()
+		informer = services.Informer()
+		list = func() ([]*utils.Target, error) {
+			resources, err := services.Lister().List(labels.Everything())
+			if err != nil {
+				return nil, err
+			}
+			return k.serviceTargets(resources), nil
+		}
+	}
+
+	// events only signal that the targets need to be listed again, so they are coalesced
+	changed := make(chan struct{}, 1)
+	notify := func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	}
+	_, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(any) { notify() },
+		UpdateFunc: func(any, any) { notify() },
+		DeleteFunc: func(any) { notify() },
+	})
+	if err != nil {
+		return fmt.Errorf("failed to watch Kubernetes %ss: %w", k.config.Resource, err)
+	}
+
+	factory.Start(ctx.Done())
+	defer factory.Shutdown()
+	if !cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+		return errors.New("failed to sync Kubernetes resources")
+	}
+	// the initial list is sent even when empty
+	notify()
+
+	publisher := publisher{updates: updates}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-changed:
+		}
+
+		targets, err := list()
+		if err != nil {
+			k.logger.Error("failed to list resources", zap.Error(err))
+			continue
+		}
+		if !publisher.publish(ctx, targets) {
+			return nil
+		}
+	}
+}
+
+func (k *Kubernetes) serviceTargets(services []*corev1.Service) []*utils.Target {
+	targets := make([]*utils.Target, 0, len(services))
+	for _, service := range services {
+		if !k.selected(service.ObjectMeta) {
+			continue
+		}
+		var ports []namedPort
+		for _, port := range service.Spec.Ports {
+			ports = append(ports, namedPort{name: port.Name, port: port.Port, protocol: port.Protocol})
+		}
+		host := service.Name + "." + service.Namespace + ".svc"
+		target, err := k.target(service.ObjectMeta, host, ports)
+		if err != nil {
+			k.logger.Warn("skipping service", zap.String("namespace", service.Namespace),
+				zap.String("name", service.Name), zap.Error(err))
+			continue
+		}
+		targets = append(targets, target)
+	}
+	return targets
+}
+
+func (k *Kubernetes) podTargets(pods []*corev1.Pod) []*utils.Target {
+	targets := make([]*utils.Target, 0, len(pods))
+	for _, pod := range pods {
+		if !k.selected(pod.ObjectMeta) || pod.Status.Phase != corev1.PodRunning || pod.Status.PodIP == "" {
+			continue
+		}
+		var ports []namedPort
+		for _, container := range pod.Spec.Containers {
+			for _, port := range container.Ports {
+				ports = append(ports, namedPort{name: port.Name, port: port.ContainerPort, protocol: port.Protocol})
+			}
+		}
+		target, err := k.target(pod.ObjectMeta, pod.Status.PodIP, ports)
+		if err != nil {
+			k.logger.Warn("skipping pod", zap.String("namespace", pod.Namespace),
+				zap.String("name", pod.Name), zap.Error(err))
+			continue
+		}
+		targets = append(targets, target)
+	}
+	return targets
+}
+
+// selected indicates if the resource is discovered, where the informer has already applied the label selector
+func (k *Kubernetes) selected(meta metav1.ObjectMeta) bool {
+	if !k.selector.Empty() {
+		return true
+	}
+	for name := range meta.Annotations {
+		if strings.HasPrefix(name, KubernetesAnnotationPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+type namedPort struct {
+	name     string
+	port     int32
+	protocol corev1.Protocol
+}
+
+func (k *Kubernetes) target(meta metav1.ObjectMeta, host string, ports []namedPort) (*utils.Target, error) {
+	edition := utils.JavaEdition
+	if value, exists := meta.Annotations[EditionAnnotation]; exists {
+		if !utils.ValidEdition(value) {
+			return nil, fmt.Errorf("invalid edition '%s'", value)
+		}
+		edition = utils.ServerEdition(value)
+	}
+
+	port, err := selectPort(meta.Annotations[PortAnnotation], edition, ports)
+	if err != nil {
+		return nil, err
+	}
+
+	target := &utils.Target{
+		Edition: edition,
+		Host:    host,
+		Port:    port,
+		// resources are addressed directly, so there is no SRV record to look up
+		ExplicitPort: true,
+	}
+	addLabels(target, meta.Labels, k.config.Labels, k.logger)
+	return target, nil
+}
+
+// selectPort returns the annotated port, given by number or name, the port named minecraft, the first port
+// using the protocol of the edition, or else the default port of the edition
+func selectPort(annotated string, edition utils.ServerEdition, ports []namedPort) (uint16, error) {
+	if annotated != "" {
+		if number, err := strconv.ParseUint(annotated, 10, 16); err == nil && number > 0 {
+			return uint16(number), nil
+		}
+		for _, port := range ports {
+			if port.name == annotated {
+				return uint16(port.port), nil
+			}
+		}
+		return 0, fmt.Errorf("no port '%s'", annotated)
+	}
+
+	for _, port := range ports {
+		if port.name == minecraftPortName {
+			return uint16(port.port), nil
+		}
+	}
+	protocol := corev1.ProtocolTCP
+	if edition == utils.BedrockEdition {
+		protocol = corev1.ProtocolUDP
+	}
+	for _, port := range ports {
+		// the protocol defaults to TCP when not given
+		if port.protocol == protocol || (port.protocol == "" && protocol == corev1.ProtocolTCP) {
+			return uint16(port.port), nil
+		}
+	}
+	return utils.DefaultPort(edition), nil
+}
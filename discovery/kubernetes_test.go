@@ -0,0 +1,160 @@
+package discovery
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/itzg/mc-monitor/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestKubernetesServices(t *testing.T) {
+	client := fake.NewClientset(
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "survival",
+				Namespace:   "games",
+				Labels:      map[string]string{"app.kubernetes.io/name": "minecraft", "team": "builders"},
+				Annotations: map[string]string{PortAnnotation: "25566"},
+			},
+		},
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        "pocket",
+				Namespace:   "games",
+				Annotations: map[string]string{EditionAnnotation: "bedrock"},
+			},
+			Spec: corev1.ServiceSpec{Ports: []corev1.ServicePort{
+				{Name: "rcon", Port: 25575, Protocol: corev1.ProtocolTCP},
+				{Name: "game", Port: 19133, Protocol: corev1.ProtocolUDP},
+			}},
+		},
+		// not annotated, so not discovered without a label selector
+		&corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "games"}},
+	)
+
+	discoverer, err := NewKubernetes(client, KubernetesConfig{Resource: KubernetesServices, Labels: []string{"*"}}, zap.NewNop())
+	require.NoError(t, err)
+	updates := runDiscoverer(t, discoverer)
+
+	targets := receiveTargets(t, updates)
+	require.Len(t, targets, 2)
+	assert.Equal(t, &utils.Target{
+		Edition:      utils.BedrockEdition,
+		Host:         "pocket.games.svc",
+		Port:         19133,
+		ExplicitPort: true,
+	}, targets[0])
+	assert.Equal(t, &utils.Target{
+		Edition:      utils.JavaEdition,
+		Host:         "survival.games.svc",
+		Port:         25566,
+		ExplicitPort: true,
+		Labels:       map[string]string{"app_kubernetes_io_name": "minecraft", "team": "builders"},
+	}, targets[1])
+
+	_, err = client.CoreV1().Services("games").Create(context.Background(), &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "creative",
+			Namespace:   "games",
+			Annotations: map[string]string{PortAnnotation: "minecraft"},
+		},
+		Spec: corev1.ServiceSpec{Ports: []corev1.ServicePort{{Name: "minecraft", Port: 25567}}},
+	}, metav1.CreateOptions{})
+	require.NoError(t, err)
+	targets = receiveTargets(t, updates)
+	require.Len(t, targets, 3)
+	assert.Equal(t, "java://creative.games.svc:25567", targets[1].Key())
+
+	err = client.CoreV1().Services("games").Delete(context.Background(), "survival", metav1.DeleteOptions{})
+	require.NoError(t, err)
+	targets = receiveTargets(t, updates)
+	assert.Equal(t, []string{"bedrock://pocket.games.svc:19133", "java://creative.games.svc:25567"}, targetKeys(targets))
+}
+
+func TestKubernetesPodsWithLabelSelector(t *testing.T) {
+	runningPod := func(name string, ip string, labels map[string]string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "games", Labels: labels},
+			Spec: corev1.PodSpec{Containers: []corev1.Container{{
+				Name:  "server",
+				Ports: []corev1.ContainerPort{{Name: "metrics", ContainerPort: 9225}, {Name: "minecraft", ContainerPort: 25565}},
+			}}},
+			Status: corev1.PodStatus{Phase: corev1.PodRunning, PodIP: ip},
+		}
+	}
+	pending := runningPod("pending", "", map[string]string{"app": "minecraft"})
+	pending.Status.Phase = corev1.PodPending
+	client := fake.NewClientset(
+		runningPod("lobby-0", "10.0.0.5", map[string]string{"app": "minecraft", "pod-template-hash": "abc"}),
+		runningPod("proxy-0", "10.0.0.6", map[string]string{"app": "proxy"}),
+		pending,
+	)
+
+	discoverer, err := NewKubernetes(client, KubernetesConfig{
+		Resource:      KubernetesPods,
+		LabelSelector: "app=minecraft",
+		Labels:        []string{"app"},
+	}, zap.NewNop())
+	require.NoError(t, err)
+	updates := runDiscoverer(t, discoverer)
+
+	targets := receiveTargets(t, updates)
+	assert.Equal(t, []string{"java://10.0.0.5:25565?label.app=minecraft"}, targetKeys(targets))
+}
+
+func TestNewKubernetesRejectsInvalidConfig(t *testing.T) {
+	_, err := NewKubernetes(fake.NewClientset(), KubernetesConfig{Resource: "deployment"}, zap.NewNop())
+	assert.ErrorContains(t, err, "invalid Kubernetes resource 'deployment'")
+
+	_, err = NewKubernetes(fake.NewClientset(), KubernetesConfig{Resource: KubernetesServices, LabelSelector: "app in (minecraft"}, zap.NewNop())
+	assert.ErrorContains(t, err, "invalid Kubernetes label selector")
+}
+
+func TestSelectPort(t *testing.T) {
+	ports := []namedPort{
+		{name: "rcon", port: 25575, protocol: corev1.ProtocolTCP},
+		{name: "query", port: 25570, protocol: corev1.ProtocolUDP},
+	}
+
+	port, err := selectPort("", utils.JavaEdition, ports)
+	require.NoError(t, err)
+	assert.Equal(t, uint16(25575), port)
+
+	port, err = selectPort("", utils.BedrockEdition, ports)
+	require.NoError(t, err)
+	assert.Equal(t, uint16(25570), port)
+
+	port, err = selectPort("", utils.BedrockEdition, nil)
+	require.NoError(t, err)
+	assert.Equal(t, utils.DefaultBedrockPort, port)
+
+	_, err = selectPort("game", utils.JavaEdition, ports)
+	assert.EqualError(t, err, "no port 'game'")
+}
+
+func runDiscoverer(t *testing.T, discoverer Discoverer) <-chan []*utils.Target {
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	updates := make(chan []*utils.Target)
+	go func() {
+		assert.NoError(t, discoverer.Run(ctx, updates))
+	}()
+	return updates
+}
+
+func receiveTargets(t *testing.T, updates <-chan []*utils.Target) []*utils.Target {
+	select {
+	case targets := <-updates:
+		return targets
+	case <-time.After(10 * time.Second):
+		t.Fatal("no targets were discovered")
+		return nil
+	}
+}
@@ -6,7 +6,7 @@ import (
 	"strings"
 )
 
-// @deprecated use utils.SplitHostPort instead
+// @deprecated use utils.ParseTarget instead
 func SplitHostPort(hostport string, defaultPort uint16) (string, uint16, error) {
 	parts := strings.SplitN(hostport, ":", 2)
 	if len(parts) == 2 {
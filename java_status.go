@@ -7,38 +7,83 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"net"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/avast/retry-go"
+	"github.com/itzg/mc-monitor/chat"
 	"github.com/itzg/mc-monitor/slp"
+	"github.com/itzg/mc-monitor/utils"
 	"go.uber.org/zap"
 
-	mcpinger "github.com/Raqbit/mc-pinger"
 	"github.com/google/subcommands"
 	"github.com/itzg/go-flagsfiller"
-	"github.com/xrjr/mcutils/pkg/ping"
 )
 
+// Variants of the server list ping
+const (
+	slpVariantModern = "modern"
+	slpVariant16     = slp.LegacyVariant16
+	slpVariant14     = slp.LegacyVariant14
+	slpVariantBeta   = slp.LegacyVariantBeta
+	slpVariantAuto   = slp.LegacyVariantAuto
+)
+
+// loginProbeError is the result of a login probe that could not be classified
+const loginProbeError = "error"
+
 type statusCmd struct {
 	Host string `default:"localhost" usage:"hostname of the Minecraft server" env:"MC_HOST"`
 	Port int    `default:"25565" usage:"port of the Minecraft server" env:"MC_PORT"`
 
-	UseServerListPing    bool `usage:"indicates the legacy, server list ping should be used for pre-1.12"`
-	UseOldServerListPing bool `usage:"indicates older legacy, old server list ping is used for b1.8 to 1.3"`
-	UseMcUtils           bool `usage:"(experimental) try using mcutils to query the server"`
+	UseServerListPing    bool   `usage:"indicates the legacy, server list ping should be used for pre-1.12, same as slp-variant 1.6"`
+	UseOldServerListPing bool   `usage:"indicates older legacy, old server list ping is used for b1.8 to 1.3, same as slp-variant beta"`
+	SlpVariant           string `default:"modern" usage:"variant of server list ping: modern for 1.7 and newer, 1.6, 1.4 for 1.4 to 1.5, beta for b1.8 to 1.3, or auto to try each legacy variant in turn"`
+	UseMcUtils           bool   `usage:"(deprecated) no longer needed since the status ping supports large responses, see max-response-size"`
 
 	RetryInterval time.Duration `usage:"if retry-limit is non-zero, status will be retried at this interval" default:"10s"`
 	RetryLimit    int           `usage:"if non-zero, failed status will be retried this many times before exiting"`
 	Timeout       time.Duration `usage:"the timeout the ping can take as a maximum" default:"15s"`
 
-	UseProxy     bool `usage:"supports contacting Bungeecord when proxy_protocol enabled"`
-	ProxyVersion byte `usage:"version of PROXY protocol to use" default:"1"`
+	ProtocolVersion int    `usage:"protocol version sent in the handshake, such as 765, to check if the server accepts clients of that version"`
+	ClientVersion   string `usage:"release of the client, such as 1.20.4, whose protocol version is sent in the handshake to check if the server accepts it"`
+
+	MaxResponseSize int `usage:"maximum size in bytes of the status response, which may need to be raised for servers with very large mod lists. When zero, 4 MiB is used"`
+
+	SkipSrvLookup bool `usage:"skips resolving the _minecraft._tcp SRV record of the host when the port is not explicitly given"`
+
+	SkipPingPong bool `usage:"skips the ping/pong exchange after the status, which leaves out the ping/pong timing"`
+
+	UseProxy     bool   `usage:"supports contacting Bungeecord when proxy_protocol enabled"`
+	ProxyVersion uint   `usage:"version of PROXY protocol to use" default:"1"`
+	ProxySource  string `usage:"[ip:port] reported as the client address in the PROXY protocol header instead of the local address"`
 
 	SkipReadinessCheck bool `usage:"returns success when pinging a server without player info, or with a max player count of 0"`
 
 	ShowPlayerCount bool `usage:"show just the online player count"`
+	ShowMods        bool `usage:"show the mods reported by Forge and NeoForge servers"`
 	Json            bool `usage:"output server status as JSON"`
+
+	MotdFormat string `default:"plain" usage:"format of the message of the day: plain, ansi for terminal colors, or html"`
+
+	SaveFavicon string `usage:"path of a PNG file where the favicon of the server is saved"`
+
+	LoginProbe         bool   `usage:"also attempts a login with an offline username to detect online-mode, whitelisting, or a rejected protocol version"`
+	LoginProbeUsername string `default:"mcmonitor" usage:"offline username sent by the login probe"`
+
+	motdFormat      chat.Format
+	protocolVersion int32
+	// proxy is enabled when use-proxy is set. The empty flag tag keeps flagsfiller from walking into it.
+	proxy utils.ProxyOptions `flag:""`
+
+	// resolvedHost and resolvedPort are where the server is contacted after the optional SRV lookup
+	resolvedHost string
+	resolvedPort int
+	resolver     utils.Resolver
+	// srvLookupTime is included in the DNS phase of the timings
+	srvLookupTime time.Duration
 }
 
 func (c *statusCmd) Name() string {
@@ -62,42 +107,137 @@ func (c *statusCmd) SetFlags(flags *flag.FlagSet) {
 }
 
 type statusResult struct {
-	Host       string               `json:"host"`
-	Port       int                  `json:"port"`
-	ServerInfo *mcpinger.ServerInfo `json:"server_info"`
+	Host string `json:"host"`
+	Port int    `json:"port"`
+	// ResolvedAddress is the [host:port] found via SRV lookup, if any
+	ResolvedAddress string              `json:"resolved_address,omitempty"`
+	ServerInfo      *slp.StatusResponse `json:"server_info"`
+	// Motd is the description rendered in the requested format
+	Motd    string         `json:"motd"`
+	Timings *statusTimings `json:"timings"`
+	// FaviconHash is the hex encoded SHA-256 hash of the favicon image, if any
+	FaviconHash string `json:"favicon_hash,omitempty"`
+	// ProtocolCheck is only included when a protocol or client version was requested
+	ProtocolCheck *protocolCheckResult `json:"protocol_check,omitempty"`
+	// LoginProbe is only included when the login probe is enabled
+	LoginProbe *loginProbeResult `json:"login_probe,omitempty"`
+	// Forge is the mod metadata of Forge and NeoForge servers
+	Forge *slp.ForgeInfo `json:"forge,omitempty"`
+}
+
+type loginProbeResult struct {
+	// Result is one of slp.LoginResults or "error" when the probe failed
+	Result string `json:"result"`
+	// Reason is the disconnect reason rendered in the requested format
+	Reason string `json:"reason,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+// statusTimings is the duration in seconds of each phase of the ping
+type statusTimings struct {
+	// Dns includes the time of any SRV lookup
+	Dns       float64 `json:"dns_seconds"`
+	Connect   float64 `json:"connect_seconds"`
+	Handshake float64 `json:"handshake_seconds"`
+	// PingPong is omitted when the server did not respond to the ping
+	PingPong float64 `json:"ping_pong_seconds,omitempty"`
+}
+
+func newStatusTimings(timings slp.Timings, srvLookupTime time.Duration) *statusTimings {
+	return &statusTimings{
+		Dns:       (srvLookupTime + timings.DNS).Seconds(),
+		Connect:   timings.Connect.Seconds(),
+		Handshake: timings.Handshake.Seconds(),
+		PingPong:  timings.PingPong.Seconds(),
+	}
 }
 
-func (c *statusCmd) Execute(_ context.Context, _ *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
+type protocolCheckResult struct {
+	// RequestedProtocol is the protocol version sent in the handshake
+	RequestedProtocol int32    `json:"requested_protocol"`
+	RequestedReleases []string `json:"requested_releases,omitempty"`
+	// ServerProtocol is the protocol version advertised by the server, which proxies such as ViaVersion
+	// set to the requested one when they accept it
+	ServerProtocol int32    `json:"server_protocol"`
+	ServerReleases []string `json:"server_releases,omitempty"`
+	Supported      bool     `json:"supported"`
+}
+
+func newProtocolCheckResult(requested int32, info *slp.StatusResponse) *protocolCheckResult {
+	server := int32(info.Version.Protocol)
+	return &protocolCheckResult{
+		RequestedProtocol: requested,
+		RequestedReleases: slp.ReleasesOf(requested),
+		ServerProtocol:    server,
+		ServerReleases:    slp.ReleasesOf(server),
+		Supported:         server == requested,
+	}
+}
+
+func (c *statusCmd) Execute(ctx context.Context, flags *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
 	logger := args[0].(*zap.Logger)
 
-	if c.UseServerListPing {
-		return c.ExecuteServerListPing()
+	var err error
+	c.motdFormat, err = chat.ParseFormat(c.MotdFormat)
+	if err != nil {
+		printUsageError(err.Error())
+		return subcommands.ExitUsageError
 	}
+	c.protocolVersion, err = slp.ResolveProtocolVersion(c.ProtocolVersion, c.ClientVersion)
+	if err != nil {
+		printUsageError(err.Error())
+		return subcommands.ExitUsageError
+	}
+	if c.UseProxy {
+		err = utils.ValidateProxyVersion(c.ProxyVersion)
+		if err == nil {
+			c.proxy.Source, err = utils.ParseProxySource(c.ProxySource)
+		}
+		if err != nil {
+			printUsageError(err.Error())
+			return subcommands.ExitUsageError
+		}
+		c.proxy.Version = byte(c.ProxyVersion)
+	}
+
+	c.resolveServer(ctx, flags, logger)
 
-	if c.UseOldServerListPing {
-		return c.ExecuteOldServerListPing()
+	variant := c.SlpVariant
+	if c.UseServerListPing {
+		variant = slpVariant16
+	} else if c.UseOldServerListPing {
+		variant = slpVariantBeta
+	}
+	switch variant {
+	case slpVariantModern:
+	case slpVariant16, slpVariant14, slpVariantBeta, slpVariantAuto:
+		return c.ExecuteLegacyServerListPing(variant, logger)
+	default:
+		printUsageError(fmt.Sprintf("unknown slp-variant '%s', must be modern, 1.6, 1.4, beta, or auto", variant))
+		return subcommands.ExitUsageError
 	}
 
 	if c.UseMcUtils {
-		return c.ExecuteMcUtilPing(logger)
+		logger.Warn("use-mc-utils is deprecated and no longer has any effect")
 	}
 
-	var options []mcpinger.McPingerOption
-	if c.Timeout > 0 {
-		options = append(options, mcpinger.WithTimeout(c.Timeout))
-	}
-	if c.UseProxy {
-		options = append(options, mcpinger.WithProxyProto(c.ProxyVersion))
+	options := &slp.PingOptions{
+		ProtocolVersion: c.protocolVersion,
+		MaxResponseSize: c.MaxResponseSize,
+		ProxyVersion:    c.proxy.Version,
+		ProxySource:     c.proxy.Source,
+		SkipPingPong:    c.SkipPingPong,
 	}
 
 	if c.RetryInterval <= 0 {
 		c.RetryInterval = 1 * time.Second
 	}
 
-	err := retry.Do(func() error {
+	err = retry.Do(func() error {
 		logger.Debug("pinging")
-		pinger := mcpinger.New(c.Host, uint16(c.Port), options...)
-		info, err := pinger.Ping()
+		pingCtx, cancel := withOptionalTimeout(ctx, c.Timeout)
+		defer cancel()
+		info, err := slp.Ping(pingCtx, c.resolvedHost, c.resolvedPort, options)
 		logger.Debug("ping returned", zap.Error(err), zap.Any("info", info))
 		if err != nil {
 			return err
@@ -112,11 +252,51 @@ func (c *statusCmd) Execute(_ context.Context, _ *flag.FlagSet, args ...interfac
 			return errors.New("server not ready")
 		}
 
+		forgeInfo, err := info.ForgeInfo()
+		if err != nil {
+			// the rest of the status is still usable
+			logger.Warn("failed to parse mod metadata", zap.Error(err))
+		}
+		motd, err := chat.Render(info.Description.Raw(), c.motdFormat)
+		if err != nil {
+			logger.Warn("failed to render description", zap.Error(err))
+			motd = info.Description.Text
+		}
+		faviconHash, err := info.FaviconHash()
+		if err != nil {
+			logger.Warn("failed to decode favicon", zap.Error(err))
+		}
+
+		var protocolCheck *protocolCheckResult
+		if c.protocolVersion != 0 {
+			protocolCheck = newProtocolCheckResult(c.protocolVersion, info)
+		}
+
+		var loginProbe *loginProbeResult
+		if c.LoginProbe {
+			loginProbe = c.probeLogin(ctx, info, logger)
+		}
+
+		if c.SaveFavicon != "" {
+			err := saveFavicon(info, c.SaveFavicon)
+			if err != nil {
+				// pinging again would not help
+				return retry.Unrecoverable(err)
+			}
+		}
+
 		if c.Json {
 			err := json.NewEncoder(os.Stdout).Encode(statusResult{
-				Host:       c.Host,
-				Port:       c.Port,
-				ServerInfo: info,
+				Host:            c.Host,
+				Port:            c.Port,
+				ResolvedAddress: c.resolvedAddress(),
+				ServerInfo:      info,
+				Motd:            motd,
+				Timings:         newStatusTimings(info.Timings, c.srvLookupTime),
+				FaviconHash:     faviconHash,
+				ProtocolCheck:   protocolCheck,
+				LoginProbe:      loginProbe,
+				Forge:           forgeInfo,
 			})
 
 			if err != nil {
@@ -125,10 +305,28 @@ func (c *statusCmd) Execute(_ context.Context, _ *flag.FlagSet, args ...interfac
 
 		} else if c.ShowPlayerCount {
 			fmt.Printf("%d\n", info.Players.Online)
+		} else if c.ShowMods {
+			printMods(c.Host, c.Port, forgeInfo)
 		} else {
 			fmt.Printf("%s:%d : version=%s online=%d max=%d motd='%s'\n",
 				c.Host, c.Port,
-				info.Version.Name, info.Players.Online, info.Players.Max, info.Description.Text)
+				info.Version.Name, info.Players.Online, info.Players.Max, motd)
+			if protocolCheck != nil {
+				fmt.Printf("%s:%d : requested_protocol=%s server_protocol=%s supported=%t\n",
+					c.Host, c.Port,
+					slp.DescribeProtocolVersion(protocolCheck.RequestedProtocol),
+					slp.DescribeProtocolVersion(protocolCheck.ServerProtocol),
+					protocolCheck.Supported)
+			}
+			if loginProbe != nil {
+				fmt.Printf("%s:%d : login=%s reason='%s' error='%s'\n",
+					c.Host, c.Port, loginProbe.Result, loginProbe.Reason, loginProbe.Error)
+			}
+		}
+
+		if protocolCheck != nil && !protocolCheck.Supported {
+			// pinging again would get the same answer
+			return retry.Unrecoverable(fmt.Errorf("server does not accept protocol version %d", c.protocolVersion))
 		}
 
 		return nil
@@ -147,103 +345,128 @@ func (c *statusCmd) Execute(_ context.Context, _ *flag.FlagSet, args ...interfac
 	}
 }
 
-func (c *statusCmd) ExecuteServerListPing() subcommands.ExitStatus {
-	err := retry.Do(func() error {
-		response, err := slp.ServerListPing(c.Host, c.Port, c.Timeout)
-		if err != nil {
-			return err
-		}
+// resolveServer applies the SRV lookup, like the Java Edition client, when the port was not explicitly given
+func (c *statusCmd) resolveServer(ctx context.Context, flags *flag.FlagSet, logger *zap.Logger) {
+	c.resolvedHost, c.resolvedPort = c.Host, c.Port
+	if c.SkipSrvLookup {
+		return
+	}
 
-		if response.MaxPlayers == "0" && !c.SkipReadinessCheck {
-			return errors.New("server not ready")
+	explicitPort := false
+	if _, ok := os.LookupEnv("MC_PORT"); ok {
+		explicitPort = true
+	}
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == "port" {
+			explicitPort = true
 		}
+	})
+	if explicitPort {
+		return
+	}
 
-		if c.ShowPlayerCount {
-			fmt.Printf("%s\n", response.CurrentPlayerCount)
-		} else {
-			fmt.Printf("%s:%d : version=%s online=%s max=%s motd='%s'\n",
-				c.Host, c.Port,
-				response.ServerVersion, response.CurrentPlayerCount, response.MaxPlayers, response.MessageOfTheDay)
-		}
+	start := time.Now()
+	host, port, found := utils.ResolveJavaServer(ctx, c.resolver, c.Host, uint16(c.Port))
+	c.srvLookupTime = time.Since(start)
+	if found {
+		logger.Debug("resolved SRV record",
+			zap.String("host", c.Host), zap.String("target", host), zap.Uint16("port", port))
+		c.resolvedHost, c.resolvedPort = host, int(port)
+	}
+}
 
-		return nil
-	}, retry.Delay(c.RetryInterval), retry.DelayType(retry.FixedDelay), retry.Attempts(uint(c.RetryLimit+1)))
+// resolvedAddress returns the [host:port] found via SRV lookup or an empty string if none was used
+func (c *statusCmd) resolvedAddress() string {
+	if c.resolvedHost == c.Host && c.resolvedPort == c.Port {
+		return ""
+	}
+	return net.JoinHostPort(c.resolvedHost, strconv.Itoa(c.resolvedPort))
+}
 
+// probeLogin attempts a login with the protocol version reported by the server. Failures are reported
+// in the result since the status itself succeeded.
+func (c *statusCmd) probeLogin(ctx context.Context, info *slp.StatusResponse, logger *zap.Logger) *loginProbeResult {
+	probeCtx, cancel := withOptionalTimeout(ctx, c.Timeout)
+	defer cancel()
+	response, err := slp.ProbeLogin(probeCtx, c.resolvedHost, c.resolvedPort, &slp.LoginOptions{
+		ProtocolVersion: int32(info.Version.Protocol),
+		Username:        c.LoginProbeUsername,
+		ProxyVersion:    c.proxy.Version,
+		ProxySource:     c.proxy.Source,
+	})
+	logger.Debug("login probe returned", zap.Error(err), zap.Any("response", response))
 	if err != nil {
-		_, _ = fmt.Fprintf(os.Stderr, "failed to ping %s:%d : %s", c.Host, c.Port, err)
-		return subcommands.ExitFailure
+		return &loginProbeResult{Result: loginProbeError, Error: err.Error()}
 	}
 
-	// regular output is within Do function
-	return subcommands.ExitSuccess
-}
-
-func (c *statusCmd) ExecuteOldServerListPing() subcommands.ExitStatus {
-	err := retry.Do(func() error {
-		response, err := slp.OldServerListPing(c.Host, c.Port, c.Timeout)
+	result := &loginProbeResult{Result: string(response.Result)}
+	if response.Reason != nil {
+		result.Reason, err = chat.Render(response.Reason, c.motdFormat)
 		if err != nil {
-			return err
-		}
-
-		if response.MaxPlayers == "0" && !c.SkipReadinessCheck {
-			return errors.New("server not ready")
-		}
-
-		if c.ShowPlayerCount {
-			fmt.Printf("%s\n", response.CurrentPlayerCount)
-		} else {
-			fmt.Printf("%s:%d : online=%s max=%s motd='%s'\n",
-				c.Host, c.Port,
-				response.CurrentPlayerCount, response.MaxPlayers, response.MessageOfTheDay)
+			result.Reason = string(response.Reason)
 		}
+	}
+	return result
+}
 
-		return nil
-	}, retry.Delay(c.RetryInterval), retry.DelayType(retry.FixedDelay), retry.Attempts(uint(c.RetryLimit+1)))
-
+func saveFavicon(info *slp.StatusResponse, path string) error {
+	image, err := info.FaviconPng()
 	if err != nil {
-		_, _ = fmt.Fprintf(os.Stderr, "failed to ping %s:%d : %s", c.Host, c.Port, err)
-		return subcommands.ExitFailure
+		return fmt.Errorf("failed to decode favicon: %w", err)
 	}
-
-	// regular output is within Do function
-	return subcommands.ExitSuccess
+	if image == nil {
+		return errors.New("server did not report a favicon")
+	}
+	err = os.WriteFile(path, image, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to save favicon: %w", err)
+	}
+	return nil
 }
 
-func (c *statusCmd) ExecuteMcUtilPing(logger *zap.Logger) subcommands.ExitStatus {
-	client := ping.NewClient(c.Host, c.Port)
-	client.DialTimeout = c.Timeout
-	client.ReadTimeout = c.Timeout
-
-	err := retry.Do(func() error {
+// printMods lists each mod with its version, which is omitted for mods that are not required on clients
+func printMods(host string, port int, forgeInfo *slp.ForgeInfo) {
+	if forgeInfo == nil {
+		fmt.Printf("%s:%d : no mods reported\n", host, port)
+		return
+	}
 
-		err := client.Connect()
-		if err != nil {
-			logger.Debug("Client failed to connect", zap.Error(err))
-			return err
+	fmt.Printf("%s:%d : fml_network_version=%d mods=%d truncated=%t\n",
+		host, port, forgeInfo.FmlNetworkVersion, len(forgeInfo.Mods), forgeInfo.Truncated)
+	for _, mod := range forgeInfo.Mods {
+		if mod.Version != "" {
+			fmt.Printf("%s %s\n", mod.Id, mod.Version)
+		} else {
+			fmt.Printf("%s\n", mod.Id)
 		}
+	}
+}
 
-		//goland:noinspection GoUnhandledErrorResult
-		defer client.Disconnect()
-
-		hs, err := client.Handshake()
+// ExecuteLegacyServerListPing pings with the given legacy variant or, when auto, each of the legacy
+// variants from newest to oldest until one succeeds
+func (c *statusCmd) ExecuteLegacyServerListPing(variant string, logger *zap.Logger) subcommands.ExitStatus {
+	err := retry.Do(func() error {
+		response, err := c.legacyServerListPing(variant, logger)
 		if err != nil {
-			logger.Debug("Client failed to handshake", zap.Error(err))
 			return err
 		}
 
-		response := hs.Properties.Infos()
-		logger.Debug("mcutils ping returned", zap.Any("properties", response))
-
-		if response.Players.Max == 0 && !c.SkipReadinessCheck {
+		if response.MaxPlayers == "0" && !c.SkipReadinessCheck {
 			return errors.New("server not ready")
 		}
 
+		motd := chat.Legacy(response.MessageOfTheDay).Render(c.motdFormat)
 		if c.ShowPlayerCount {
-			fmt.Printf("%d\n", response.Players.Online)
+			fmt.Printf("%s\n", response.CurrentPlayerCount)
+		} else if response.ServerVersion != "" {
+			fmt.Printf("%s:%d : version=%s online=%s max=%s motd='%s'\n",
+				c.Host, c.Port,
+				response.ServerVersion, response.CurrentPlayerCount, response.MaxPlayers, motd)
 		} else {
-			fmt.Printf("%s:%d : version=%s online=%d max=%d motd='%s'\n",
+			// the beta variant does not report the version
+			fmt.Printf("%s:%d : online=%s max=%s motd='%s'\n",
 				c.Host, c.Port,
-				response.Version.Name, response.Players.Online, response.Players.Max, response.Description)
+				response.CurrentPlayerCount, response.MaxPlayers, motd)
 		}
 
 		return nil
@@ -257,3 +480,16 @@ func (c *statusCmd) ExecuteMcUtilPing(logger *zap.Logger) subcommands.ExitStatus
 	// regular output is within Do function
 	return subcommands.ExitSuccess
 }
+
+func (c *statusCmd) legacyServerListPing(variant string, logger *zap.Logger) (*slp.ServerListResponse, error) {
+	options := &slp.LegacyPingOptions{
+		ProxyVersion: c.proxy.Version,
+		ProxySource:  c.proxy.Source,
+	}
+
+	response, succeeded, err := slp.LegacyPing(c.resolvedHost, c.resolvedPort, c.Timeout, variant, options)
+	if err == nil && succeeded != variant {
+		logger.Debug("legacy server list ping succeeded", zap.String("variant", succeeded))
+	}
+	return response, err
+}
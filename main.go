@@ -28,9 +28,11 @@ func main() {
 	subcommands.Register(&versionCmd{}, "")
 	subcommands.Register(&statusCmd{}, "status")
 	subcommands.Register(&statusBedrockCmd{}, "status")
+	subcommands.Register(&statusQueryCmd{}, "status")
 	subcommands.Register(&gatherTelegrafCmd{}, "monitoring")
 	subcommands.Register(&exportPrometheusCmd{}, "monitoring")
 	subcommands.Register(&otel.CollectOpenTelemetryCmd{}, "monitoring")
+	subcommands.Register(&validateConfigCmd{}, "monitoring")
 
 	var config GlobalConfig
 	err := flagsfiller.Parse(&config, flagsfiller.WithEnv(""))
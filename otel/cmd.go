@@ -9,6 +9,10 @@ import (
 
 	"github.com/google/subcommands"
 	"github.com/itzg/go-flagsfiller"
+	"github.com/itzg/mc-monitor/config"
+	"github.com/itzg/mc-monitor/discovery"
+	"github.com/itzg/mc-monitor/rcon"
+	"github.com/itzg/mc-monitor/slp"
 	"github.com/itzg/mc-monitor/utils"
 	"go.opentelemetry.io/contrib/instrumentation/runtime"
 	"go.opentelemetry.io/otel"
@@ -18,11 +22,29 @@ import (
 )
 
 type CollectOpenTelemetryCmd struct {
-	Servers        []string      `usage:"one or more [host:port] addresses of Java servers to monitor, when port is omitted 25565 is used"`
-	BedrockServers []string      `usage:"one or more [host:port] addresses of Bedrock servers to monitor, when port is omitted 19132 is used"`
-	Interval       time.Duration `default:"10s" usage:"Collect and sends OpenTelemetry data at this interval"`
-	OtelCollector  Collector     `group:"exporter" namespace:"exporter" usage:"Open Telemetry OtelCollector configurations"`
-	logger         *zap.Logger
+	Config             string                     `usage:"path of a YAML or JSON configuration file declaring targets, defaults, and sink settings, where flags take precedence over the file"`
+	Servers            []string                   `usage:"one or more [host:port] addresses or java:// URIs of Java servers to monitor, when port is omitted 25565 is used. See the README for the options of URIs"`
+	BedrockServers     []string                   `usage:"one or more [host:port] addresses or bedrock:// URIs of Bedrock servers to monitor, when port is omitted 19132 is used"`
+	Interval           time.Duration              `default:"10s" usage:"Collect and sends OpenTelemetry data at this interval"`
+	Timeout            time.Duration              `usage:"timeout of each ping, where zero waits indefinitely"`
+	UseProxy           bool                       `usage:"supports contacting servers when proxy_protocol is enabled"`
+	ProxyVersion       uint                       `usage:"version of PROXY protocol to use for Java servers, where Bedrock servers always use version 2" default:"1"`
+	ProxySource        string                     `usage:"[ip:port] reported as the client address in the PROXY protocol header instead of the local address"`
+	SkipSrvLookup      bool                       `usage:"skips resolving the _minecraft._tcp SRV record of Java servers given without a port"`
+	SkipPingPong       bool                       `usage:"skips the ping/pong exchange after the status of Java servers, which leaves out minecraft_status_ping_pong_seconds"`
+	ExportModInfo      bool                       `usage:"exports minecraft_status_mod_info with a series for each mod reported by Forge and NeoForge servers"`
+	LoginProbe         bool                       `usage:"attempts a login with an offline username to export minecraft_login_probe_result"`
+	LoginProbeUsername string                     `default:"mcmonitor" usage:"offline username sent by the login probe"`
+	ProtocolVersion    int                        `usage:"protocol version sent in the handshake to export minecraft_status_protocol_supported for Java servers"`
+	DropVersionLabel   bool                       `usage:"drops the server_version attribute from all metrics but minecraft_status_info and minecraft_status_bedrock_info, so that upgrades and failed pings don't start new series"`
+	ClientVersion      string                     `usage:"release of the client, such as 1.20.4, whose protocol version is sent in the handshake to export minecraft_status_protocol_supported"`
+	OtelCollector      Collector                  `group:"exporter" namespace:"exporter" usage:"Open Telemetry OtelCollector configurations"`
+	Latency            utils.LatencyConfig        `group:"latency" namespace:"latency" usage:"latency histograms"`
+	Rcon               rcon.Config                `group:"rcon" namespace:"rcon" usage:"RCON command metrics"`
+	Kubernetes         discovery.KubernetesConfig `group:"kubernetes" namespace:"kubernetes" usage:"Kubernetes service discovery"`
+	Docker             discovery.DockerConfig     `group:"docker" namespace:"docker" usage:"Docker container discovery"`
+	FileSD             discovery.FileSDConfig     `group:"file-sd" namespace:"file-sd" usage:"Prometheus file_sd discovery"`
+	logger             *zap.Logger
 }
 
 type Collector struct {
@@ -33,8 +55,6 @@ type Collector struct {
 // ShutdownFunc is a function that can be called to shut down the Open Telemetry provider components
 type ShutdownFunc func() error
 
-var _histogramBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.075, 0.1, 0.25, 0.5, 0.75, 1, 2.5, 5, 7.5, 10, 25, 50, 100}
-
 func (c *CollectOpenTelemetryCmd) Name() string {
 	return "collect-otel"
 }
@@ -55,9 +75,26 @@ func (c *CollectOpenTelemetryCmd) SetFlags(f *flag.FlagSet) {
 	}
 }
 
-func (c *CollectOpenTelemetryCmd) Execute(ctx context.Context, _ *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
-	// Validate the command line arguments
-	if (len(c.Servers) + len(c.BedrockServers)) == 0 {
+func (c *CollectOpenTelemetryCmd) Execute(ctx context.Context, flags *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
+	flagTargets, err := utils.ParseServerLists(c.Servers, c.BedrockServers)
+	if err != nil {
+		utils.PrintUsageError(err.Error())
+		return subcommands.ExitUsageError
+	}
+
+	// the configuration file and discovery may start without targets since they can be added while running
+	var cfg *config.File
+	if c.Config != "" {
+		cfg, err = config.Load(c.Config)
+		if err != nil {
+			utils.PrintUsageError(err.Error())
+			return subcommands.ExitUsageError
+		}
+		if err := cfg.ApplyFlags(flags, config.SinkOpenTelemetry); err != nil {
+			utils.PrintUsageError(err.Error())
+			return subcommands.ExitUsageError
+		}
+	} else if (len(flagTargets)+len(c.Rcon.Servers)) == 0 && !c.Kubernetes.Enabled && !c.Docker.Enabled && len(c.FileSD.Files) == 0 {
 		utils.PrintUsageError("requires at least one server")
 		return subcommands.ExitUsageError
 	}
@@ -67,8 +104,32 @@ func (c *CollectOpenTelemetryCmd) Execute(ctx context.Context, _ *flag.FlagSet,
 		return subcommands.ExitUsageError
 	}
 
+	protocolVersion, err := slp.ResolveProtocolVersion(c.ProtocolVersion, c.ClientVersion)
+	if err != nil {
+		utils.PrintUsageError(err.Error())
+		return subcommands.ExitUsageError
+	}
+
+	var proxy utils.ProxyOptions
+	// the source also applies to servers that enable the PROXY protocol in their URI
+	proxy.Source, err = utils.ParseProxySource(c.ProxySource)
+	if err == nil && c.UseProxy {
+		err = utils.ValidateProxyVersion(c.ProxyVersion)
+		proxy.Version = byte(c.ProxyVersion)
+	}
+	if err != nil {
+		utils.PrintUsageError(err.Error())
+		return subcommands.ExitUsageError
+	}
+
+	latencyBuckets, err := c.Latency.ParseBuckets()
+	if err != nil {
+		utils.PrintUsageError(err.Error())
+		return subcommands.ExitUsageError
+	}
+
 	// Start the OpenTelemetry meter provider
-	meterShutdownFunc, err := c.startMeterProvider(ctx)
+	meterShutdownFunc, err := c.startMeterProvider(ctx, latencyBuckets)
 	if err != nil {
 		utils.PrintUsageError(fmt.Sprintf("failed to start meter provider: %v", err))
 		return subcommands.ExitFailure
@@ -77,12 +138,68 @@ func (c *CollectOpenTelemetryCmd) Execute(ctx context.Context, _ *flag.FlagSet,
 	// Set the logger for the OpenTelemetry components
 	c.logger = args[0].(*zap.Logger).Named("otel")
 
+	discoverers, err := discovery.NewDiscoverers(c.logger, &c.Kubernetes, &c.Docker, &c.FileSD)
+	if err != nil {
+		utils.PrintUsageError(err.Error())
+		return subcommands.ExitFailure
+	}
+
 	// Create the  resources to be monitored
-	resources, err := c.initializeMetricResources()
+	var resources utils.TargetSet[Resource]
+	var sources discovery.Targets
+	updateResources := func(update sourceTargets) error {
+		changes, err := resources.Update(sources.Set(update.source, update.targets),
+			func(added []*utils.Target) ([]Resource, error) {
+				return c.initializeMetricResources(added, protocolVersion, proxy)
+			})
+		if err != nil {
+			return err
+		}
+		changes.Log(c.logger)
+		for _, removed := range changes.RemovedValues {
+			if err := removed.Close(); err != nil {
+				c.logger.Warn("failed to close resource of removed target", zap.Error(err))
+			}
+		}
+		return nil
+	}
+	initial := []sourceTargets{{source: discovery.FlagsSource, targets: flagTargets}}
+	if cfg != nil {
+		initial = append(initial, sourceTargets{source: discovery.ConfigSource, targets: cfg.TargetSpecs()})
+	}
+	for _, update := range initial {
+		if err := updateResources(update); err != nil {
+			utils.PrintUsageError(fmt.Sprintf("failed to create metric checker: %v", err))
+			return subcommands.ExitFailure
+		}
+	}
+
+	// reloaded and discovered targets are applied by the observing loop, which is the only user of the resources
+	updatedTargets := make(chan sourceTargets)
+	sendUpdate := func(source string, targets []*utils.Target) {
+		select {
+		case updatedTargets <- sourceTargets{source: source, targets: targets}:
+		case <-ctx.Done():
+		}
+	}
+	if cfg != nil {
+		go config.Watch(ctx, cfg, config.NotifyReload(), c.logger, func(cfg *config.File) {
+			sendUpdate(discovery.ConfigSource, cfg.TargetSpecs())
+		})
+	}
+	discovery.Run(ctx, discoverers, sendUpdate, c.logger)
+
+	rconPollers, err := c.Rcon.NewPollers(c.logger.Named("rcon"))
 	if err != nil {
-		utils.PrintUsageError(fmt.Sprintf("failed to create metric checker: %v", err))
+		utils.PrintUsageError(fmt.Sprintf("failed to setup RCON: %v", err))
 		return subcommands.ExitFailure
 	}
+	if len(rconPollers) > 0 {
+		registerRconInstruments(rconPollers)
+		for _, poller := range rconPollers {
+			go poller.Run(ctx, c.Rcon.Interval)
+		}
+	}
 
 	// Start the observing loop
 	ticker := time.NewTicker(c.Interval)
@@ -96,18 +213,30 @@ func (c *CollectOpenTelemetryCmd) Execute(ctx context.Context, _ *flag.FlagSet,
 
 			return subcommands.ExitSuccess
 
+		case update := <-updatedTargets:
+			if err := updateResources(update); err != nil {
+				c.logger.Error("failed to apply the updated targets", zap.String("source", update.source), zap.Error(err))
+			}
+
 		case <-ticker.C:
 			c.logger.Info("collecting OpenTelemetry data")
 
-			for _, r := range resources {
+			for _, r := range resources.Values() {
 				go r.Execute()
 			}
 		}
 	}
 }
 
-// startMeterProvider constructs and starts the exporter that will be sending telemetry data from a meter provider that is set
-func (c *CollectOpenTelemetryCmd) startMeterProvider(ctx context.Context) (ShutdownFunc, error) {
+// sourceTargets are the targets of a source, such as the configuration file or a discoverer
+type sourceTargets struct {
+	source  string
+	targets []*utils.Target
+}
+
+// startMeterProvider constructs and starts the exporter that will be sending telemetry data from a meter provider that is set,
+// where the latency histograms of each edition have the given buckets
+func (c *CollectOpenTelemetryCmd) startMeterProvider(ctx context.Context, latencyBuckets utils.LatencyBuckets) (ShutdownFunc, error) {
 	exporter, err := otlpmetricgrpc.New(ctx, otlpmetricgrpc.WithEndpoint(c.OtelCollector.Endpoint), otlpmetricgrpc.WithInsecure())
 	if err != nil {
 		return nil, err
@@ -121,15 +250,7 @@ func (c *CollectOpenTelemetryCmd) startMeterProvider(ctx context.Context) (Shutd
 				metric.WithInterval(c.Interval),
 			),
 		),
-		metric.WithView(
-			metric.NewView(
-				metric.Instrument{
-					Name: "*",
-					Kind: metric.InstrumentKindHistogram,
-				},
-				metric.Stream{Aggregation: metric.AggregationExplicitBucketHistogram{Boundaries: _histogramBuckets}},
-			),
-		),
+		metric.WithView(latencyViews(latencyBuckets)...),
 	)
 
 	otel.SetMeterProvider(meterProvider)
@@ -144,48 +265,72 @@ func (c *CollectOpenTelemetryCmd) startMeterProvider(ctx context.Context) (Shutd
 	}, nil
 }
 
-// initializeMetricResources creates the OpenTelemetry Metric resources for the given servers
-func (c *CollectOpenTelemetryCmd) initializeMetricResources() (
+// latencyViews apply the given buckets to the latency histogram of each edition
+func latencyViews(latencyBuckets utils.LatencyBuckets) []metric.View {
+	return []metric.View{
+		metric.NewView(
+			metric.Instrument{
+				Name: javaLatencyName,
+				Kind: metric.InstrumentKindHistogram,
+			},
+			metric.Stream{Aggregation: metric.AggregationExplicitBucketHistogram{Boundaries: latencyBuckets[utils.JavaEdition]}},
+		),
+		metric.NewView(
+			metric.Instrument{
+				Name: bedrockLatencyName,
+				Kind: metric.InstrumentKindHistogram,
+			},
+			metric.Stream{Aggregation: metric.AggregationExplicitBucketHistogram{Boundaries: latencyBuckets[utils.BedrockEdition]}},
+		),
+	}
+}
+
+// loginProbeUsername returns the username for the login probe or empty when the probe is disabled
+func (c *CollectOpenTelemetryCmd) loginProbeUsername() string {
+	if !c.LoginProbe {
+		return ""
+	}
+	return c.LoginProbeUsername
+}
+
+// initializeMetricResources creates the OpenTelemetry Metric resources for the given targets
+func (c *CollectOpenTelemetryCmd) initializeMetricResources(targets []*utils.Target, protocolVersion int32, proxy utils.ProxyOptions) (
 	[]Resource,
 	error,
 ) {
-	resources := make([]Resource, 0)
+	resources := make([]Resource, 0, len(targets))
 
-	for _, server := range c.Servers {
-		host, port, err := utils.SplitHostPort(server, utils.DefaultJavaPort)
-		if err != nil {
-			return nil, fmt.Errorf("failed to process server entry '%s': %w", server, err)
-		}
-		c.logger.Info("adding Java server", zap.String("host", host), zap.Uint16("port", port))
-
-		resource, err := newOpenTelemetryMetricResource(
-			host,
-			port,
-			withServerEdition(utils.JavaEdition),
-			withServerMetrics(c.logger),
-			withLogger(c.logger),
-		)
-		if err != nil {
-			return nil, fmt.Errorf("failed to create Java resource: %w", err)
-		}
-		resources = append(resources, resource)
-	}
-
-	for _, server := range c.BedrockServers {
-		host, port, err := utils.SplitHostPort(server, utils.DefaultBedrockPort)
-		if err != nil {
-			return nil, fmt.Errorf("failed to process server entry '%s': %w", server, err)
+	for _, target := range targets {
+		var options []OpenTelemetryMetricResourceOptions
+		if target.Edition == utils.JavaEdition {
+			c.logger.Info("adding Java server", zap.String("host", target.Host), zap.Uint16("port", target.Port))
+			options = []OpenTelemetryMetricResourceOptions{
+				withServerEdition(utils.JavaEdition),
+				withSrvLookup(!c.SkipSrvLookup && !target.ExplicitPort),
+				withSkipPingPong(c.SkipPingPong),
+				withModInfo(c.ExportModInfo),
+				withLoginProbe(c.loginProbeUsername()),
+				withProtocolVersion(protocolVersion),
+			}
+		} else {
+			c.logger.Info("adding Bedrock server", zap.String("host", target.Host), zap.Uint16("port", target.Port))
+			options = []OpenTelemetryMetricResourceOptions{
+				withServerEdition(utils.BedrockEdition),
+			}
 		}
-		c.logger.Info("adding Bedrock server", zap.String("host", host), zap.Uint16("port", port))
 
 		resource, err := newOpenTelemetryMetricResource(
-			host,
-			port,
-			withServerEdition(utils.BedrockEdition),
-			withLogger(c.logger),
+			target.Host,
+			target.Port,
+			append(options,
+				withTarget(target, proxy, c.Timeout),
+				withServerMetrics(c.logger),
+				withVersionAttribute(!c.DropVersionLabel),
+				withLogger(c.logger),
+			)...,
 		)
 		if err != nil {
-			return nil, fmt.Errorf("failed to create Bedrock resource: %w", err)
+			return nil, fmt.Errorf("failed to create %s resource: %w", target.Edition, err)
 		}
 		resources = append(resources, resource)
 	}
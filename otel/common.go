@@ -1,11 +1,9 @@
 package otel
 
 import (
-	"context"
 	"fmt"
 
 	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/metric"
 )
 
@@ -13,45 +11,28 @@ var (
 	meter = otel.GetMeterProvider().Meter("minecraft")
 )
 
-func NewInt64ObservableGauge(
-	name string,
-	description string,
-	callback func() int64,
-	attributes []attribute.KeyValue,
-) {
-	_, err := meter.Int64ObservableGauge(
+// NewInt64ObservableGauge creates a gauge whose values are observed by the callbacks registered
+// with the meter, such as the one of each ServerMetrics
+func NewInt64ObservableGauge(name string, description string) metric.Int64ObservableGauge {
+	gauge, err := meter.Int64ObservableGauge(
 		name,
 		metric.WithDescription(description),
 		metric.WithUnit("1"),
-		metric.WithInt64Callback(
-			func(ctx context.Context, observer metric.Int64Observer) error {
-				observer.Observe(callback(), metric.WithAttributes(attributes...))
-				return nil
-			},
-		),
 	)
 	handleError(fmt.Sprintf("Error creating %s metric", name), err)
-	return
+	return gauge
 }
 
-func NewFloat64ObservableGauge(
-	name string,
-	description string,
-	callback func() float64,
-	attributes []attribute.KeyValue,
-) {
-	_, err := meter.Float64ObservableGauge(
+// NewFloat64ObservableGauge creates a gauge of the given unit whose values are observed by the callbacks
+// registered with the meter, such as the one of each ServerMetrics
+func NewFloat64ObservableGauge(name string, description string, unit string) metric.Float64ObservableGauge {
+	gauge, err := meter.Float64ObservableGauge(
 		name,
 		metric.WithDescription(description),
-		metric.WithUnit("ms"),
-		metric.WithFloat64Callback(
-			func(ctx context.Context, observer metric.Float64Observer) error {
-				observer.Observe(callback(), metric.WithAttributes(attributes...))
-				return nil
-			},
-		),
+		metric.WithUnit(unit),
 	)
 	handleError(fmt.Sprintf("Error creating %s metric", name), err)
+	return gauge
 }
 
 func handleError(msg string, err error) {
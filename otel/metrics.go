@@ -1,10 +1,16 @@
 package otel
 
 import (
+	"context"
 	"strconv"
+	"sync"
+	"time"
 
+	"github.com/itzg/mc-monitor/bedrock"
+	"github.com/itzg/mc-monitor/slp"
 	"github.com/itzg/mc-monitor/utils"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
 	"go.uber.org/zap"
 )
 
@@ -13,87 +19,397 @@ const (
 	serverPortAttribute    = "server_port"
 	serverEditionAttribute = "server_edition"
 	serverVersionAttribute = "server_version"
+	// serverResolvedAddressAttribute is the [host:port] found via SRV lookup of Java servers, if any
+	serverResolvedAddressAttribute = "server_resolved_address"
+	modIdAttribute                 = "mod_id"
+	modVersionAttribute            = "mod_version"
+	loginResultAttribute           = "result"
+	protocolAttribute              = "protocol_version"
+	requestedProtocolAttribute     = "requested_protocol_version"
+	motdAttribute                  = "motd"
 )
 
+// Names of the latency histograms, where each edition has its own since their buckets differ
+const (
+	javaLatencyName    = "minecraft_status_java_latency_seconds"
+	bedrockLatencyName = "minecraft_status_bedrock_latency_seconds"
+)
+
+// loginProbeErrorResult is the login probe result when the reply could not be classified
+const loginProbeErrorResult = "error"
+
+// Attributes of minecraft_status_bedrock_info
+const (
+	bedrockEditionAttribute         = "bedrock_edition"
+	bedrockProtocolAttribute        = "protocol_version"
+	bedrockServerGuidAttribute      = "server_guid"
+	bedrockLevelNameAttribute       = "level_name"
+	bedrockGameModeAttribute        = "game_mode"
+	bedrockGameModeIdAttribute      = "game_mode_id"
+	bedrockPortIPv4Attribute        = "port_ipv4"
+	bedrockPortIPv6Attribute        = "port_ipv6"
+	bedrockNintendoLimitedAttribute = "nintendo_limited"
+)
+
+// serverInstruments are created once and shared by the ServerMetrics of each server, which observe their
+// own values by registering a callback with the meter
+type serverInstruments struct {
+	healthy metric.Int64ObservableGauge
+	// responseTime is deprecated in favor of responseTimeSeconds, since it is reported in seconds despite
+	// having always declared a unit of milliseconds
+	responseTime        metric.Float64ObservableGauge
+	responseTimeSeconds metric.Float64ObservableGauge
+	dnsLookup           metric.Float64ObservableGauge
+	connect             metric.Float64ObservableGauge
+	handshake           metric.Float64ObservableGauge
+	pingPong            metric.Float64ObservableGauge
+	playersOnline       metric.Int64ObservableGauge
+	playersMax          metric.Int64ObservableGauge
+	modsCount           metric.Int64ObservableGauge
+	modInfo             metric.Int64ObservableGauge
+	loginProbeResult    metric.Int64ObservableGauge
+	protocolSupported   metric.Int64ObservableGauge
+	info                metric.Int64ObservableGauge
+	bedrockInfo         metric.Int64ObservableGauge
+	faviconChanged      metric.Int64Counter
+	latency             map[utils.ServerEdition]metric.Float64Histogram
+}
+
+var (
+	serverInstrumentsOnce sync.Once
+	instruments           *serverInstruments
+)
+
+// getServerInstruments creates the instruments on first use, which is after the meter provider is started
+func getServerInstruments() *serverInstruments {
+	serverInstrumentsOnce.Do(func() {
+		faviconChanged, err := meter.Int64Counter(
+			"minecraft_status_favicon_changed_total",
+			metric.WithDescription("The number of times the favicon reported by the server has changed since monitoring started"),
+			metric.WithUnit("1"),
+		)
+		handleError("Error creating minecraft_status_favicon_changed_total metric", err)
+		javaLatency, err := meter.Float64Histogram(
+			javaLatencyName,
+			metric.WithDescription("The distribution of the time it took Java servers to respond, including connecting and the handshake"),
+			metric.WithUnit("s"),
+		)
+		handleError("Error creating "+javaLatencyName+" metric", err)
+		bedrockLatency, err := meter.Float64Histogram(
+			bedrockLatencyName,
+			metric.WithDescription("The distribution of the round trip time of the ping of Bedrock servers"),
+			metric.WithUnit("s"),
+		)
+		handleError("Error creating "+bedrockLatencyName+" metric", err)
+
+		instruments = &serverInstruments{
+			healthy: NewInt64ObservableGauge("minecraft_status_healthy",
+				"Indicates if the server is healthy (1) or not (0)"),
+			responseTime: NewFloat64ObservableGauge("minecraft_status_response_time",
+				"Deprecated in favor of minecraft_status_response_time_seconds, the response time of the server in seconds", "ms"),
+			responseTimeSeconds: NewFloat64ObservableGauge("minecraft_status_response_time_seconds",
+				"The response time of the server", "s"),
+			dnsLookup: NewFloat64ObservableGauge("minecraft_status_dns_lookup_seconds",
+				"The time it took to resolve the address of the server, including any SRV lookup", "s"),
+			connect: NewFloat64ObservableGauge("minecraft_status_connect_seconds",
+				"The time it took to establish the TCP connection to the server", "s"),
+			handshake: NewFloat64ObservableGauge("minecraft_status_handshake_seconds",
+				"The time from sending the handshake until the status response of the server was received", "s"),
+			pingPong: NewFloat64ObservableGauge("minecraft_status_ping_pong_seconds",
+				"The round trip time of the ping/pong exchange, which the client shows as the latency of the server", "s"),
+			playersOnline: NewInt64ObservableGauge("minecraft_status_players_online_count",
+				"The number of players currently online on the server"),
+			playersMax: NewInt64ObservableGauge("minecraft_status_players_max_count",
+				"The maximum number of players that can be online on the server"),
+			modsCount: NewInt64ObservableGauge("minecraft_status_mods_count",
+				"The number of mods reported by Forge and NeoForge servers"),
+			modInfo: NewInt64ObservableGauge("minecraft_status_mod_info",
+				"Has the value 1 for each mod reported by Forge and NeoForge servers"),
+			loginProbeResult: NewInt64ObservableGauge("minecraft_login_probe_result",
+				"Indicates with 1 the result of attempting a login with an offline username and 0 for the other results"),
+			protocolSupported: NewInt64ObservableGauge("minecraft_status_protocol_supported",
+				"Indicates if the server accepts (1) or not (0) clients of the requested protocol version"),
+			info: NewInt64ObservableGauge("minecraft_status_info",
+				"Has the value 1 with attributes describing the version, protocol, and message of the day reported by the server"),
+			bedrockInfo: NewInt64ObservableGauge("minecraft_status_bedrock_info",
+				"Has the value 1 with attributes describing the details reported by Bedrock and Education Edition servers"),
+			faviconChanged: faviconChanged,
+			latency: map[utils.ServerEdition]metric.Float64Histogram{
+				utils.JavaEdition:    javaLatency,
+				utils.BedrockEdition: bedrockLatency,
+			},
+		}
+	})
+	return instruments
+}
+
+// observables returns the observable instruments, which are those observed by callbacks
+func (i *serverInstruments) observables() []metric.Observable {
+	return []metric.Observable{
+		i.healthy, i.responseTime, i.responseTimeSeconds, i.dnsLookup, i.connect, i.handshake, i.pingPong, i.playersOnline, i.playersMax,
+		i.modsCount, i.modInfo, i.loginProbeResult, i.protocolSupported, i.info, i.bedrockInfo,
+	}
+}
+
+type int64Observation struct {
+	value      int64
+	attributes []attribute.KeyValue
+}
+
+type float64Observation struct {
+	value      float64
+	attributes []attribute.KeyValue
+}
+
+// ServerMetrics retains the most recently recorded values of a server, which are observed by a callback
+// that is registered until Unregister is called
 type ServerMetrics struct {
-	healthy            bool
-	responseTime       float64
-	playersOnlineCount int64
-	playersMaxCount    int64
-	logger             *zap.Logger
+	instruments  *serverInstruments
+	registration metric.Registration
+
+	mu                  sync.Mutex
+	int64Observations   map[metric.Int64Observable][]int64Observation
+	float64Observations map[metric.Float64Observable][]float64Observation
+	faviconSeen         bool
+	faviconHash         string
+	logger              *zap.Logger
 }
 
 func NewServerMetrics(logger *zap.Logger) *ServerMetrics {
-	return &ServerMetrics{
-		healthy:            false,
-		responseTime:       0.0,
-		playersOnlineCount: 0,
-		playersMaxCount:    0,
-		logger:             logger,
+	m := &ServerMetrics{
+		instruments:         getServerInstruments(),
+		int64Observations:   make(map[metric.Int64Observable][]int64Observation),
+		float64Observations: make(map[metric.Float64Observable][]float64Observation),
+		logger:              logger,
+	}
+
+	registration, err := meter.RegisterCallback(m.observe, m.instruments.observables()...)
+	handleError("Error registering server metrics callback", err)
+	m.registration = registration
+	return m
+}
+
+// Unregister stops observing the values of the server, such as when it is no longer monitored
+func (m *ServerMetrics) Unregister() error {
+	return m.registration.Unregister()
+}
+
+func (m *ServerMetrics) observe(_ context.Context, observer metric.Observer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for instrument, observations := range m.int64Observations {
+		for _, observation := range observations {
+			observer.ObserveInt64(instrument, observation.value, metric.WithAttributes(observation.attributes...))
+		}
 	}
+	for instrument, observations := range m.float64Observations {
+		for _, observation := range observations {
+			observer.ObserveFloat64(instrument, observation.value, metric.WithAttributes(observation.attributes...))
+		}
+	}
+	return nil
+}
+
+// setInt64 replaces the observations of the given instrument with the given value
+func (m *ServerMetrics) setInt64(instrument metric.Int64Observable, value int64, attributes []attribute.KeyValue) {
+	m.setInt64Observations(instrument, []int64Observation{{value: value, attributes: attributes}})
+}
+
+func (m *ServerMetrics) setInt64Observations(instrument metric.Int64Observable, observations []int64Observation) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.int64Observations[instrument] = observations
+}
+
+// setFloat64 replaces the observations of the given instrument with the given value
+func (m *ServerMetrics) setFloat64(instrument metric.Float64Observable, value float64, attributes []attribute.KeyValue) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.float64Observations[instrument] = []float64Observation{{value: value, attributes: attributes}}
+}
+
+// RecordUnhealthy reports the server as not healthy and stops reporting the values of its last successful ping,
+// which would otherwise keep being observed as if they were current
+func (m *ServerMetrics) RecordUnhealthy(attributes []attribute.KeyValue) {
+	m.logger.Debug("Health", zap.Bool("healthy", false))
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	clear(m.int64Observations)
+	clear(m.float64Observations)
+	m.int64Observations[m.instruments.healthy] = []int64Observation{{value: 0, attributes: attributes}}
 }
 
 func (m *ServerMetrics) RecordHealth(healthy bool, attributes []attribute.KeyValue) {
-	m.healthy = healthy
-	NewInt64ObservableGauge(
-		"minecraft_status_healthy",
-		"Indicates if the server is healthy (1) or not (0)",
-		func() int64 {
-			if m.healthy {
-				m.logger.Debug("Server is healthy")
-				return int64(1)
-			}
-			m.logger.Debug("Server is not healthy")
-			return int64(0)
-		},
-		attributes,
-	)
+	m.logger.Debug("Health", zap.Bool("healthy", healthy))
+	var value int64
+	if healthy {
+		value = 1
+	}
+	m.setInt64(m.instruments.healthy, value, attributes)
 }
 
 func (m *ServerMetrics) RecordResponseTime(responseTime float64, attributes []attribute.KeyValue) {
-	m.responseTime = responseTime
-	NewFloat64ObservableGauge(
-		"minecraft_status_response_time",
-		"The response time of the server",
-		func() float64 {
-			m.logger.Debug("Response time", zap.Float64("responseTime", m.responseTime))
-			return m.responseTime
-		},
-		attributes,
-	)
+	m.logger.Debug("Response time", zap.Float64("responseTime", responseTime))
+	m.setFloat64(m.instruments.responseTime, responseTime, attributes)
+	m.setFloat64(m.instruments.responseTimeSeconds, responseTime, attributes)
+}
+
+// RecordTimings reports the duration of each phase of the ping, where the DNS phase includes the given
+// time of the SRV lookup
+func (m *ServerMetrics) RecordTimings(timings slp.Timings, srvLookupTime time.Duration, attributes []attribute.KeyValue) {
+	m.setFloat64(m.instruments.dnsLookup, (srvLookupTime + timings.DNS).Seconds(), attributes)
+	m.setFloat64(m.instruments.connect, timings.Connect.Seconds(), attributes)
+	m.setFloat64(m.instruments.handshake, timings.Handshake.Seconds(), attributes)
+	// not all servers and proxies respond to the ping
+	if timings.PingPong > 0 {
+		m.setFloat64(m.instruments.pingPong, timings.PingPong.Seconds(), attributes)
+	} else {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		delete(m.float64Observations, m.instruments.pingPong)
+	}
 }
 
 func (m *ServerMetrics) RecordPlayersOnlineCount(playersOnlineCount int32, attributes []attribute.KeyValue) {
-	m.playersOnlineCount = int64(playersOnlineCount)
-	NewInt64ObservableGauge(
-		"minecraft_status_players_online_count",
-		"The number of players currently online on the server",
-		func() int64 {
-			m.logger.Debug("PlayersOnlineCount", zap.Int64("playersOnlineCount", m.playersOnlineCount))
-			return m.playersOnlineCount
-		},
-		attributes,
-	)
+	m.logger.Debug("PlayersOnlineCount", zap.Int32("playersOnlineCount", playersOnlineCount))
+	m.setInt64(m.instruments.playersOnline, int64(playersOnlineCount), attributes)
 }
 
 func (m *ServerMetrics) RecordPlayersMaxCount(playersMaxCount int32, attributes []attribute.KeyValue) {
-	m.playersMaxCount = int64(playersMaxCount)
-	NewInt64ObservableGauge(
-		"minecraft_status_players_max_count",
-		"The maximum number of players that can be online on the server",
-		func() int64 {
-			m.logger.Debug("PlayersMaxCount", zap.Int64("playersMaxCount", m.playersMaxCount))
-			return m.playersMaxCount
-		},
-		attributes,
+	m.logger.Debug("PlayersMaxCount", zap.Int32("playersMaxCount", playersMaxCount))
+	m.setInt64(m.instruments.playersMax, int64(playersMaxCount), attributes)
+}
+
+func (m *ServerMetrics) RecordModsCount(modsCount int, attributes []attribute.KeyValue) {
+	m.logger.Debug("ModsCount", zap.Int("modsCount", modsCount))
+	m.setInt64(m.instruments.modsCount, int64(modsCount), attributes)
+}
+
+// RecordModInfo reports a value of 1 for each of the given mods, which are distinguished by their
+// mod_id and mod_version attributes
+func (m *ServerMetrics) RecordModInfo(mods []slp.Mod, attributes []attribute.KeyValue) {
+	observations := make([]int64Observation, 0, len(mods))
+	for _, mod := range mods {
+		observations = append(observations, int64Observation{
+			value: 1,
+			attributes: append(append([]attribute.KeyValue{}, attributes...),
+				attribute.String(modIdAttribute, mod.Id),
+				attribute.String(modVersionAttribute, mod.Version),
+			),
+		})
+	}
+	m.setInt64Observations(m.instruments.modInfo, observations)
+}
+
+// RecordFaviconHash counts a change when the given favicon hash differs from the previously recorded one.
+// The attributes should exclude the version since it may change along with the favicon.
+func (m *ServerMetrics) RecordFaviconHash(hash string, attributes []attribute.KeyValue) {
+	m.mu.Lock()
+	changed := m.faviconSeen && hash != m.faviconHash
+	m.faviconSeen = true
+	m.faviconHash = hash
+	m.mu.Unlock()
+
+	var increment int64
+	if changed {
+		increment = 1
+	}
+	// adding zero ensures the counter is reported before the first change
+	m.instruments.faviconChanged.Add(context.Background(), increment, metric.WithAttributes(attributes...))
+}
+
+// RecordLatency records the latency of a ping into the histogram of the edition. The attributes should exclude
+// the version, so that the observations accumulate across upgrades.
+func (m *ServerMetrics) RecordLatency(edition utils.ServerEdition, latency time.Duration, attributes []attribute.KeyValue) {
+	m.instruments.latency[edition].Record(context.Background(), latency.Seconds(), metric.WithAttributes(attributes...))
+}
+
+// RecordLoginProbeResult reports a value of 1 for the given result of the login probe and 0 for the
+// other possible results, which are distinguished by the result attribute
+func (m *ServerMetrics) RecordLoginProbeResult(result string, attributes []attribute.KeyValue) {
+	results := append([]string{loginProbeErrorResult}, loginResultNames()...)
+	observations := make([]int64Observation, 0, len(results))
+	for _, candidate := range results {
+		var value int64
+		if candidate == result {
+			value = 1
+		}
+		observations = append(observations, int64Observation{
+			value: value,
+			attributes: append(append([]attribute.KeyValue{}, attributes...),
+				attribute.String(loginResultAttribute, candidate),
+			),
+		})
+	}
+	m.setInt64Observations(m.instruments.loginProbeResult, observations)
+}
+
+func loginResultNames() []string {
+	names := make([]string, 0, len(slp.LoginResults))
+	for _, result := range slp.LoginResults {
+		names = append(names, string(result))
+	}
+	return names
+}
+
+// RecordProtocolSupported reports if the server accepts clients of the requested protocol version
+func (m *ServerMetrics) RecordProtocolSupported(supported bool, requestedProtocolVersion int32, attributes []attribute.KeyValue) {
+	var value int64
+	if supported {
+		value = 1
+	}
+	m.setInt64(m.instruments.protocolSupported, value,
+		append(attributes, attribute.String(requestedProtocolAttribute, strconv.Itoa(int(requestedProtocolVersion)))))
+}
+
+// RecordInfo reports a value of 1 with the given attributes, which always include the version
+func (m *ServerMetrics) RecordInfo(attributes []attribute.KeyValue) {
+	m.setInt64(m.instruments.info, 1, attributes)
+}
+
+// RecordBedrockInfo reports a value of 1 with the given attributes, which describe the details
+// reported by Bedrock and Education Edition servers
+func (m *ServerMetrics) RecordBedrockInfo(attributes []attribute.KeyValue) {
+	m.setInt64(m.instruments.bedrockInfo, 1, attributes)
+}
+
+func buildBedrockInfoAttributes(host string, port uint16, info *bedrock.ServerInfo) []attribute.KeyValue {
+	return append(buildMetricAttributes(host, port, utils.BedrockEdition, info.Version, ""),
+		attribute.String(bedrockEditionAttribute, info.Edition),
+		attribute.String(bedrockProtocolAttribute, strconv.Itoa(info.ProtocolVersion)),
+		attribute.String(bedrockServerGuidAttribute, strconv.FormatUint(info.ServerGuid, 10)),
+		attribute.String(bedrockLevelNameAttribute, info.LevelName),
+		attribute.String(bedrockGameModeAttribute, info.GameMode),
+		attribute.String(bedrockGameModeIdAttribute, strconv.Itoa(info.GameModeId)),
+		attribute.String(bedrockPortIPv4Attribute, strconv.Itoa(info.PortIPv4)),
+		attribute.String(bedrockPortIPv6Attribute, strconv.Itoa(info.PortIPv6)),
+		attribute.Bool(bedrockNintendoLimitedAttribute, info.NintendoLimited),
 	)
 }
 
-func buildMetricAttributes(host string, port uint16, edition utils.ServerEdition, version string) []attribute.KeyValue {
-	return []attribute.KeyValue{
+// buildInfoAttributes returns the attributes of minecraft_status_info, which keep the version even when it is
+// dropped from the other metrics
+func buildInfoAttributes(host string, port uint16, edition utils.ServerEdition, version string, resolvedAddress string,
+	protocolVersion int, motd string) []attribute.KeyValue {
+
+	return append(buildMetricAttributes(host, port, edition, version, resolvedAddress),
+		attribute.String(protocolAttribute, strconv.Itoa(protocolVersion)),
+		attribute.String(motdAttribute, motd),
+	)
+}
+
+// buildMetricAttributes returns the attributes of a server, where the resolved address is left out for Bedrock
+// servers since they have no SRV lookup
+func buildMetricAttributes(host string, port uint16, edition utils.ServerEdition, version string, resolvedAddress string) []attribute.KeyValue {
+	attributes := []attribute.KeyValue{
 		attribute.String(serverHostAttribute, host),
 		attribute.String(serverPortAttribute, strconv.Itoa(int(port))),
 		attribute.String(serverEditionAttribute, string(edition)),
 		attribute.String(serverVersionAttribute, version),
 	}
+	if edition == utils.JavaEdition {
+		attributes = append(attributes, attribute.String(serverResolvedAddressAttribute, resolvedAddress))
+	}
+	return attributes
 }
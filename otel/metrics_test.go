@@ -0,0 +1,170 @@
+package otel
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/itzg/mc-monitor/slp"
+	"github.com/itzg/mc-monitor/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.uber.org/zap"
+)
+
+var (
+	testReaderOnce sync.Once
+	testReader     *sdkmetric.ManualReader
+	// testLatencyBuckets differ between the editions and from the default buckets of the SDK
+	testLatencyBuckets = utils.LatencyBuckets{utils.JavaEdition: {0.25, 2.5}, utils.BedrockEdition: {0.01, 0.1, 1}}
+)
+
+// getTestReader sets a meter provider with the latency views whose metrics are read on demand. The provider is
+// only set once, since the meter of the package keeps delegating to the first provider that is set.
+func getTestReader() *sdkmetric.ManualReader {
+	testReaderOnce.Do(func() {
+		testReader = sdkmetric.NewManualReader()
+		otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(testReader),
+			sdkmetric.WithView(latencyViews(testLatencyBuckets)...)))
+	})
+	return testReader
+}
+
+// collect reads the named metric, which fails the test when it was not recorded
+func collect(t *testing.T, reader *sdkmetric.ManualReader, name string) metricdata.Metrics {
+	var data metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &data))
+	for _, scope := range data.ScopeMetrics {
+		for _, m := range scope.Metrics {
+			if m.Name == name {
+				return m
+			}
+		}
+	}
+	require.Failf(t, "metric not found", "%s was not recorded", name)
+	return metricdata.Metrics{}
+}
+
+// collectGauge returns the values of the named gauge by server host
+func collectGauge[N int64 | float64](t *testing.T, reader *sdkmetric.ManualReader, name string) map[string]N {
+	var data metricdata.ResourceMetrics
+	require.NoError(t, reader.Collect(context.Background(), &data))
+
+	values := make(map[string]N)
+	for _, scope := range data.ScopeMetrics {
+		for _, m := range scope.Metrics {
+			if m.Name != name {
+				continue
+			}
+			gauge, ok := m.Data.(metricdata.Gauge[N])
+			require.True(t, ok, "%s is not a gauge of %T", name, *new(N))
+			for _, point := range gauge.DataPoints {
+				host, _ := point.Attributes.Value(serverHostAttribute)
+				values[host.AsString()] = point.Value
+			}
+		}
+	}
+	return values
+}
+
+func TestServerMetricsUnregister(t *testing.T) {
+	reader := getTestReader()
+	newResource := func(host string) *OpenTelemetryMetricResource {
+		resource, err := newOpenTelemetryMetricResource(host, 25565,
+			withServerEdition(utils.JavaEdition), withServerMetrics(zap.NewNop()), withLogger(zap.NewNop()))
+		require.NoError(t, err)
+		return resource
+	}
+	kept := newResource("kept.example.com")
+	removed := newResource("removed.example.com")
+	kept.metrics.RecordHealth(true, kept.attributes("1.21.4", ""))
+	removed.metrics.RecordHealth(false, removed.attributes("1.21.4", ""))
+
+	healthy := collectGauge[int64](t, reader, "minecraft_status_healthy")
+	assert.Equal(t, int64(1), healthy["kept.example.com"])
+	assert.Contains(t, healthy, "removed.example.com")
+
+	require.NoError(t, removed.Close())
+	healthy = collectGauge[int64](t, reader, "minecraft_status_healthy")
+	assert.NotContains(t, healthy, "removed.example.com")
+	assert.Equal(t, int64(1), healthy["kept.example.com"])
+
+	require.NoError(t, kept.Close())
+	assert.Empty(t, collectGauge[int64](t, reader, "minecraft_status_healthy"))
+}
+
+func TestServerMetricsLatencyBuckets(t *testing.T) {
+	reader := getTestReader()
+	metrics := NewServerMetrics(zap.NewNop())
+	defer metrics.Unregister()
+
+	for edition, latency := range map[utils.ServerEdition]time.Duration{
+		utils.JavaEdition:    100 * time.Millisecond,
+		utils.BedrockEdition: 5 * time.Millisecond,
+	} {
+		metrics.RecordLatency(edition, latency, buildMetricAttributes("latency.example.com", 25565, edition, "", ""))
+	}
+
+	for edition, name := range map[utils.ServerEdition]string{
+		utils.JavaEdition:    javaLatencyName,
+		utils.BedrockEdition: bedrockLatencyName,
+	} {
+		histogram, ok := collect(t, reader, name).Data.(metricdata.Histogram[float64])
+		require.True(t, ok, "%s is not a histogram", name)
+		require.Len(t, histogram.DataPoints, 1)
+		point := histogram.DataPoints[0]
+		assert.Equal(t, testLatencyBuckets[edition], point.Bounds, name)
+		assert.Equal(t, uint64(1), point.Count, name)
+		assert.Equal(t, uint64(1), point.BucketCounts[0], "%s observes into its first bucket", name)
+	}
+}
+
+func TestBuildMetricAttributesResolvedAddress(t *testing.T) {
+	java := attribute.NewSet(buildMetricAttributes("mc.example.com", 25565, utils.JavaEdition, "1.21.4", "backend.example.com:25566")...)
+	resolved, ok := java.Value(serverResolvedAddressAttribute)
+	assert.True(t, ok)
+	assert.Equal(t, "backend.example.com:25566", resolved.AsString())
+
+	bedrock := attribute.NewSet(buildMetricAttributes("mc.example.com", 19132, utils.BedrockEdition, "1.21.50", "")...)
+	assert.False(t, bedrock.HasValue(serverResolvedAddressAttribute), "Bedrock servers have no SRV lookup")
+}
+
+func TestServerMetricsRecordUnhealthy(t *testing.T) {
+	reader := getTestReader()
+	metrics := NewServerMetrics(zap.NewNop())
+	defer metrics.Unregister()
+	attributes := buildMetricAttributes("unhealthy.example.com", 25565, utils.JavaEdition, "1.21.4", "")
+
+	metrics.RecordResponseTime(0.25, attributes)
+	metrics.RecordTimings(slp.Timings{Connect: time.Millisecond, Handshake: 2 * time.Millisecond, PingPong: time.Millisecond}, 0, attributes)
+	metrics.RecordHealth(true, attributes)
+	metrics.RecordPlayersOnlineCount(3, attributes)
+	for _, name := range []string{"minecraft_status_response_time", "minecraft_status_response_time_seconds"} {
+		assert.Equal(t, 0.25, collectGauge[float64](t, reader, name)["unhealthy.example.com"], name)
+	}
+
+	metrics.RecordUnhealthy(buildMetricAttributes("unhealthy.example.com", 25565, utils.JavaEdition, "", ""))
+	assert.Equal(t, int64(0), collectGauge[int64](t, reader, "minecraft_status_healthy")["unhealthy.example.com"])
+	assert.NotContains(t, collectGauge[int64](t, reader, "minecraft_status_players_online_count"), "unhealthy.example.com")
+	for _, name := range []string{"minecraft_status_response_time", "minecraft_status_response_time_seconds",
+		"minecraft_status_connect_seconds", "minecraft_status_handshake_seconds", "minecraft_status_ping_pong_seconds"} {
+		assert.NotContains(t, collectGauge[float64](t, reader, name), "unhealthy.example.com", name)
+	}
+}
+
+func TestServerMetricsRecordTimingsWithoutPong(t *testing.T) {
+	reader := getTestReader()
+	metrics := NewServerMetrics(zap.NewNop())
+	defer metrics.Unregister()
+	attributes := buildMetricAttributes("pong.example.com", 25565, utils.JavaEdition, "1.21.4", "")
+
+	metrics.RecordTimings(slp.Timings{Handshake: time.Millisecond, PingPong: time.Millisecond}, 0, attributes)
+	assert.Contains(t, collectGauge[float64](t, reader, "minecraft_status_ping_pong_seconds"), "pong.example.com")
+	metrics.RecordTimings(slp.Timings{Handshake: time.Millisecond}, 0, attributes)
+	assert.NotContains(t, collectGauge[float64](t, reader, "minecraft_status_ping_pong_seconds"), "pong.example.com")
+}
@@ -0,0 +1,66 @@
+package otel
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/itzg/mc-monitor/rcon"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const rconMetricPrefix = "minecraft_rcon_"
+
+// registerRconInstruments creates an observable gauge for each kind of RCON sample, which reports
+// the samples retained by the given pollers
+func registerRconInstruments(pollers []*rcon.Poller) {
+	_, err := meter.Int64ObservableGauge(
+		rconMetricPrefix+"up",
+		metric.WithDescription("Indicates if the RCON commands could be run (1) or not (0) during the most recent poll"),
+		metric.WithUnit("1"),
+		metric.WithInt64Callback(func(ctx context.Context, observer metric.Int64Observer) error {
+			for _, poller := range pollers {
+				up, _ := poller.Snapshot()
+				value := int64(0)
+				if up {
+					value = 1
+				}
+				observer.Observe(value, metric.WithAttributes(buildRconAttributes(poller, nil)...))
+			}
+			return nil
+		}),
+	)
+	handleError(fmt.Sprintf("Error creating %sup metric", rconMetricPrefix), err)
+
+	for name, info := range rcon.Samples {
+		sampleName := name
+		_, err := meter.Float64ObservableGauge(
+			rconMetricPrefix+sampleName,
+			metric.WithDescription(info.Description),
+			metric.WithFloat64Callback(func(ctx context.Context, observer metric.Float64Observer) error {
+				for _, poller := range pollers {
+					_, samples := poller.Snapshot()
+					for _, sample := range samples {
+						if sample.Name == sampleName {
+							observer.Observe(sample.Value, metric.WithAttributes(buildRconAttributes(poller, sample.Labels)...))
+						}
+					}
+				}
+				return nil
+			}),
+		)
+		handleError(fmt.Sprintf("Error creating %s%s metric", rconMetricPrefix, sampleName), err)
+	}
+}
+
+func buildRconAttributes(poller *rcon.Poller, labels map[string]string) []attribute.KeyValue {
+	attributes := []attribute.KeyValue{
+		attribute.String(serverHostAttribute, poller.Host()),
+		attribute.String(serverPortAttribute, strconv.Itoa(int(poller.Port()))),
+	}
+	for key, value := range labels {
+		attributes = append(attributes, attribute.String(key, value))
+	}
+	return attributes
+}
@@ -1,23 +1,51 @@
 package otel
 
 import (
+	"context"
+	"maps"
+	"net"
+	"slices"
 	"strconv"
 	"time"
 
-	mcpinger "github.com/Raqbit/mc-pinger"
+	"github.com/itzg/mc-monitor/bedrock"
+	"github.com/itzg/mc-monitor/chat"
+	"github.com/itzg/mc-monitor/slp"
 	"github.com/itzg/mc-monitor/utils"
+	"go.opentelemetry.io/otel/attribute"
 	"go.uber.org/zap"
 )
 
 type Resource interface {
 	Execute()
+	// Close stops reporting the metrics of the resource, such as when its target is removed
+	Close() error
 }
 
 type OpenTelemetryMetricResource struct {
-	host    string
-	port    uint16
-	edition utils.ServerEdition
-	pinger  mcpinger.Pinger
+	host      string
+	port      uint16
+	edition   utils.ServerEdition
+	srvLookup bool
+	resolver  utils.Resolver
+	// skipPingPong skips the ping/pong exchange that follows the status response
+	skipPingPong bool
+	// exportModInfo enables a series per mod, which is opt-in since large modpacks have hundreds of mods
+	exportModInfo bool
+	// loginProbeUsername enables the login probe when non-empty
+	loginProbeUsername string
+	// protocolVersion is sent in the handshake to check if the server accepts clients of that version when non-zero
+	protocolVersion int32
+	// proxy enables the PROXY protocol header, which is always version 2 for Bedrock servers
+	proxy utils.ProxyOptions
+	// timeout bounds each ping when non-zero
+	timeout time.Duration
+	// slpVariant selects a legacy server list ping, when set to other than modern
+	slpVariant string
+	// dropVersion leaves out the version attribute of all metrics but the info metrics
+	dropVersion bool
+	// labels are added as attributes of each metric
+	labels  map[string]string
 	metrics *ServerMetrics
 	logger  *zap.Logger
 }
@@ -36,6 +64,65 @@ func withServerMetrics(logger *zap.Logger) OpenTelemetryMetricResourceOptions {
 	}
 }
 
+// withSrvLookup enables resolving the _minecraft._tcp SRV record of the host before each ping
+func withSrvLookup(enabled bool) OpenTelemetryMetricResourceOptions {
+	return func(r *OpenTelemetryMetricResource) {
+		r.srvLookup = enabled
+	}
+}
+
+// withSkipPingPong skips the ping/pong exchange that follows the status response of each ping
+func withSkipPingPong(enabled bool) OpenTelemetryMetricResourceOptions {
+	return func(r *OpenTelemetryMetricResource) {
+		r.skipPingPong = enabled
+	}
+}
+
+// withModInfo enables reporting minecraft_status_mod_info for each mod of Forge and NeoForge servers
+func withModInfo(enabled bool) OpenTelemetryMetricResourceOptions {
+	return func(r *OpenTelemetryMetricResource) {
+		r.exportModInfo = enabled
+	}
+}
+
+// withLoginProbe enables reporting minecraft_login_probe_result by attempting a login with the given
+// offline username, where an empty username disables the probe
+func withLoginProbe(username string) OpenTelemetryMetricResourceOptions {
+	return func(r *OpenTelemetryMetricResource) {
+		r.loginProbeUsername = username
+	}
+}
+
+// withProtocolVersion enables reporting minecraft_status_protocol_supported for the given protocol version,
+// where zero disables the check
+func withProtocolVersion(protocolVersion int32) OpenTelemetryMetricResourceOptions {
+	return func(r *OpenTelemetryMetricResource) {
+		r.protocolVersion = protocolVersion
+	}
+}
+
+// withTarget applies the options given to the target, which take precedence over the given PROXY protocol
+// options and timeout of the command
+func withTarget(target *utils.Target, proxy utils.ProxyOptions, timeout time.Duration) OpenTelemetryMetricResourceOptions {
+	return func(r *OpenTelemetryMetricResource) {
+		r.proxy = target.ProxyOr(proxy)
+		r.timeout = target.TimeoutOr(timeout)
+		r.slpVariant = target.SlpVariant
+		r.labels = target.Labels
+		if target.ProtocolVersion != 0 {
+			r.protocolVersion = target.ProtocolVersion
+		}
+	}
+}
+
+// withVersionAttribute adds the server_version attribute to all metrics, where disabling it leaves the version
+// to minecraft_status_info and minecraft_status_bedrock_info
+func withVersionAttribute(enabled bool) OpenTelemetryMetricResourceOptions {
+	return func(r *OpenTelemetryMetricResource) {
+		r.dropVersion = !enabled
+	}
+}
+
 func withLogger(logger *zap.Logger) OpenTelemetryMetricResourceOptions {
 	return func(r *OpenTelemetryMetricResource) {
 		r.logger = logger
@@ -47,9 +134,8 @@ func newOpenTelemetryMetricResource(host string, port uint16, options ...OpenTel
 	error,
 ) {
 	resource := &OpenTelemetryMetricResource{
-		host:   host,
-		port:   port,
-		pinger: mcpinger.New(host, port),
+		host: host,
+		port: port,
 	}
 
 	for _, option := range options {
@@ -61,21 +147,205 @@ func newOpenTelemetryMetricResource(host string, port uint16, options ...OpenTel
 
 func (r *OpenTelemetryMetricResource) Execute() {
 	r.logger.Debug("pinging", zap.String("host", r.host), zap.String("port", strconv.Itoa(int(r.port))))
+	if r.edition == utils.BedrockEdition {
+		r.executeBedrock()
+		return
+	}
+
+	resolveStart := time.Now()
+	host, port, resolved := r.resolve()
+	srvLookupTime := time.Since(resolveStart)
 	startTime := time.Now()
-	info, err := r.pinger.Ping()
+	info, err := r.ping(host, port)
 	elapsed := time.Now().Sub(startTime)
+	if err == nil {
+		// the wait for the pong is not part of the response time
+		elapsed = info.ResponseTime(elapsed)
+	}
 	r.logger.Debug("ping returned", zap.Error(err), zap.Any("info", info))
 	r.logger.Debug("measured elapsed time", zap.Float64("elapsed", elapsed.Seconds()))
 
 	if r.metrics != nil {
+		// failed pings are recorded too, so that the count of the histogram includes them
+		r.metrics.RecordLatency(r.edition, elapsed, r.serverAttributes())
 		if err != nil || info.Players.Max == 0 {
-			r.metrics.RecordHealth(false, buildMetricAttributes(r.host, r.port, r.edition, ""))
+			r.metrics.RecordUnhealthy(r.attributes("", resolved))
+			return
+		}
+
+		r.metrics.RecordResponseTime(elapsed.Seconds(), r.attributes(info.Version.Name, resolved))
+		// the phases of legacy pings are not measured
+		if !r.isLegacy() {
+			r.metrics.RecordTimings(info.Timings, srvLookupTime, r.attributes(info.Version.Name, resolved))
+		}
+		r.metrics.RecordHealth(true, r.attributes(info.Version.Name, resolved))
+		r.metrics.RecordPlayersOnlineCount(int32(info.Players.Online), r.attributes(info.Version.Name, resolved))
+		r.metrics.RecordPlayersMaxCount(int32(info.Players.Max), r.attributes(info.Version.Name, resolved))
+
+		motd, err := chat.Render(info.Description.Raw(), chat.FormatPlain)
+		if err != nil {
+			r.logger.Warn("failed to render description", zap.String("host", r.host), zap.Error(err))
+			motd = info.Description.Text
+		}
+		r.metrics.RecordInfo(r.withLabels(buildInfoAttributes(r.host, r.port, r.edition, info.Version.Name, resolved,
+			info.Version.Protocol, motd)))
+		if r.protocolVersion != 0 {
+			// proxies such as ViaVersion advertise the requested protocol version when they accept it
+			r.metrics.RecordProtocolSupported(int32(info.Version.Protocol) == r.protocolVersion, r.protocolVersion,
+				r.attributes(info.Version.Name, resolved))
+		}
+
+		forgeInfo, err := info.ForgeInfo()
+		if err != nil {
+			r.logger.Warn("failed to parse mod metadata", zap.String("host", r.host), zap.Error(err))
+		} else if forgeInfo != nil {
+			r.metrics.RecordModsCount(len(forgeInfo.Mods), r.attributes(info.Version.Name, resolved))
+			if r.exportModInfo {
+				r.metrics.RecordModInfo(forgeInfo.Mods, r.attributes(info.Version.Name, resolved))
+			}
+		}
+
+		faviconHash, err := info.FaviconHash()
+		if err != nil {
+			r.logger.Warn("failed to decode favicon", zap.String("host", r.host), zap.Error(err))
+		} else {
+			r.metrics.RecordFaviconHash(faviconHash, r.serverAttributes())
+		}
+
+		// servers old enough to need a legacy ping do not support the login of the probe
+		if r.loginProbeUsername != "" && !r.isLegacy() {
+			r.metrics.RecordLoginProbeResult(r.probeLogin(host, port, info),
+				r.attributes(info.Version.Name, resolved))
+		}
+	}
+}
+
+func (r *OpenTelemetryMetricResource) Close() error {
+	if r.metrics == nil {
+		return nil
+	}
+	return r.metrics.Unregister()
+}
+
+// ping performs the configured variant of server list ping, where legacy responses are converted
+func (r *OpenTelemetryMetricResource) ping(host string, port uint16) (*slp.StatusResponse, error) {
+	if r.isLegacy() {
+		response, _, err := slp.LegacyPing(host, int(port), r.timeout, r.slpVariant, &slp.LegacyPingOptions{
+			ProxyVersion: r.proxy.Version,
+			ProxySource:  r.proxy.Source,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return response.StatusResponse(), nil
+	}
+
+	ctx, cancel := r.withTimeout()
+	defer cancel()
+	return slp.Ping(ctx, host, int(port), &slp.PingOptions{
+		ProtocolVersion: r.protocolVersion,
+		ProxyVersion:    r.proxy.Version,
+		ProxySource:     r.proxy.Source,
+		SkipPingPong:    r.skipPingPong,
+	})
+}
+
+// isLegacy indicates if the slp variant is one of the legacy server list pings
+func (r *OpenTelemetryMetricResource) isLegacy() bool {
+	return r.slpVariant != "" && r.slpVariant != "modern"
+}
+
+// withTimeout returns a context bounded by the timeout, if any
+func (r *OpenTelemetryMetricResource) withTimeout() (context.Context, context.CancelFunc) {
+	if r.timeout > 0 {
+		return context.WithTimeout(context.Background(), r.timeout)
+	}
+	return context.WithCancel(context.Background())
+}
+
+// attributes returns the attributes of each metric of the server along with its labels, where the version is
+// left out when dropped
+func (r *OpenTelemetryMetricResource) attributes(version string, resolvedAddress string) []attribute.KeyValue {
+	attributes := buildMetricAttributes(r.host, r.port, r.edition, version, resolvedAddress)
+	if r.dropVersion {
+		attributes = slices.DeleteFunc(attributes, func(kv attribute.KeyValue) bool {
+			return kv.Key == serverVersionAttribute
+		})
+	}
+	return r.withLabels(attributes)
+}
+
+// serverAttributes returns the attributes identifying the server along with its labels, which exclude the
+// version and resolved address for metrics that accumulate across pings
+func (r *OpenTelemetryMetricResource) serverAttributes() []attribute.KeyValue {
+	return r.withLabels([]attribute.KeyValue{
+		attribute.String(serverHostAttribute, r.host),
+		attribute.String(serverPortAttribute, strconv.Itoa(int(r.port))),
+		attribute.String(serverEditionAttribute, string(r.edition)),
+	})
+}
+
+// withLabels appends the labels given to the target, in order of their names, to the given attributes
+func (r *OpenTelemetryMetricResource) withLabels(attributes []attribute.KeyValue) []attribute.KeyValue {
+	for _, name := range slices.Sorted(maps.Keys(r.labels)) {
+		attributes = append(attributes, attribute.String(name, r.labels[name]))
+	}
+	return attributes
+}
+
+// probeLogin returns the classified result of the login probe or loginProbeErrorResult
+func (r *OpenTelemetryMetricResource) probeLogin(host string, port uint16, info *slp.StatusResponse) string {
+	ctx, cancel := r.withTimeout()
+	defer cancel()
+	response, err := slp.ProbeLogin(ctx, host, int(port), &slp.LoginOptions{
+		ProtocolVersion: int32(info.Version.Protocol),
+		Username:        r.loginProbeUsername,
+		ProxyVersion:    r.proxy.Version,
+		ProxySource:     r.proxy.Source,
+	})
+	if err != nil {
+		r.logger.Debug("login probe failed", zap.String("host", r.host), zap.Error(err))
+		return loginProbeErrorResult
+	}
+	return string(response.Result)
+}
+
+func (r *OpenTelemetryMetricResource) executeBedrock() {
+	startTime := time.Now()
+	info, err := bedrock.Ping(net.JoinHostPort(r.host, strconv.Itoa(int(r.port))), r.timeout, &bedrock.PingOptions{
+		UseProxy:    r.proxy.Enabled(),
+		ProxySource: r.proxy.Source,
+	})
+	r.logger.Debug("ping returned", zap.Error(err), zap.Any("info", info))
+
+	if r.metrics != nil {
+		if err != nil {
+			// failed pings are recorded too, so that the count of the histogram includes them
+			r.metrics.RecordLatency(r.edition, time.Since(startTime), r.serverAttributes())
+			r.metrics.RecordUnhealthy(r.attributes("", ""))
 			return
 		}
 
-		r.metrics.RecordResponseTime(elapsed.Seconds(), buildMetricAttributes(r.host, r.port, r.edition, info.Version.Name))
-		r.metrics.RecordHealth(true, buildMetricAttributes(r.host, r.port, r.edition, info.Version.Name))
-		r.metrics.RecordPlayersOnlineCount(info.Players.Online, buildMetricAttributes(r.host, r.port, r.edition, info.Version.Name))
-		r.metrics.RecordPlayersMaxCount(info.Players.Max, buildMetricAttributes(r.host, r.port, r.edition, info.Version.Name))
+		r.metrics.RecordLatency(r.edition, info.Rtt, r.serverAttributes())
+		r.metrics.RecordResponseTime(info.Rtt.Seconds(), r.attributes(info.Version, ""))
+		r.metrics.RecordHealth(true, r.attributes(info.Version, ""))
+		r.metrics.RecordPlayersOnlineCount(int32(info.Players), r.attributes(info.Version, ""))
+		r.metrics.RecordPlayersMaxCount(int32(info.MaxPlayers), r.attributes(info.Version, ""))
+		r.metrics.RecordInfo(r.withLabels(buildInfoAttributes(r.host, r.port, r.edition, info.Version, "",
+			info.ProtocolVersion, info.ServerName)))
+		r.metrics.RecordBedrockInfo(r.withLabels(buildBedrockInfoAttributes(r.host, r.port, info)))
+	}
+}
+
+// resolve returns the host and port to ping along with the [host:port] found via SRV lookup,
+// which is empty when no record was used
+func (r *OpenTelemetryMetricResource) resolve() (string, uint16, string) {
+	if !r.srvLookup {
+		return r.host, r.port, ""
+	}
+	host, port, found := utils.ResolveJavaServer(context.Background(), r.resolver, r.host, r.port)
+	if !found {
+		return r.host, r.port, ""
 	}
+	return host, port, net.JoinHostPort(host, strconv.Itoa(int(port)))
 }
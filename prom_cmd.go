@@ -5,25 +5,49 @@ import (
 	"flag"
 	"github.com/google/subcommands"
 	"github.com/itzg/go-flagsfiller"
+	"github.com/itzg/mc-monitor/config"
+	"github.com/itzg/mc-monitor/discovery"
+	"github.com/itzg/mc-monitor/rcon"
+	"github.com/itzg/mc-monitor/slp"
+	"github.com/itzg/mc-monitor/utils"
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.uber.org/zap"
 	"log"
 	"net/http"
 	"strconv"
+	"sync"
 	"time"
 )
 
 const promExportPath = "/metrics"
 
 type exportPrometheusCmd struct {
-	Servers        []string      `usage:"one or more [host:port] addresses of Java servers to monitor, when port is omitted 25565 is used"`
-	BedrockServers []string      `usage:"one or more [host:port] addresses of Bedrock servers to monitor, when port is omitted 19132 is used"`
-	Port           int           `usage:"HTTP port where Prometheus metrics are exported" default:"8080"`
-	Timeout        time.Duration `usage:"timeout when checking each servers" default:"60s" env:"TIMEOUT"`
-	UseProxy       bool          `usage:"supports contacting servers when proxy_protocol is enabled"`
-	ProxyVersion   uint          `usage:"version of PROXY protocol to use" default:"1"`
-	logger         *zap.Logger
+	Config             string                     `usage:"path of a YAML or JSON configuration file declaring targets, defaults, and sink settings, where flags take precedence over the file"`
+	Servers            []string                   `usage:"one or more [host:port] addresses or java:// URIs of Java servers to monitor, when port is omitted 25565 is used. See the README for the options of URIs"`
+	BedrockServers     []string                   `usage:"one or more [host:port] addresses or bedrock:// URIs of Bedrock servers to monitor, when port is omitted 19132 is used"`
+	Port               int                        `usage:"HTTP port where Prometheus metrics are exported" default:"8080"`
+	Timeout            time.Duration              `usage:"timeout when checking each servers" default:"60s" env:"TIMEOUT"`
+	Concurrency        int                        `usage:"number of servers pinged at the same time by each scrape, or in the background with poll-interval, where scrapes complete within the scrape timeout given by Prometheus" default:"10"`
+	PollInterval       time.Duration              `usage:"pings the servers in the background at this interval and serves scrapes from the last results, where zero pings the servers during each scrape"`
+	Staleness          time.Duration              `usage:"age of the last results of a server polled in the background after which it is reported as not healthy, where zero is three times the poll interval"`
+	UseProxy           bool                       `usage:"supports contacting servers when proxy_protocol is enabled"`
+	ProxyVersion       uint                       `usage:"version of PROXY protocol to use for Java servers, where Bedrock servers always use version 2" default:"1"`
+	ProxySource        string                     `usage:"[ip:port] reported as the client address in the PROXY protocol header instead of the local address"`
+	SkipSrvLookup      bool                       `usage:"skips resolving the _minecraft._tcp SRV record of Java servers given without a port"`
+	SkipPingPong       bool                       `usage:"skips the ping/pong exchange after the status of Java servers, which leaves out minecraft_status_ping_pong_seconds"`
+	ExportModInfo      bool                       `usage:"exports minecraft_status_mod_info with a series for each mod reported by Forge and NeoForge servers"`
+	LoginProbe         bool                       `usage:"attempts a login with an offline username to export minecraft_login_probe_result"`
+	LoginProbeUsername string                     `default:"mcmonitor" usage:"offline username sent by the login probe"`
+	ProtocolVersion    int                        `usage:"protocol version sent in the handshake to export minecraft_status_protocol_supported for Java servers"`
+	DropVersionLabel   bool                       `usage:"drops the server_version label from all metrics but minecraft_status_info and minecraft_status_bedrock_info, so that upgrades and failed pings don't start new series"`
+	ClientVersion      string                     `usage:"release of the client, such as 1.20.4, whose protocol version is sent in the handshake to export minecraft_status_protocol_supported"`
+	NativeHistograms   bool                       `usage:"adds the buckets of Prometheus native histograms, which grow exponentially, to the latency histograms"`
+	Latency            utils.LatencyConfig        `group:"latency" namespace:"latency" usage:"latency histograms"`
+	Rcon               rcon.Config                `group:"rcon" namespace:"rcon" usage:"RCON command metrics"`
+	Kubernetes         discovery.KubernetesConfig `group:"kubernetes" namespace:"kubernetes" usage:"Kubernetes service discovery"`
+	Docker             discovery.DockerConfig     `group:"docker" namespace:"docker" usage:"Docker container discovery"`
+	FileSD             discovery.FileSDConfig     `group:"file-sd" namespace:"file-sd" usage:"Prometheus file_sd discovery"`
+	logger             *zap.Logger
 }
 
 func (c *exportPrometheusCmd) Name() string {
@@ -46,36 +70,146 @@ func (c *exportPrometheusCmd) SetFlags(f *flag.FlagSet) {
 	}
 }
 
-func (c *exportPrometheusCmd) Execute(_ context.Context, _ *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
-	if (len(c.Servers) + len(c.BedrockServers)) == 0 {
-		printUsageError("requires at least one server")
+func (c *exportPrometheusCmd) Execute(ctx context.Context, flags *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
+	flagTargets, err := utils.ParseServerLists(c.Servers, c.BedrockServers)
+	if err != nil {
+		printUsageError(err.Error())
 		return subcommands.ExitUsageError
 	}
 
+	// the command may start without targets since they can be added while running or probed via promProbePath
+	var cfg *config.File
+	if c.Config != "" {
+		cfg, err = config.Load(c.Config)
+		if err != nil {
+			printUsageError(err.Error())
+			return subcommands.ExitUsageError
+		}
+		if err := cfg.ApplyFlags(flags, config.SinkPrometheus); err != nil {
+			printUsageError(err.Error())
+			return subcommands.ExitUsageError
+		}
+	}
+
 	logger := args[0].(*zap.Logger)
 
-	collectors, err := newPromCollectors(c.Servers, c.BedrockServers, c.UseProxy, c.ProxyVersion, logger)
+	protocolVersion, err := slp.ResolveProtocolVersion(c.ProtocolVersion, c.ClientVersion)
+	if err != nil {
+		printUsageError(err.Error())
+		return subcommands.ExitUsageError
+	}
+
+	proxySource, err := utils.ParseProxySource(c.ProxySource)
 	if err != nil {
+		printUsageError(err.Error())
+		return subcommands.ExitUsageError
+	}
+
+	latencyBuckets, err := c.Latency.ParseBuckets()
+	if err != nil {
+		printUsageError(err.Error())
+		return subcommands.ExitUsageError
+	}
+
+	options := promCollectorOptions{
+		timeout:          c.Timeout,
+		useProxy:         c.UseProxy,
+		proxyVersion:     c.ProxyVersion,
+		proxySource:      proxySource,
+		skipSrvLookup:    c.SkipSrvLookup,
+		skipPingPong:     c.SkipPingPong,
+		exportModInfo:    c.ExportModInfo,
+		protocolVersion:  protocolVersion,
+		dropVersionLabel: c.DropVersionLabel,
+		latencyBuckets:   latencyBuckets,
+		nativeHistograms: c.NativeHistograms,
+	}
+	if c.LoginProbe {
+		options.loginProbeUsername = c.LoginProbeUsername
+	}
+
+	discoverers, err := discovery.NewDiscoverers(logger, &c.Kubernetes, &c.Docker, &c.FileSD)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var targets utils.TargetSet[specificPromCollector]
+	var sources discovery.Targets
+	var targetsMu sync.Mutex
+	targetCollectors := &promTargetCollectors{concurrency: c.Concurrency}
+	var poller *promPoller
+	if c.PollInterval > 0 {
+		poller = newPromPoller(ctx, c.PollInterval, c.Staleness, c.Concurrency)
+	}
+	// updateTargets replaces the targets of the given source, which may be called by each source concurrently
+	updateTargets := func(source string, sourceTargets []*utils.Target) error {
+		targetsMu.Lock()
+		defer targetsMu.Unlock()
+		changes, err := targets.Update(sources.Set(source, sourceTargets),
+			func(added []*utils.Target) ([]specificPromCollector, error) {
+				return newPromCollectors(added, options, logger)
+			})
+		if err != nil {
+			return err
+		}
+		changes.Log(logger)
+		collectors := promCollectors(targets.Values())
+		if poller != nil {
+			collectors = poller.set(collectors)
+		}
+		targetCollectors.set(collectors)
+		return nil
+	}
+	if err := updateTargets(discovery.FlagsSource, flagTargets); err != nil {
 		log.Fatal(err)
 	}
+	if cfg != nil {
+		if err := updateTargets(discovery.ConfigSource, cfg.TargetSpecs()); err != nil {
+			log.Fatal(err)
+		}
+	}
 
-	for i := range collectors {
-		collectors[i].SetTimeout(c.Timeout)
+	probeHandler := newPromProbeHandler(options, logger)
+	if cfg != nil {
+		probeHandler.setModules(cfg.Modules)
+		go config.Watch(ctx, cfg, config.NotifyReload(), logger, func(cfg *config.File) {
+			probeHandler.setModules(cfg.Modules)
+			if err := updateTargets(discovery.ConfigSource, cfg.TargetSpecs()); err != nil {
+				logger.Error("failed to apply the reloaded targets", zap.Error(err))
+			}
+		})
 	}
+	discovery.Run(ctx, discoverers, func(source string, discovered []*utils.Target) {
+		if err := updateTargets(source, discovered); err != nil {
+			logger.Error("failed to apply the discovered targets", zap.String("source", source), zap.Error(err))
+		}
+	}, logger)
 
-	err = prometheus.Register(collectors)
+	rconPollers, err := c.Rcon.NewPollers(logger.Named("rcon"))
 	if err != nil {
 		log.Fatal(err)
 	}
+	if len(rconPollers) > 0 {
+		err = prometheus.Register(newPromRconCollector(rconPollers, logger))
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, poller := range rconPollers {
+			go poller.Run(ctx, c.Rcon.Interval)
+		}
+	}
 
 	exportAddress := ":" + strconv.Itoa(c.Port)
 
 	logger.Info("exporting metrics for prometheus",
 		zap.String("address", exportAddress),
 		zap.String("path", promExportPath),
+		zap.String("probePath", promProbePath),
+		zap.Duration("pollInterval", c.PollInterval),
 	)
 
-	http.Handle(promExportPath, promhttp.Handler())
+	http.Handle(promExportPath, newPromMetricsHandler(targetCollectors))
+	http.Handle(promProbePath, probeHandler)
 	log.Fatal(http.ListenAndServe(exportAddress, nil))
 
 	// never actually returns from ListenAndServe, so just satisfy return value
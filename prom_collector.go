@@ -1,12 +1,20 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net"
+	"net/netip"
+	"slices"
 	"strconv"
+	"sync"
 	"time"
 
-	mcpinger "github.com/Raqbit/mc-pinger"
+	"github.com/itzg/mc-monitor/bedrock"
+	"github.com/itzg/mc-monitor/chat"
+	"github.com/itzg/mc-monitor/slp"
+	"github.com/itzg/mc-monitor/utils"
 	"github.com/prometheus/client_golang/prometheus"
 	"go.uber.org/zap"
 )
@@ -16,61 +24,263 @@ const (
 	promLabelPort    = "server_port"
 	promLabelEdition = "server_edition"
 	promLabelVersion = "server_version"
+	// promLabelResolvedAddress is the [host:port] found via SRV lookup of Java servers, if any
+	promLabelResolvedAddress = "server_resolved_address"
+	promLabelModId           = "mod_id"
+	promLabelModVersion      = "mod_version"
+	promLabelLoginResult     = "result"
+	promLabelProtocol        = "protocol_version"
+	// promLabelRequestedProtocol is the protocol version sent in the handshake
+	promLabelRequestedProtocol = "requested_protocol_version"
+	promLabelUnhealthyReason   = "reason"
+	promLabelMotd              = "motd"
+)
+
+// Reasons of minecraft_status_unhealthy_reason
+const (
+	// promReasonTimeout is when the ping or the scrape timed out before the server responded
+	promReasonTimeout = "timeout"
+	promReasonError   = "error"
+	// promReasonNotReady is when a Java server responds without accepting any players, such as while starting
+	promReasonNotReady = "not_ready"
+	// promReasonStale is when the last result of a server polled in the background is too old
+	promReasonStale = "stale"
+)
+
+// Native histograms grow their buckets by the factor, where the resolution is reduced beyond the max buckets
+const (
+	promNativeHistogramBucketFactor = 1.1
+	promNativeHistogramMaxBuckets   = 160
+)
+
+// promLoginProbeError is the login probe result when the reply could not be classified
+const promLoginProbeError = "error"
+
+// Labels of minecraft_status_bedrock_info
+const (
+	promLabelBedrockEdition         = "bedrock_edition"
+	promLabelBedrockProtocol        = "protocol_version"
+	promLabelBedrockServerGuid      = "server_guid"
+	promLabelBedrockLevelName       = "level_name"
+	promLabelBedrockGameMode        = "game_mode"
+	promLabelBedrockGameModeId      = "game_mode_id"
+	promLabelBedrockPortIPv4        = "port_ipv4"
+	promLabelBedrockPortIPv6        = "port_ipv6"
+	promLabelBedrockNintendoLimited = "nintendo_limited"
 )
 
 var (
-	promVariableLabels = []string{promLabelHost, promLabelPort, promLabelEdition, promLabelVersion}
-	promDescHealthy    = prometheus.NewDesc("minecraft_status_healthy",
-		"Indicates if the server is healthy (1) or not (0)",
-		promVariableLabels, nil)
-	promDescResponseTime = prometheus.NewDesc("minecraft_status_response_time_seconds",
-		"Amount of time it took for server to respond",
-		promVariableLabels, nil)
-	promDescPlayersOnline = prometheus.NewDesc("minecraft_status_players_online_count",
-		"Number of players currently online",
-		promVariableLabels, nil)
-	promDescPlayersMax = prometheus.NewDesc("minecraft_status_players_max_count",
-		"Maximum number of players allowed by the server",
-		promVariableLabels, nil)
+	promVariableLabels = []string{promLabelHost, promLabelPort, promLabelEdition, promLabelVersion, promLabelResolvedAddress}
+	// promVersionlessDescs are the variants without the version label of the descs created by newPromDesc
+	promVersionlessDescs = make(map[*prometheus.Desc]*prometheus.Desc)
+	promDescHealthy      = newPromDesc("minecraft_status_healthy",
+		"Indicates if the server is healthy (1) or not (0)")
+	promDescUnhealthyReason = newPromDesc("minecraft_status_unhealthy_reason",
+		"Has the value 1 with the reason the server is not healthy", promLabelUnhealthyReason)
+	// promDescLastProbe excludes the version and resolved address since those are unknown when the result is stale
+	promDescLastProbe = prometheus.NewDesc("minecraft_status_last_probe_timestamp_seconds",
+		"Time of the last ping of a server polled in the background, as seconds since the Unix epoch",
+		[]string{promLabelHost, promLabelPort, promLabelEdition}, nil)
+	promDescResponseTime = newPromDesc("minecraft_status_response_time_seconds",
+		"Amount of time it took for server to respond")
+	promDescDnsLookup = newPromDesc("minecraft_status_dns_lookup_seconds",
+		"Amount of time it took to resolve the address of Java servers, including any SRV lookup")
+	promDescConnect = newPromDesc("minecraft_status_connect_seconds",
+		"Amount of time it took to establish the TCP connection to Java servers")
+	promDescHandshake = newPromDesc("minecraft_status_handshake_seconds",
+		"Amount of time from sending the handshake until the status response of Java servers was received")
+	promDescPingPong = newPromDesc("minecraft_status_ping_pong_seconds",
+		"Round trip time of the ping/pong exchange, which the client shows as the latency of Java servers")
+	promDescPlayersOnline = newPromDesc("minecraft_status_players_online_count",
+		"Number of players currently online")
+	promDescPlayersMax = newPromDesc("minecraft_status_players_max_count",
+		"Maximum number of players allowed by the server")
+	promDescModsCount = newPromDesc("minecraft_status_mods_count",
+		"Number of mods reported by Forge and NeoForge servers")
+	promDescModInfo = newPromDesc("minecraft_status_mod_info",
+		"Has the value 1 for each mod reported by Forge and NeoForge servers", promLabelModId, promLabelModVersion)
+	// promDescFaviconChanged excludes the version and resolved address since those may change along with the favicon
+	promDescFaviconChanged = prometheus.NewDesc("minecraft_status_favicon_changed_total",
+		"Number of times the favicon reported by the server has changed since monitoring started",
+		[]string{promLabelHost, promLabelPort, promLabelEdition}, nil)
+	promDescLoginProbeResult = newPromDesc("minecraft_login_probe_result",
+		"Indicates with 1 the result of attempting a login with an offline username and 0 for the other results",
+		promLabelLoginResult)
+	promDescProtocolSupported = newPromDesc("minecraft_status_protocol_supported",
+		"Indicates if the server accepts (1) or not (0) clients of the requested protocol version",
+		promLabelRequestedProtocol)
+	// promLatencyHistograms are the latency histograms of each edition, which have a name of their own since the
+	// buckets of each edition differ. Their labels exclude the version and resolved address, so that the
+	// observations accumulate across upgrades.
+	promLatencyHistograms = map[utils.ServerEdition]prometheus.HistogramOpts{
+		utils.JavaEdition: {
+			Name: "minecraft_status_java_latency_seconds",
+			Help: "Distribution of the time it took Java servers to respond, including connecting and the handshake",
+		},
+		utils.BedrockEdition: {
+			Name: "minecraft_status_bedrock_latency_seconds",
+			Help: "Distribution of the round trip time of the ping of Bedrock servers",
+		},
+	}
+	promLatencyLabels      = []string{promLabelHost, promLabelPort, promLabelEdition}
+	promDescJavaLatency    = newPromLatencyDesc(utils.JavaEdition)
+	promDescBedrockLatency = newPromLatencyDesc(utils.BedrockEdition)
+	// promDescInfo always has the version label, so that it can be joined with metrics that drop it
+	promDescInfo = prometheus.NewDesc("minecraft_status_info",
+		"Has the value 1 with labels describing the version, protocol, and message of the day reported by the server",
+		append(append([]string{}, promVariableLabels...), promLabelProtocol, promLabelMotd), nil)
+	promDescBedrockInfo = prometheus.NewDesc("minecraft_status_bedrock_info",
+		"Has the value 1 with labels describing the details reported by Bedrock and Education Edition servers",
+		append(append([]string{}, promVariableLabels...),
+			promLabelBedrockEdition, promLabelBedrockProtocol, promLabelBedrockServerGuid,
+			promLabelBedrockLevelName, promLabelBedrockGameMode, promLabelBedrockGameModeId,
+			promLabelBedrockPortIPv4, promLabelBedrockPortIPv6, promLabelBedrockNintendoLimited,
+		), nil)
 )
 
+// newPromDesc creates the desc of a metric with the variable labels and the given extra labels, along with its
+// variant without the version label for when that is dropped
+func newPromDesc(name string, help string, extraLabels ...string) *prometheus.Desc {
+	desc := prometheus.NewDesc(name, help, append(append([]string{}, promVariableLabels...), extraLabels...), nil)
+	versionless := slices.DeleteFunc(slices.Clone(promVariableLabels), func(label string) bool {
+		return label == promLabelVersion
+	})
+	promVersionlessDescs[desc] = prometheus.NewDesc(name, help, append(versionless, extraLabels...), nil)
+	return desc
+}
+
+func newPromLatencyDesc(edition utils.ServerEdition) *prometheus.Desc {
+	opts := promLatencyHistograms[edition]
+	return prometheus.NewDesc(opts.Name, opts.Help, promLatencyLabels, nil)
+}
+
+// newPromLatencyHistogram creates the latency histogram of the given target of the edition, which is kept by its
+// collector so that the observations accumulate across scrapes
+func newPromLatencyHistogram(edition utils.ServerEdition, target *utils.Target, options promCollectorOptions) prometheus.Histogram {
+	opts := promLatencyHistograms[edition]
+	opts.Buckets = options.latencyBuckets[edition]
+	if options.nativeHistograms {
+		opts.NativeHistogramBucketFactor = promNativeHistogramBucketFactor
+		opts.NativeHistogramMaxBucketNumber = promNativeHistogramMaxBuckets
+		opts.NativeHistogramMinResetDuration = time.Hour
+	}
+	// the histogram is created with variable labels, so that its desc matches the one described by promCollectors
+	return prometheus.NewHistogramVec(opts, promLatencyLabels).
+		WithLabelValues(target.Host, strconv.Itoa(int(target.Port)), string(edition)).(prometheus.Histogram)
+}
+
+// newPromServerMetric creates a gauge of a server with the given variable and extra label values, where the
+// version label is left out when dropped and the desc has a variant without it
+func newPromServerMetric(desc *prometheus.Desc, value float64, dropVersionLabel bool,
+	host string, port uint16, edition utils.ServerEdition, version string, resolvedAddress string,
+	extraLabelValues ...string) (prometheus.Metric, error) {
+
+	labelValues := []string{host, strconv.Itoa(int(port)), string(edition)}
+	if versionless, exists := promVersionlessDescs[desc]; dropVersionLabel && exists {
+		desc = versionless
+	} else {
+		labelValues = append(labelValues, version)
+	}
+	labelValues = append(append(labelValues, resolvedAddress), extraLabelValues...)
+	return prometheus.NewConstMetric(desc, prometheus.GaugeValue, value, labelValues...)
+}
+
 type pingOptions interface {
 	GetHost() string
 	GetPort() uint16
 	GetTimeout() time.Duration
 	GetUseProxy() bool
 	GetProxyVersion() byte
+	GetProxySource() netip.AddrPort
+	// GetProtocolVersion returns the protocol version to send in the handshake or zero for the default
+	GetProtocolVersion() int32
+	// GetSlpVariant returns the variant of server list ping, where empty or modern is the ping of 1.7 and newer
+	GetSlpVariant() string
+	// GetSkipPingPong indicates if the ping/pong exchange that follows the status response is skipped
+	GetSkipPingPong() bool
 }
 
-func javaPingerOptions(opt pingOptions) []mcpinger.McPingerOption {
-	var opts []mcpinger.McPingerOption
-	if t := opt.GetTimeout(); t > 0 {
-		opts = append(opts, mcpinger.WithTimeout(t))
+func javaPingOptions(opt pingOptions) *slp.PingOptions {
+	options := &slp.PingOptions{
+		ProtocolVersion: opt.GetProtocolVersion(),
+		SkipPingPong:    opt.GetSkipPingPong(),
 	}
 	if opt.GetUseProxy() {
-		opts = append(opts, mcpinger.WithProxyProto(opt.GetProxyVersion()))
+		options.ProxyVersion = opt.GetProxyVersion()
+		options.ProxySource = opt.GetProxySource()
 	}
-	return opts
+	return options
 }
 
-func pingJavaServer(opt pingOptions) (*mcpinger.ServerInfo, error) {
-	opts := javaPingerOptions(opt)
-	pinger := mcpinger.New(opt.GetHost(), opt.GetPort(), opts...)
-	return pinger.Ping()
+func pingJavaServer(opt pingOptions) (*slp.StatusResponse, error) {
+	if isLegacySlpVariant(opt.GetSlpVariant()) {
+		legacyOptions := &slp.LegacyPingOptions{}
+		if opt.GetUseProxy() {
+			legacyOptions.ProxyVersion = opt.GetProxyVersion()
+			legacyOptions.ProxySource = opt.GetProxySource()
+		}
+		response, _, err := slp.LegacyPing(opt.GetHost(), int(opt.GetPort()), opt.GetTimeout(), opt.GetSlpVariant(), legacyOptions)
+		if err != nil {
+			return nil, err
+		}
+		return response.StatusResponse(), nil
+	}
+
+	ctx, cancel := withOptionalTimeout(context.Background(), opt.GetTimeout())
+	defer cancel()
+	return slp.Ping(ctx, opt.GetHost(), int(opt.GetPort()), javaPingOptions(opt))
+}
+
+// isLegacySlpVariant indicates if the given variant of a target is one of the legacy server list pings
+func isLegacySlpVariant(variant string) bool {
+	return variant != "" && variant != slpVariantModern
 }
 
 type specificPromCollector interface {
 	Collect(metrics chan<- prometheus.Metric)
+	// CollectWithin pings the server like Collect, but gives up after the given timeout when that is shorter than
+	// the timeout of the collector, such as when less time is left of a scrape
+	CollectWithin(metrics chan<- prometheus.Metric, timeout time.Duration)
+	// CollectUnhealthy reports the server as not healthy for the given reason without pinging it
+	CollectUnhealthy(metrics chan<- prometheus.Metric, reason string)
 	SetTimeout(t time.Duration)
+	// Server returns the address and edition of the server, which label the metrics that don't depend on a ping
+	Server() (host string, port uint16, edition utils.ServerEdition)
+	// Labels returns the labels given to the target of the collector, if any
+	Labels() map[string]string
+}
+
+// promUnhealthyReason returns the reason of a failed ping
+func promUnhealthyReason(err error) string {
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return promReasonTimeout
+	}
+	return promReasonError
 }
 
 type promCollectors []specificPromCollector
 
 func (promCollectors) Describe(descs chan<- *prometheus.Desc) {
 	descs <- promDescHealthy
+	descs <- promDescUnhealthyReason
+	descs <- promDescLastProbe
 	descs <- promDescResponseTime
+	descs <- promDescDnsLookup
+	descs <- promDescConnect
+	descs <- promDescHandshake
+	descs <- promDescPingPong
 	descs <- promDescPlayersOnline
 	descs <- promDescPlayersMax
+	descs <- promDescModsCount
+	descs <- promDescModInfo
+	descs <- promDescFaviconChanged
+	descs <- promDescJavaLatency
+	descs <- promDescBedrockLatency
+	descs <- promDescInfo
+	descs <- promDescBedrockInfo
+	descs <- promDescLoginProbeResult
+	descs <- promDescProtocolSupported
 }
 
 func (c promCollectors) Collect(metrics chan<- prometheus.Metric) {
@@ -79,57 +289,189 @@ func (c promCollectors) Collect(metrics chan<- prometheus.Metric) {
 	}
 }
 
-func newPromCollectors(servers []string, bedrockServers []string, useProxy bool, proxyVersion uint, logger *zap.Logger) (promCollectors, error) {
-	var collectors []specificPromCollector
+// register registers the collectors with the given registerer, where the labels given to targets are
+// added to their metrics
+func (c promCollectors) register(registerer prometheus.Registerer) error {
+	for _, collector := range c.labeled() {
+		if err := registerer.Register(collector); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	if useProxy && proxyVersion != 1 && proxyVersion != 2 {
-		return nil, fmt.Errorf("proxy version must be 1 or 2")
+// labeled returns the collectors with the labels given to targets added to their metrics
+func (c promCollectors) labeled() []prometheus.Collector {
+	labelSets := c.labelSets()
+	if labelSets == nil {
+		return []prometheus.Collector{c}
 	}
 
-	javaCollectors, err := createPromCollectors(servers, JavaEdition, useProxy, byte(proxyVersion), logger)
-	if err != nil {
-		return nil, err
+	// collectors with the same label values are grouped together since each group needs distinct descriptors
+	var groupKeys []string
+	groups := make(map[string]promCollectors)
+	groupLabels := make(map[string]prometheus.Labels)
+	for i, entry := range c {
+		key := fmt.Sprint(labelSets[i])
+		if _, exists := groups[key]; !exists {
+			groupKeys = append(groupKeys, key)
+			groupLabels[key] = labelSets[i]
+		}
+		groups[key] = append(groups[key], entry)
 	}
-	collectors = append(collectors, javaCollectors...)
 
-	bedrockCollectors, err := createPromCollectors(bedrockServers, BedrockEdition, false, 0, logger)
-	if err != nil {
-		return nil, err
+	collectors := make([]prometheus.Collector, 0, len(groupKeys))
+	for _, key := range groupKeys {
+		collectors = append(collectors, prometheus.WrapCollectorWith(groupLabels[key], groups[key]))
 	}
-	collectors = append(collectors, bedrockCollectors...)
+	return collectors
+}
 
-	return collectors, nil
+// labelSets returns the labels added to the metrics of each collector, which is nil when no target was given
+// labels. Since metrics of the same name must have the same label names, every label name given to any target
+// is added to all metrics, with an empty value for targets that did not give it.
+func (c promCollectors) labelSets() []prometheus.Labels {
+	var labelNames []string
+	for _, entry := range c {
+		for name := range entry.Labels() {
+			if !slices.Contains(labelNames, name) {
+				labelNames = append(labelNames, name)
+			}
+		}
+	}
+	if len(labelNames) == 0 {
+		return nil
+	}
+
+	labelSets := make([]prometheus.Labels, 0, len(c))
+	for _, entry := range c {
+		labels := make(prometheus.Labels, len(labelNames))
+		for _, name := range labelNames {
+			labels[name] = entry.Labels()[name]
+		}
+		labelSets = append(labelSets, labels)
+	}
+	return labelSets
 }
 
-func createPromCollectors(servers []string, edition ServerEdition, useProxy bool, proxyVersion byte, logger *zap.Logger) (collectors []specificPromCollector, err error) {
-	for _, server := range servers {
-		switch edition {
+// promTargetCollectors holds the collectors of the targets, which can be replaced when the targets are
+// reloaded. It is an unchecked collector, which describes no metrics, since the label names given to
+// targets may change with each reload.
+type promTargetCollectors struct {
+	// concurrency is the number of targets pinged at the same time by each scrape
+	concurrency int
 
-		case JavaEdition:
-			host, port, err := SplitHostPort(server, DefaultJavaPort)
-			if err != nil {
-				return nil, fmt.Errorf("failed to process server entry '%s': %w", server, err)
-			}
-			collectors = append(collectors, newPromJavaCollector(host, port, useProxy, proxyVersion, logger))
+	mu         sync.RWMutex
+	collectors promCollectors
+	labelSets  []prometheus.Labels
+}
+
+func (t *promTargetCollectors) Describe(chan<- *prometheus.Desc) {
+}
+
+// Collect collects every target without a deadline
+func (t *promTargetCollectors) Collect(metrics chan<- prometheus.Metric) {
+	t.scrape(time.Time{}).Collect(metrics)
+}
+
+// scrape returns the current targets to collect until the given deadline, where zero has no deadline
+func (t *promTargetCollectors) scrape(deadline time.Time) *promScrape {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return &promScrape{
+		collectors:  t.collectors,
+		labelSets:   t.labelSets,
+		concurrency: t.concurrency,
+		deadline:    deadline,
+	}
+}
+
+// set replaces the collectors of the targets
+func (t *promTargetCollectors) set(collectors promCollectors) {
+	labelSets := collectors.labelSets()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.collectors = collectors
+	t.labelSets = labelSets
+}
+
+// promCollectorOptions are the options applied to the collector of each server, where all but the
+// timeout and PROXY protocol options only apply to Java servers. The options given to a target take precedence.
+type promCollectorOptions struct {
+	timeout      time.Duration
+	useProxy     bool
+	proxyVersion uint
+	// proxySource is reported as the client address in PROXY headers, when valid
+	proxySource   netip.AddrPort
+	skipSrvLookup bool
+	exportModInfo bool
+	// loginProbeUsername enables the login probe when non-empty
+	loginProbeUsername string
+	// protocolVersion is sent in the handshake to check if servers accept clients of that version when non-zero
+	protocolVersion int32
+	// skipPingPong skips the ping/pong exchange that follows the status response
+	skipPingPong bool
+	// dropVersionLabel drops the version label from all metrics but the info metrics
+	dropVersionLabel bool
+	// latencyBuckets are the buckets of the latency histogram of each edition, where the default buckets of
+	// Prometheus are used when not given
+	latencyBuckets utils.LatencyBuckets
+	// nativeHistograms adds the buckets of native histograms to the latency histograms
+	nativeHistograms bool
+}
+
+// newPromCollectors creates a collector for each of the given targets
+func newPromCollectors(targets []*utils.Target, options promCollectorOptions, logger *zap.Logger) (promCollectors, error) {
+	if options.useProxy {
+		if err := utils.ValidateProxyVersion(options.proxyVersion); err != nil {
+			return nil, err
+		}
+	}
 
+	collectors := make(promCollectors, 0, len(targets))
+	for _, target := range targets {
+		switch ServerEdition(target.Edition) {
+		case JavaEdition:
+			collectors = append(collectors, newPromJavaCollector(target, options, logger))
 		case BedrockEdition:
-			host, port, err := SplitHostPort(server, DefaultBedrockPort)
-			if err != nil {
-				return nil, fmt.Errorf("failed to process server entry '%s': %w", server, err)
-			}
-			collectors = append(collectors, newPromBedrockCollector(host, port, logger))
+			collectors = append(collectors, newPromBedrockCollector(target, options, logger))
 		}
 	}
-	return
+	return collectors, nil
 }
 
-func newPromJavaCollector(host string, port uint16, useProxy bool, proxyVersion byte, logger *zap.Logger) specificPromCollector {
+// proxyOptions returns the PROXY protocol options of the command with those of the given target applied
+func (o promCollectorOptions) proxyOptions(target *utils.Target) utils.ProxyOptions {
+	defaults := utils.ProxyOptions{Source: o.proxySource}
+	if o.useProxy {
+		defaults.Version = byte(o.proxyVersion)
+	}
+	return target.ProxyOr(defaults)
+}
+
+func newPromJavaCollector(target *utils.Target, options promCollectorOptions, logger *zap.Logger) *promJavaCollector {
+	proxy := options.proxyOptions(target)
+	protocolVersion := options.protocolVersion
+	if target.ProtocolVersion != 0 {
+		protocolVersion = target.ProtocolVersion
+	}
 	return &promJavaCollector{
-		host:         host,
-		port:         port,
-		logger:       logger,
-		useProxy:     useProxy,
-		proxyVersion: proxyVersion,
+		host:               target.Host,
+		port:               target.Port,
+		logger:             logger,
+		timeout:            target.TimeoutOr(options.timeout),
+		useProxy:           proxy.Enabled(),
+		proxyVersion:       proxy.Version,
+		proxySource:        proxy.Source,
+		srvLookup:          !options.skipSrvLookup && !target.ExplicitPort,
+		slpVariant:         target.SlpVariant,
+		labels:             target.Labels,
+		exportModInfo:      options.exportModInfo,
+		protocolVersion:    protocolVersion,
+		skipPingPong:       options.skipPingPong,
+		loginProbeUsername: options.loginProbeUsername,
+		dropVersionLabel:   options.dropVersionLabel,
+		latency:            newPromLatencyHistogram(utils.JavaEdition, target, options),
 	}
 }
 
@@ -140,6 +482,83 @@ type promJavaCollector struct {
 	timeout      time.Duration
 	useProxy     bool
 	proxyVersion byte
+	proxySource  netip.AddrPort
+	srvLookup    bool
+	resolver     utils.Resolver
+	// slpVariant selects a legacy server list ping, when set to other than modern
+	slpVariant string
+	labels     map[string]string
+	// exportModInfo enables a series per mod, which is opt-in since large modpacks have hundreds of mods
+	exportModInfo bool
+	// loginProbeUsername enables the login probe when non-empty
+	loginProbeUsername string
+	// protocolVersion enables checking if the server accepts clients of that version when non-zero
+	protocolVersion int32
+	// skipPingPong skips the ping/pong exchange that follows the status response
+	skipPingPong bool
+	// dropVersionLabel drops the version label from all metrics but the info metrics
+	dropVersionLabel bool
+	favicon          faviconTracker
+	latency          prometheus.Histogram
+}
+
+// faviconTracker counts the changes of a server's favicon across pings, including when it is added or removed
+type faviconTracker struct {
+	mu      sync.Mutex
+	seen    bool
+	hash    string
+	changes uint64
+}
+
+// observe records the hash of the latest favicon and returns the number of changes so far
+func (t *faviconTracker) observe(hash string) uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.seen && hash != t.hash {
+		t.changes++
+	}
+	t.seen = true
+	t.hash = hash
+	return t.changes
+}
+
+// javaPingTarget is a pingOptions that contacts the address resolved for a promJavaCollector within the timeout
+// of the ping
+type javaPingTarget struct {
+	*promJavaCollector
+	host    string
+	port    uint16
+	timeout time.Duration
+}
+
+func (t *javaPingTarget) GetHost() string {
+	return t.host
+}
+
+func (t *javaPingTarget) GetPort() uint16 {
+	return t.port
+}
+
+func (t *javaPingTarget) GetTimeout() time.Duration {
+	return t.timeout
+}
+
+// resolve returns the target to ping within the given timeout along with the resolved address label value,
+// which is empty when no SRV record was used
+func (c *promJavaCollector) resolve(timeout time.Duration) (*javaPingTarget, string) {
+	target := &javaPingTarget{promJavaCollector: c, host: c.host, port: c.port, timeout: timeout}
+	if !c.srvLookup {
+		return target, ""
+	}
+
+	ctx, cancel := withOptionalTimeout(context.Background(), timeout)
+	defer cancel()
+	host, port, found := utils.ResolveJavaServer(ctx, c.resolver, c.host, c.port)
+	if !found {
+		return target, ""
+	}
+	target.host, target.port = host, port
+	return target, net.JoinHostPort(host, strconv.Itoa(int(port)))
 }
 
 func (c *promJavaCollector) GetHost() string {
@@ -162,36 +581,200 @@ func (c *promJavaCollector) GetProxyVersion() byte {
 	return c.proxyVersion
 }
 
+func (c *promJavaCollector) GetProxySource() netip.AddrPort {
+	return c.proxySource
+}
+
+func (c *promJavaCollector) GetProtocolVersion() int32 {
+	return c.protocolVersion
+}
+
+func (c *promJavaCollector) GetSlpVariant() string {
+	return c.slpVariant
+}
+
+func (c *promJavaCollector) GetSkipPingPong() bool {
+	return c.skipPingPong
+}
+
+func (c *promJavaCollector) Server() (string, uint16, utils.ServerEdition) {
+	return c.host, c.port, utils.JavaEdition
+}
+
+func (c *promJavaCollector) Labels() map[string]string {
+	return c.labels
+}
+
 func (c *promJavaCollector) SetTimeout(t time.Duration) {
 	c.timeout = t
 }
 
 func (c *promJavaCollector) Collect(metrics chan<- prometheus.Metric) {
+	c.collect(metrics, c.timeout)
+}
+
+func (c *promJavaCollector) CollectWithin(metrics chan<- prometheus.Metric, timeout time.Duration) {
+	c.collect(metrics, limitTimeout(c.timeout, timeout))
+}
+
+func (c *promJavaCollector) collect(metrics chan<- prometheus.Metric, timeout time.Duration) {
 	c.logger.Debug("pinging", zap.String("host", c.host), zap.String("port", strconv.Itoa(int(c.port))))
+	resolveStart := time.Now()
+	target, resolved := c.resolve(timeout)
+	srvLookup := time.Since(resolveStart)
 	startTime := time.Now()
-	info, err := pingJavaServer(c)
+	info, err := pingJavaServer(target)
 	elapsed := time.Now().Sub(startTime)
+	if err == nil {
+		// the wait for the pong is not part of the response time
+		elapsed = info.ResponseTime(elapsed)
+	}
+	// failed pings are observed too, so that the count of the histogram includes them
+	c.latency.Observe(elapsed.Seconds())
 
 	if err != nil {
-		c.sendMetric(metrics, promDescHealthy, "", 0)
+		c.logger.Debug("failed to ping java server", zap.String("host", c.host), zap.Error(err))
+		c.sendUnhealthy(metrics, "", resolved, promUnhealthyReason(err))
 	} else {
-		c.sendMetric(metrics, promDescResponseTime, info.Version.Name, elapsed.Seconds())
+		c.sendMetric(metrics, promDescResponseTime, info.Version.Name, resolved, elapsed.Seconds())
+		legacy := isLegacySlpVariant(c.slpVariant)
+		// the phases of legacy pings are not measured
+		if !legacy {
+			c.collectTimings(metrics, info, resolved, srvLookup)
+		}
 		if info.Players.Max == 0 { // when server responds to ping but is not fully ready
-			c.sendMetric(metrics, promDescHealthy, info.Version.Name, 0)
+			c.sendUnhealthy(metrics, info.Version.Name, resolved, promReasonNotReady)
 		} else {
-			c.sendMetric(metrics, promDescHealthy, info.Version.Name, 1)
-			c.sendMetric(metrics, promDescPlayersOnline, info.Version.Name, float64(info.Players.Online))
-			c.sendMetric(metrics, promDescPlayersMax, info.Version.Name, float64(info.Players.Max))
+			c.sendMetric(metrics, promDescHealthy, info.Version.Name, resolved, 1)
+			c.sendMetric(metrics, promDescPlayersOnline, info.Version.Name, resolved, float64(info.Players.Online))
+			c.sendMetric(metrics, promDescPlayersMax, info.Version.Name, resolved, float64(info.Players.Max))
+		}
+		c.collectInfo(metrics, info, resolved)
+		c.collectProtocol(metrics, info, resolved)
+		c.collectMods(metrics, info, resolved)
+		c.collectFavicon(metrics, info)
+		// servers old enough to need a legacy ping do not support the login of the probe
+		if c.loginProbeUsername != "" && !legacy {
+			c.collectLoginProbe(metrics, target, info, resolved)
 		}
+	}
+	metrics <- c.latency
+}
+
+func (c *promJavaCollector) CollectUnhealthy(metrics chan<- prometheus.Metric, reason string) {
+	c.sendUnhealthy(metrics, "", "", reason)
+	metrics <- c.latency
+}
+
+func (c *promJavaCollector) sendUnhealthy(metrics chan<- prometheus.Metric, version string, resolved string, reason string) {
+	c.sendMetric(metrics, promDescHealthy, version, resolved, 0)
+	c.sendMetric(metrics, promDescUnhealthyReason, version, resolved, 1, reason)
+}
+
+func (c *promJavaCollector) collectLoginProbe(metrics chan<- prometheus.Metric, target *javaPingTarget, info *slp.StatusResponse, resolved string) {
+	ctx, cancel := withOptionalTimeout(context.Background(), target.timeout)
+	defer cancel()
+	options := &slp.LoginOptions{
+		ProtocolVersion: int32(info.Version.Protocol),
+		Username:        c.loginProbeUsername,
+	}
+	if c.useProxy {
+		options.ProxyVersion = c.proxyVersion
+		options.ProxySource = c.proxySource
+	}
+
+	result := promLoginProbeError
+	response, err := slp.ProbeLogin(ctx, target.host, int(target.port), options)
+	if err != nil {
+		c.logger.Warn("login probe failed", zap.String("host", c.host), zap.Error(err))
+	} else {
+		result = string(response.Result)
+	}
 
+	for _, possible := range slp.LoginResults {
+		c.sendMetric(metrics, promDescLoginProbeResult, info.Version.Name, resolved,
+			boolToGaugeValue(string(possible) == result), string(possible))
+	}
+	c.sendMetric(metrics, promDescLoginProbeResult, info.Version.Name, resolved,
+		boolToGaugeValue(result == promLoginProbeError), promLoginProbeError)
+}
+
+func boolToGaugeValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// collectTimings sends the duration of each phase of the ping, where the DNS phase includes the SRV lookup
+func (c *promJavaCollector) collectTimings(metrics chan<- prometheus.Metric, info *slp.StatusResponse, resolved string, srvLookup time.Duration) {
+	c.sendMetric(metrics, promDescDnsLookup, info.Version.Name, resolved, (srvLookup + info.Timings.DNS).Seconds())
+	c.sendMetric(metrics, promDescConnect, info.Version.Name, resolved, info.Timings.Connect.Seconds())
+	c.sendMetric(metrics, promDescHandshake, info.Version.Name, resolved, info.Timings.Handshake.Seconds())
+	// not all servers and proxies respond to the ping
+	if info.Timings.PingPong > 0 {
+		c.sendMetric(metrics, promDescPingPong, info.Version.Name, resolved, info.Timings.PingPong.Seconds())
+	}
+}
+
+func (c *promJavaCollector) collectInfo(metrics chan<- prometheus.Metric, info *slp.StatusResponse, resolved string) {
+	motd, err := chat.Render(info.Description.Raw(), chat.FormatPlain)
+	if err != nil {
+		c.logger.Warn("failed to render description", zap.String("host", c.host), zap.Error(err))
+		motd = info.Description.Text
+	}
+	c.sendMetric(metrics, promDescInfo, info.Version.Name, resolved, 1, strconv.Itoa(info.Version.Protocol), motd)
+}
+
+func (c *promJavaCollector) collectProtocol(metrics chan<- prometheus.Metric, info *slp.StatusResponse, resolved string) {
+	if c.protocolVersion != 0 {
+		// proxies such as ViaVersion advertise the requested protocol version when they accept it
+		c.sendMetric(metrics, promDescProtocolSupported, info.Version.Name, resolved,
+			boolToGaugeValue(int32(info.Version.Protocol) == c.protocolVersion),
+			strconv.Itoa(int(c.protocolVersion)))
+	}
+}
+
+func (c *promJavaCollector) collectFavicon(metrics chan<- prometheus.Metric, info *slp.StatusResponse) {
+	hash, err := info.FaviconHash()
+	if err != nil {
+		c.logger.Warn("failed to decode favicon", zap.String("host", c.host), zap.Error(err))
+		return
+	}
+
+	changes := c.favicon.observe(hash)
+	metric, err := prometheus.NewConstMetric(promDescFaviconChanged, prometheus.CounterValue, float64(changes),
+		c.host, strconv.Itoa(int(c.port)), string(JavaEdition))
+	if err != nil {
+		c.logger.Error("failed to build metric", zap.Error(err), zap.String("name", promDescFaviconChanged.String()))
+	} else {
+		metrics <- metric
+	}
+}
+
+func (c *promJavaCollector) collectMods(metrics chan<- prometheus.Metric, info *slp.StatusResponse, resolved string) {
+	forgeInfo, err := info.ForgeInfo()
+	if err != nil {
+		c.logger.Warn("failed to parse mod metadata", zap.String("host", c.host), zap.Error(err))
+		return
+	}
+	if forgeInfo == nil {
+		return
+	}
+
+	c.sendMetric(metrics, promDescModsCount, info.Version.Name, resolved, float64(len(forgeInfo.Mods)))
+	if c.exportModInfo {
+		for _, mod := range forgeInfo.Mods {
+			c.sendMetric(metrics, promDescModInfo, info.Version.Name, resolved, 1, mod.Id, mod.Version)
+		}
 	}
 }
 
 func (c *promJavaCollector) sendMetric(metrics chan<- prometheus.Metric, desc *prometheus.Desc,
-	version string, value float64) {
+	version string, resolvedAddress string, value float64, extraLabelValues ...string) {
 
-	metric, err := prometheus.NewConstMetric(desc, prometheus.GaugeValue, value,
-		c.host, strconv.Itoa(int(c.port)), string(JavaEdition), version)
+	metric, err := newPromServerMetric(desc, value, c.dropVersionLabel,
+		c.host, c.port, utils.JavaEdition, version, resolvedAddress, extraLabelValues...)
 	if err != nil {
 		c.logger.Error("failed to build metric", zap.Error(err), zap.String("name", desc.String()))
 	} else {
@@ -204,6 +787,12 @@ type promBedrockCollector struct {
 	port    uint16
 	logger  *zap.Logger
 	timeout time.Duration
+	labels  map[string]string
+	// pingOptions enables the PROXY protocol header, which is always version 2 for Bedrock servers
+	pingOptions bedrock.PingOptions
+	// dropVersionLabel drops the version label from all metrics but the info metrics
+	dropVersionLabel bool
+	latency          prometheus.Histogram
 }
 
 func (c *promBedrockCollector) GetHost() string {
@@ -222,29 +811,83 @@ func (c *promBedrockCollector) SetTimeout(t time.Duration) {
 	c.timeout = t
 }
 
-func newPromBedrockCollector(host string, port uint16, logger *zap.Logger) *promBedrockCollector {
-	return &promBedrockCollector{host: host, port: port, logger: logger}
+func (c *promBedrockCollector) Server() (string, uint16, utils.ServerEdition) {
+	return c.host, c.port, utils.BedrockEdition
+}
+
+func (c *promBedrockCollector) Labels() map[string]string {
+	return c.labels
+}
+
+func newPromBedrockCollector(target *utils.Target, options promCollectorOptions, logger *zap.Logger) *promBedrockCollector {
+	proxy := options.proxyOptions(target)
+	return &promBedrockCollector{
+		host:    target.Host,
+		port:    target.Port,
+		logger:  logger,
+		timeout: target.TimeoutOr(options.timeout),
+		labels:  target.Labels,
+		pingOptions: bedrock.PingOptions{
+			UseProxy:    proxy.Enabled(),
+			ProxySource: proxy.Source,
+		},
+		dropVersionLabel: options.dropVersionLabel,
+		latency:          newPromLatencyHistogram(utils.BedrockEdition, target, options),
+	}
 }
 
 func (c *promBedrockCollector) Collect(metrics chan<- prometheus.Metric) {
+	c.collect(metrics, c.timeout)
+}
+
+func (c *promBedrockCollector) CollectWithin(metrics chan<- prometheus.Metric, timeout time.Duration) {
+	c.collect(metrics, limitTimeout(c.timeout, timeout))
+}
+
+func (c *promBedrockCollector) collect(metrics chan<- prometheus.Metric, timeout time.Duration) {
 	c.logger.Debug("pinging", zap.String("host", c.host), zap.String("port", strconv.Itoa(int(c.port))))
 
-	info, err := PingBedrockServer(net.JoinHostPort(c.host, strconv.Itoa(int(c.port))), c.timeout, c.logger)
+	startTime := time.Now()
+	info, err := bedrock.Ping(net.JoinHostPort(c.host, strconv.Itoa(int(c.port))), timeout, &c.pingOptions)
 	if err != nil {
-		c.sendMetric(metrics, promDescHealthy, "", 0)
+		c.logger.Debug("failed to ping bedrock server", zap.String("host", c.host), zap.Error(err))
+		// failed pings are observed too, so that the count of the histogram includes them
+		c.latency.Observe(time.Since(startTime).Seconds())
+		c.CollectUnhealthy(metrics, promUnhealthyReason(err))
 	} else {
+		c.logger.Debug("received response from bedrock server", zap.String("host", c.host), zap.String("response", info.Raw))
+		c.latency.Observe(info.Rtt.Seconds())
 		c.sendMetric(metrics, promDescResponseTime, info.Version, info.Rtt.Seconds())
 		c.sendMetric(metrics, promDescHealthy, info.Version, 1)
 		c.sendMetric(metrics, promDescPlayersOnline, info.Version, float64(info.Players))
 		c.sendMetric(metrics, promDescPlayersMax, info.Version, float64(info.MaxPlayers))
+		c.sendMetric(metrics, promDescInfo, info.Version, 1, strconv.Itoa(info.ProtocolVersion), info.ServerName)
+		c.sendMetric(metrics, promDescBedrockInfo, info.Version, 1,
+			info.Edition,
+			strconv.Itoa(info.ProtocolVersion),
+			strconv.FormatUint(info.ServerGuid, 10),
+			info.LevelName,
+			info.GameMode,
+			strconv.Itoa(info.GameModeId),
+			strconv.Itoa(info.PortIPv4),
+			strconv.Itoa(info.PortIPv6),
+			strconv.FormatBool(info.NintendoLimited),
+		)
+		metrics <- c.latency
 	}
 }
 
+func (c *promBedrockCollector) CollectUnhealthy(metrics chan<- prometheus.Metric, reason string) {
+	c.sendMetric(metrics, promDescHealthy, "", 0)
+	c.sendMetric(metrics, promDescUnhealthyReason, "", 1, reason)
+	metrics <- c.latency
+}
+
 func (c *promBedrockCollector) sendMetric(metrics chan<- prometheus.Metric,
-	desc *prometheus.Desc, version string, value float64) {
+	desc *prometheus.Desc, version string, value float64, extraLabelValues ...string) {
 
-	metric, err := prometheus.NewConstMetric(desc, prometheus.GaugeValue, value,
-		c.host, strconv.Itoa(int(c.port)), string(BedrockEdition), version)
+	metric, err := newPromServerMetric(desc, value, c.dropVersionLabel,
+		c.host, c.port, utils.BedrockEdition, version, "", extraLabelValues...)
 	if err != nil {
 		c.logger.Error("failed to build metric", zap.Error(err), zap.String("name", desc.String()))
 	} else {
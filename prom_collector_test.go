@@ -1,52 +1,69 @@
 package main
 
 import (
-	"reflect"
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
-	mcpinger "github.com/Raqbit/mc-pinger"
+	"github.com/itzg/mc-monitor/slp"
+	"github.com/itzg/mc-monitor/slp/slptest"
+	"github.com/itzg/mc-monitor/utils"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sandertv/go-raknet"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
 )
 
-func TestJavaPingerOptions(t *testing.T) {
+func TestJavaPingOptions(t *testing.T) {
 	tests := []struct {
 		name               string
 		useProxy           bool
 		proxyVersion       byte
-		expectProxy        bool
 		expectProxyVersion byte
 	}{
 		{name: "disabled", useProxy: false, proxyVersion: 2},
-		{name: "version one", useProxy: true, proxyVersion: 1, expectProxy: true, expectProxyVersion: 1},
-		{name: "version two", useProxy: true, proxyVersion: 2, expectProxy: true, expectProxyVersion: 2},
+		{name: "version one", useProxy: true, proxyVersion: 1, expectProxyVersion: 1},
+		{name: "version two", useProxy: true, proxyVersion: 2, expectProxyVersion: 2},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			collector := &promJavaCollector{
-				timeout:      5 * time.Second,
 				useProxy:     tt.useProxy,
 				proxyVersion: tt.proxyVersion,
 			}
-			pinger := mcpinger.New("localhost", DefaultJavaPort, javaPingerOptions(collector)...)
-			value := reflect.ValueOf(pinger).Elem()
+			options := javaPingOptions(collector)
 
-			assert.Equal(t, 5*time.Second, time.Duration(value.FieldByName("Timeout").Int()))
-			assert.Equal(t, tt.expectProxy, value.FieldByName("UseProxy").Bool())
-			assert.Equal(t, uint64(tt.expectProxyVersion), value.FieldByName("ProxyVersion").Uint())
+			assert.Equal(t, tt.expectProxyVersion, options.ProxyVersion)
 		})
 	}
 }
 
+func TestPingJavaServerTimeout(t *testing.T) {
+	server := slptest.NewServer(`{"version":{"name":"1.20.4","protocol":765},"players":{"max":20,"online":1},"description":"A server"}`)
+	defer server.Close()
+	server.SetStatusDelay(time.Minute)
+
+	collector := newPromJavaCollector(javaTestTarget(server), promCollectorOptions{timeout: 200 * time.Millisecond}, zap.NewNop())
+	start := time.Now()
+	_, err := pingJavaServer(collector)
+
+	require.Error(t, err)
+	assert.Equal(t, promReasonTimeout, promUnhealthyReason(err))
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
+
 func TestNewPromCollectorsPropagatesProxyConfig(t *testing.T) {
-	collectors, err := newPromCollectors(
+	collectors, err := newTestPromCollectors(
 		[]string{"java.example.com"},
 		[]string{"bedrock.example.com"},
-		true,
-		2,
+		promCollectorOptions{useProxy: true, proxyVersion: 2},
 		zap.NewNop(),
 	)
 
@@ -63,7 +80,377 @@ func TestNewPromCollectorsPropagatesProxyConfig(t *testing.T) {
 }
 
 func TestNewPromCollectorsRejectsInvalidProxyVersion(t *testing.T) {
-	_, err := newPromCollectors([]string{"java.example.com"}, nil, true, 3, zap.NewNop())
+	_, err := newTestPromCollectors([]string{"java.example.com"}, nil, promCollectorOptions{useProxy: true, proxyVersion: 3}, zap.NewNop())
 
 	require.EqualError(t, err, "proxy version must be 1 or 2")
 }
+
+type fakeSrvResolver map[string]*net.SRV
+
+func (f fakeSrvResolver) LookupSRV(_ context.Context, _, _, name string) (string, []*net.SRV, error) {
+	if record, ok := f[name]; ok {
+		return "", []*net.SRV{record}, nil
+	}
+	return "", nil, errors.New("no such host")
+}
+
+func TestPromJavaCollectorSrvLookup(t *testing.T) {
+	collectors, err := newTestPromCollectors(
+		[]string{"play.example.com", "explicit.example.com:25565"},
+		nil, promCollectorOptions{}, zap.NewNop(),
+	)
+	require.NoError(t, err)
+	require.Len(t, collectors, 2)
+
+	resolver := fakeSrvResolver{
+		"play.example.com":     {Target: "mc1.example.com.", Port: 25570},
+		"explicit.example.com": {Target: "mc2.example.com.", Port: 25571},
+	}
+
+	withoutPort := collectors[0].(*promJavaCollector)
+	withoutPort.resolver = resolver
+	target, resolved := withoutPort.resolve(0)
+	assert.Equal(t, "mc1.example.com", target.GetHost())
+	assert.Equal(t, uint16(25570), target.GetPort())
+	assert.Equal(t, "mc1.example.com:25570", resolved)
+
+	withPort := collectors[1].(*promJavaCollector)
+	withPort.resolver = resolver
+	target, resolved = withPort.resolve(0)
+	assert.Equal(t, "explicit.example.com", target.GetHost())
+	assert.Equal(t, uint16(25565), target.GetPort())
+	assert.Empty(t, resolved)
+}
+
+func TestFaviconTracker(t *testing.T) {
+	var tracker faviconTracker
+
+	assert.Equal(t, uint64(0), tracker.observe("a"))
+	assert.Equal(t, uint64(0), tracker.observe("a"))
+	assert.Equal(t, uint64(1), tracker.observe("b"))
+	// removing the favicon is also a change
+	assert.Equal(t, uint64(2), tracker.observe(""))
+	assert.Equal(t, uint64(2), tracker.observe(""))
+}
+
+func TestPromBedrockCollectorInfo(t *testing.T) {
+	listener, err := raknet.Listen("127.0.0.1:0")
+	require.NoError(t, err)
+	//goland:noinspection GoUnhandledErrorResult
+	defer listener.Close()
+	listener.PongData([]byte("MCEE;Classroom;594;1.20.13;3;30;42;World;Adventure;2;19132;19133;1;"))
+
+	port := listener.Addr().(*net.UDPAddr).Port
+	collector := newPromBedrockCollector(&utils.Target{Host: "127.0.0.1", Port: uint16(port)}, promCollectorOptions{}, zap.NewNop())
+	collector.SetTimeout(5 * time.Second)
+
+	expected := `
+# HELP minecraft_status_bedrock_info Has the value 1 with labels describing the details reported by Bedrock and Education Edition servers
+# TYPE minecraft_status_bedrock_info gauge
+minecraft_status_bedrock_info{bedrock_edition="MCEE",game_mode="Adventure",game_mode_id="2",level_name="World",nintendo_limited="false",port_ipv4="19132",port_ipv6="19133",protocol_version="594",server_edition="bedrock",server_guid="42",server_host="127.0.0.1",server_port="PORT",server_resolved_address="",server_version="1.20.13"} 1
+`
+	err = testutil.CollectAndCompare(promCollectors{collector},
+		strings.NewReader(strings.ReplaceAll(expected, "PORT", strconv.Itoa(port))),
+		"minecraft_status_bedrock_info")
+	require.NoError(t, err)
+}
+
+// javaTestStatus is the status of a healthy Java server
+const javaTestStatus = `{"version":{"name":"1.20.4","protocol":765},"players":{"max":20,"online":1},"description":"A server"}`
+
+// newTestJavaCollector starts a server responding with the given status, which is closed at the end of the test,
+// and creates a collector of it with the given options
+func newTestJavaCollector(t *testing.T, status string, options promCollectorOptions) (*promJavaCollector, *slptest.Server) {
+	server := slptest.NewServer(status)
+	t.Cleanup(server.Close)
+	collector := newPromJavaCollector(javaTestTarget(server), options, zap.NewNop())
+	collector.SetTimeout(5 * time.Second)
+	return collector, server
+}
+
+// assertJavaCollectorMetrics compares the named metrics of the collector with the expected text, where PORT
+// stands for the port of the server
+func assertJavaCollectorMetrics(t *testing.T, collector *promJavaCollector, server *slptest.Server, expected string, names ...string) {
+	expected = strings.ReplaceAll(expected, "PORT", strconv.Itoa(int(server.Port())))
+	require.NoError(t, testutil.CollectAndCompare(promCollectors{collector}, strings.NewReader(expected), names...))
+}
+
+func TestPromJavaCollectorLoginProbe(t *testing.T) {
+	collector, server := newTestJavaCollector(t, javaTestStatus,
+		promCollectorOptions{loginProbeUsername: slp.DefaultLoginUsername})
+
+	expected := `
+# HELP minecraft_login_probe_result Indicates with 1 the result of attempting a login with an offline username and 0 for the other results
+# TYPE minecraft_login_probe_result gauge
+minecraft_login_probe_result{result="accepted",server_edition="java",server_host="127.0.0.1",server_port="PORT",server_resolved_address="",server_version="1.20.4"} 0
+minecraft_login_probe_result{result="disconnected",server_edition="java",server_host="127.0.0.1",server_port="PORT",server_resolved_address="",server_version="1.20.4"} 0
+minecraft_login_probe_result{result="error",server_edition="java",server_host="127.0.0.1",server_port="PORT",server_resolved_address="",server_version="1.20.4"} 0
+minecraft_login_probe_result{result="online_mode",server_edition="java",server_host="127.0.0.1",server_port="PORT",server_resolved_address="",server_version="1.20.4"} 1
+minecraft_login_probe_result{result="plugin_request",server_edition="java",server_host="127.0.0.1",server_port="PORT",server_resolved_address="",server_version="1.20.4"} 0
+`
+	assertJavaCollectorMetrics(t, collector, server, expected, "minecraft_login_probe_result")
+	assert.Equal(t, 1, server.Logins())
+}
+
+func TestPromJavaCollectorProtocolSupported(t *testing.T) {
+	tests := []struct {
+		name            string
+		protocolVersion int32
+		expected        string
+	}{
+		{name: "supported", protocolVersion: 765, expected: "1"},
+		{name: "not supported", protocolVersion: 340, expected: "0"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			collector, server := newTestJavaCollector(t, javaTestStatus,
+				promCollectorOptions{protocolVersion: tt.protocolVersion})
+
+			expected := `
+# HELP minecraft_status_protocol_supported Indicates if the server accepts (1) or not (0) clients of the requested protocol version
+# TYPE minecraft_status_protocol_supported gauge
+minecraft_status_protocol_supported{requested_protocol_version="REQUESTED",server_edition="java",server_host="127.0.0.1",server_port="PORT",server_resolved_address="",server_version="1.20.4"} VALUE
+`
+			expected = strings.NewReplacer(
+				"REQUESTED", strconv.Itoa(int(tt.protocolVersion)),
+				"VALUE", tt.expected,
+			).Replace(expected)
+			assertJavaCollectorMetrics(t, collector, server, expected, "minecraft_status_protocol_supported")
+		})
+	}
+}
+
+func TestPromJavaCollectorTimings(t *testing.T) {
+	collector, _ := newTestJavaCollector(t, javaTestStatus, promCollectorOptions{})
+
+	count := testutil.CollectAndCount(promCollectors{collector},
+		"minecraft_status_dns_lookup_seconds",
+		"minecraft_status_connect_seconds",
+		"minecraft_status_handshake_seconds",
+		"minecraft_status_ping_pong_seconds",
+	)
+	assert.Equal(t, 4, count)
+}
+
+func TestPromJavaCollectorIgnoredPing(t *testing.T) {
+	for _, skipPingPong := range []bool{false, true} {
+		t.Run("skip "+strconv.FormatBool(skipPingPong), func(t *testing.T) {
+			collector, server := newTestJavaCollector(t, javaTestStatus, promCollectorOptions{skipPingPong: skipPingPong})
+			server.SetIgnorePing(true)
+			registry := prometheus.NewRegistry()
+			require.NoError(t, promCollectors{collector}.register(registry))
+
+			start := time.Now()
+			families, err := registry.Gather()
+			require.NoError(t, err)
+			if skipPingPong {
+				assert.Less(t, time.Since(start), slp.DefaultPingPongTimeout, "the pong is not awaited")
+			} else {
+				assert.Less(t, time.Since(start), collector.timeout, "the wait for the pong is bounded")
+			}
+
+			values := make(map[string]float64)
+			for _, family := range families {
+				if gauge := family.GetMetric()[0].GetGauge(); gauge != nil {
+					values[family.GetName()] = gauge.GetValue()
+				}
+			}
+			assert.Equal(t, 1.0, values["minecraft_status_healthy"])
+			assert.NotContains(t, values, "minecraft_status_ping_pong_seconds")
+			require.Contains(t, values, "minecraft_status_response_time_seconds")
+			assert.Less(t, values["minecraft_status_response_time_seconds"], slp.DefaultPingPongTimeout.Seconds(),
+				"the wait for the pong is not part of the response time")
+		})
+	}
+}
+
+func TestPromJavaCollectorDropVersionLabel(t *testing.T) {
+	collector, server := newTestJavaCollector(t,
+		`{"version":{"name":"1.20.4","protocol":765},"players":{"max":20,"online":1},"description":{"text":"A ","extra":[{"text":"server","color":"gold"}]}}`,
+		promCollectorOptions{dropVersionLabel: true})
+
+	expected := `
+# HELP minecraft_status_healthy Indicates if the server is healthy (1) or not (0)
+# TYPE minecraft_status_healthy gauge
+minecraft_status_healthy{server_edition="java",server_host="127.0.0.1",server_port="PORT",server_resolved_address=""} 1
+# HELP minecraft_status_info Has the value 1 with labels describing the version, protocol, and message of the day reported by the server
+# TYPE minecraft_status_info gauge
+minecraft_status_info{motd="A server",protocol_version="765",server_edition="java",server_host="127.0.0.1",server_port="PORT",server_resolved_address="",server_version="1.20.4"} 1
+`
+	assertJavaCollectorMetrics(t, collector, server, expected, "minecraft_status_healthy", "minecraft_status_info")
+
+	// failed pings keep reporting the same series of the core metrics
+	server.Close()
+	expected = `
+# HELP minecraft_status_healthy Indicates if the server is healthy (1) or not (0)
+# TYPE minecraft_status_healthy gauge
+minecraft_status_healthy{server_edition="java",server_host="127.0.0.1",server_port="PORT",server_resolved_address=""} 0
+`
+	assertJavaCollectorMetrics(t, collector, server, expected, "minecraft_status_healthy", "minecraft_status_info")
+}
+
+func TestPromJavaCollectorLatencyHistogram(t *testing.T) {
+	collector, server := newTestJavaCollector(t, javaTestStatus, promCollectorOptions{
+		latencyBuckets:   utils.LatencyBuckets{utils.JavaEdition: {0.5, 1}, utils.BedrockEdition: {0.01}},
+		nativeHistograms: true,
+	})
+	registry := prometheus.NewRegistry()
+	require.NoError(t, promCollectors{collector}.register(registry))
+
+	// the observations accumulate across scrapes, where failed pings are observed too
+	for range 2 {
+		_, err := registry.Gather()
+		require.NoError(t, err)
+	}
+	server.Close()
+	families, err := registry.Gather()
+	require.NoError(t, err)
+
+	var found bool
+	for _, family := range families {
+		if family.GetName() != "minecraft_status_java_latency_seconds" {
+			continue
+		}
+		found = true
+		require.Len(t, family.GetMetric(), 1)
+		histogram := family.GetMetric()[0].GetHistogram()
+		assert.Equal(t, uint64(3), histogram.GetSampleCount())
+		require.Len(t, histogram.GetBucket(), 2)
+		assert.Equal(t, 0.5, histogram.GetBucket()[0].GetUpperBound())
+		assert.Equal(t, 1.0, histogram.GetBucket()[1].GetUpperBound())
+		assert.NotEmpty(t, histogram.GetPositiveSpan(), "native buckets are added")
+		labels := make(map[string]string)
+		for _, label := range family.GetMetric()[0].GetLabel() {
+			labels[label.GetName()] = label.GetValue()
+		}
+		assert.Equal(t, map[string]string{"server_host": "127.0.0.1", "server_port": strconv.Itoa(int(server.Port())),
+			"server_edition": "java"}, labels)
+	}
+	assert.True(t, found)
+}
+
+// newTestPromCollectors creates collectors for the server lists as given to export-for-prometheus
+func newTestPromCollectors(servers []string, bedrockServers []string, options promCollectorOptions, logger *zap.Logger) (promCollectors, error) {
+	targets, err := utils.ParseServerLists(servers, bedrockServers)
+	if err != nil {
+		return nil, err
+	}
+	return newPromCollectors(targets, options, logger)
+}
+
+// javaTestTarget is the explicit address of the given server, which skips the SRV lookup
+func javaTestTarget(server *slptest.Server) *utils.Target {
+	return &utils.Target{Edition: utils.JavaEdition, Host: server.Host(), Port: server.Port(), ExplicitPort: true}
+}
+
+func TestNewPromCollectorsTargetOptions(t *testing.T) {
+	collectors, err := newTestPromCollectors(
+		[]string{
+			"java://proxied.example.com:25565?proxy=2&timeout=5s&slp=legacy&label.env=prod",
+			"direct.example.com",
+			"bedrock://bedrock.example.com?timeout=2s",
+		},
+		nil,
+		promCollectorOptions{timeout: time.Minute, useProxy: true, proxyVersion: 1},
+		zap.NewNop(),
+	)
+	require.NoError(t, err)
+	require.Len(t, collectors, 3)
+
+	proxied := collectors[0].(*promJavaCollector)
+	assert.Equal(t, 5*time.Second, proxied.timeout)
+	assert.Equal(t, byte(2), proxied.proxyVersion)
+	assert.Equal(t, "legacy", proxied.slpVariant)
+	assert.False(t, proxied.srvLookup)
+	assert.Equal(t, map[string]string{"env": "prod"}, proxied.Labels())
+
+	direct := collectors[1].(*promJavaCollector)
+	assert.Equal(t, time.Minute, direct.timeout)
+	assert.Equal(t, byte(1), direct.proxyVersion)
+	assert.True(t, direct.srvLookup)
+	assert.Empty(t, direct.Labels())
+
+	bedrockCollector := collectors[2].(*promBedrockCollector)
+	assert.Equal(t, uint16(19132), bedrockCollector.port)
+	assert.Equal(t, 2*time.Second, bedrockCollector.timeout)
+	assert.True(t, bedrockCollector.pingOptions.UseProxy)
+}
+
+func TestNewPromCollectorsRejectsInvalidTarget(t *testing.T) {
+	_, err := newTestPromCollectors([]string{"java://java.example.com?retries=3"}, nil, promCollectorOptions{}, zap.NewNop())
+
+	require.ErrorContains(t, err, "unknown option 'retries'")
+}
+
+func TestPromCollectorsRegisterLabels(t *testing.T) {
+	status := `{"version":{"name":"1.20.4","protocol":765},"players":{"max":20,"online":PLAYERS},"description":"A server"}`
+	prod := slptest.NewServer(strings.Replace(status, "PLAYERS", "3", 1))
+	defer prod.Close()
+	unlabeled := slptest.NewServer(strings.Replace(status, "PLAYERS", "1", 1))
+	defer unlabeled.Close()
+
+	collectors, err := newTestPromCollectors(
+		[]string{
+			"java://" + prod.Addr() + "?label.env=prod",
+			"java://" + unlabeled.Addr(),
+		},
+		nil, promCollectorOptions{timeout: 5 * time.Second}, zap.NewNop(),
+	)
+	require.NoError(t, err)
+
+	registry := prometheus.NewRegistry()
+	require.NoError(t, collectors.register(registry))
+
+	expected := `
+# HELP minecraft_status_players_online_count Number of players currently online
+# TYPE minecraft_status_players_online_count gauge
+minecraft_status_players_online_count{env="prod",server_edition="java",server_host="127.0.0.1",server_port="PROD",server_resolved_address="",server_version="1.20.4"} 3
+minecraft_status_players_online_count{env="",server_edition="java",server_host="127.0.0.1",server_port="UNLABELED",server_resolved_address="",server_version="1.20.4"} 1
+`
+	expected = strings.NewReplacer(
+		"PROD", strconv.Itoa(int(prod.Port())),
+		"UNLABELED", strconv.Itoa(int(unlabeled.Port())),
+	).Replace(expected)
+	err = testutil.GatherAndCompare(registry, strings.NewReader(expected), "minecraft_status_players_online_count")
+	require.NoError(t, err)
+}
+
+func TestPromTargetCollectorsReload(t *testing.T) {
+	status := `{"version":{"name":"1.20.4","protocol":765},"players":{"max":20,"online":PLAYERS},"description":"A server"}`
+	kept := slptest.NewServer(strings.Replace(status, "PLAYERS", "3", 1))
+	defer kept.Close()
+	removed := slptest.NewServer(strings.Replace(status, "PLAYERS", "1", 1))
+	defer removed.Close()
+
+	targetCollectors := &promTargetCollectors{}
+	registry := prometheus.NewRegistry()
+	require.NoError(t, registry.Register(targetCollectors))
+
+	collectors, err := newTestPromCollectors(
+		[]string{"java://" + kept.Addr(), "java://" + removed.Addr()},
+		nil, promCollectorOptions{timeout: 5 * time.Second}, zap.NewNop(),
+	)
+	require.NoError(t, err)
+	targetCollectors.set(collectors)
+	count, err := testutil.GatherAndCount(registry, "minecraft_status_players_online_count")
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	// the label given to the remaining target is added without registering again
+	collectors, err = newTestPromCollectors(
+		[]string{"java://" + kept.Addr() + "?label.env=prod"},
+		nil, promCollectorOptions{timeout: 5 * time.Second}, zap.NewNop(),
+	)
+	require.NoError(t, err)
+	targetCollectors.set(collectors)
+
+	expected := `
+# HELP minecraft_status_players_online_count Number of players currently online
+# TYPE minecraft_status_players_online_count gauge
+minecraft_status_players_online_count{env="prod",server_edition="java",server_host="127.0.0.1",server_port="KEPT",server_resolved_address="",server_version="1.20.4"} 3
+`
+	expected = strings.Replace(expected, "KEPT", strconv.Itoa(int(kept.Port())), 1)
+	err = testutil.GatherAndCompare(registry, strings.NewReader(expected), "minecraft_status_players_online_count")
+	require.NoError(t, err)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// promPoller pings each target in the background at an interval, where scrapes are served the last result of
+// each target instead of pinging it. This way, scrapes by more than one Prometheus don't add to the pings.
+type promPoller struct {
+	ctx      context.Context
+	interval time.Duration
+	// staleness is the age of a result after which the target is reported as not healthy
+	staleness time.Duration
+	// workers limits the number of targets pinged at the same time
+	workers chan struct{}
+
+	mu    sync.Mutex
+	polls map[specificPromCollector]*promPoll
+}
+
+// newPromPoller creates a poller whose polls stop when the given context is done, where a staleness of zero is
+// three times the interval
+func newPromPoller(ctx context.Context, interval time.Duration, staleness time.Duration, concurrency int) *promPoller {
+	if staleness <= 0 {
+		staleness = 3 * interval
+	}
+	return &promPoller{
+		ctx:       ctx,
+		interval:  interval,
+		staleness: staleness,
+		workers:   make(chan struct{}, max(concurrency, 1)),
+		polls:     make(map[specificPromCollector]*promPoll),
+	}
+}
+
+// set starts polling the given collectors that are not polled yet and stops polling the ones that are no longer
+// given. It returns the collectors that serve the last results.
+func (p *promPoller) set(collectors promCollectors) promCollectors {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	polls := make(map[specificPromCollector]*promPoll, len(collectors))
+	polled := make(promCollectors, 0, len(collectors))
+	for _, collector := range collectors {
+		poll, exists := p.polls[collector]
+		if !exists {
+			ctx, cancel := context.WithCancel(p.ctx)
+			poll = &promPoll{specificPromCollector: collector, staleness: p.staleness, cancel: cancel}
+			go poll.run(ctx, p.interval, p.workers)
+		}
+		polls[collector] = poll
+		polled = append(polled, poll)
+	}
+	for collector, poll := range p.polls {
+		if _, exists := polls[collector]; !exists {
+			poll.cancel()
+		}
+	}
+	p.polls = polls
+	return polled
+}
+
+// promPoll serves the last result of pinging its collector, which is reported as not healthy once it is older than
+// the staleness. Nothing is reported until the first ping completes.
+type promPoll struct {
+	specificPromCollector
+	staleness time.Duration
+	cancel    context.CancelFunc
+
+	mu      sync.RWMutex
+	metrics []prometheus.Metric
+	last    time.Time
+}
+
+func (p *promPoll) run(ctx context.Context, interval time.Duration, workers chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case workers <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+		metrics := collectMetrics(promCollectors{p.specificPromCollector})
+		<-workers
+
+		p.mu.Lock()
+		p.metrics = metrics
+		p.last = time.Now()
+		p.mu.Unlock()
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (p *promPoll) Collect(metrics chan<- prometheus.Metric) {
+	p.mu.RLock()
+	cached, last := p.metrics, p.last
+	p.mu.RUnlock()
+	if last.IsZero() {
+		return
+	}
+
+	if time.Since(last) > p.staleness {
+		p.CollectUnhealthy(metrics, promReasonStale)
+	} else {
+		for _, metric := range cached {
+			metrics <- metric
+		}
+	}
+	host, port, edition := p.Server()
+	metrics <- prometheus.MustNewConstMetric(promDescLastProbe, prometheus.GaugeValue,
+		float64(last.UnixNano())/float64(time.Second), host, strconv.Itoa(int(port)), string(edition))
+}
+
+// CollectWithin serves the last result like Collect, since the server is not pinged by the scrape
+func (p *promPoll) CollectWithin(metrics chan<- prometheus.Metric, _ time.Duration) {
+	p.Collect(metrics)
+}
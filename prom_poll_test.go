@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPromPoller(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	poller := newPromPoller(ctx, time.Hour, 0, 2)
+	assert.Equal(t, 3*time.Hour, poller.staleness)
+
+	collector := &delayedPromCollector{host: "mc.example.com"}
+	polled := poller.set(promCollectors{collector})
+	require.Eventually(t, func() bool {
+		return testutil.CollectAndCount(polled, "minecraft_status_healthy") == 1
+	}, time.Second, 10*time.Millisecond)
+
+	// scrapes are served the last result without pinging
+	for range 3 {
+		assert.Equal(t, 1, testutil.CollectAndCount(polled, "minecraft_status_healthy"))
+	}
+	assert.Equal(t, int32(1), collector.pings.Load())
+	assert.Equal(t, 1, testutil.CollectAndCount(polled, "minecraft_status_last_probe_timestamp_seconds"))
+
+	// collectors that are still given keep their results
+	added := &delayedPromCollector{host: "lobby.example.com", delay: time.Hour}
+	polled = poller.set(promCollectors{collector, added})
+	assert.Equal(t, 1, testutil.CollectAndCount(polled, "minecraft_status_healthy"),
+		"servers without a result yet are not reported")
+	require.Eventually(t, func() bool {
+		return added.pings.Load() == 1
+	}, time.Second, 10*time.Millisecond)
+
+	poller.set(promCollectors{collector})
+	assert.Len(t, poller.polls, 1)
+}
+
+func TestPromPollerStaleness(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	poller := newPromPoller(ctx, time.Hour, 50*time.Millisecond, 1)
+
+	polled := poller.set(promCollectors{&delayedPromCollector{host: "mc.example.com"}})
+	require.Eventually(t, func() bool {
+		return testutil.CollectAndCount(polled, "minecraft_status_healthy") == 1
+	}, time.Second, 10*time.Millisecond)
+	time.Sleep(100 * time.Millisecond)
+
+	expected := `
+# HELP minecraft_status_healthy Indicates if the server is healthy (1) or not (0)
+# TYPE minecraft_status_healthy gauge
+minecraft_status_healthy{server_edition="java",server_host="mc.example.com",server_port="25565",server_resolved_address="",server_version=""} 0
+# HELP minecraft_status_unhealthy_reason Has the value 1 with the reason the server is not healthy
+# TYPE minecraft_status_unhealthy_reason gauge
+minecraft_status_unhealthy_reason{reason="stale",server_edition="java",server_host="mc.example.com",server_port="25565",server_resolved_address="",server_version=""} 1
+`
+	registry := prometheus.NewRegistry()
+	require.NoError(t, registry.Register(polled))
+	assert.NoError(t, testutil.GatherAndCompare(registry, strings.NewReader(expected),
+		"minecraft_status_healthy", "minecraft_status_unhealthy_reason"))
+}
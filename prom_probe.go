@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/itzg/mc-monitor/config"
+	"github.com/itzg/mc-monitor/utils"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
+)
+
+const promProbePath = "/probe"
+
+// promProbeHandler pings the server given by the target parameter of each request, like the blackbox_exporter,
+// and responds with its metrics from a registry of its own within the scrape timeout given by Prometheus. The
+// optional edition parameter is java or bedrock and the optional module parameter selects a module of the
+// configuration file, where the options of the command apply otherwise. The target is only an address, since
+// whoever can reach the endpoint could otherwise set the options of the ping, such as the PROXY header or labels.
+type promProbeHandler struct {
+	options promCollectorOptions
+	logger  *zap.Logger
+
+	mu      sync.RWMutex
+	modules map[string]*config.Module
+}
+
+func newPromProbeHandler(options promCollectorOptions, logger *zap.Logger) *promProbeHandler {
+	return &promProbeHandler{
+		options: options,
+		logger:  logger,
+	}
+}
+
+// setModules replaces the modules, such as when the configuration file is reloaded
+func (h *promProbeHandler) setModules(modules map[string]*config.Module) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.modules = modules
+}
+
+func (h *promProbeHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	target, err := h.target(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	collectors, err := newPromCollectors([]*utils.Target{target}, h.options, h.logger)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(&promScrape{
+		collectors: collectors,
+		labelSets:  collectors.labelSets(),
+		deadline:   promScrapeDeadline(r),
+	})
+	promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+}
+
+// target returns the target given by the parameters of a request
+func (h *promProbeHandler) target(query url.Values) (*utils.Target, error) {
+	value := query.Get("target")
+	if value == "" {
+		return nil, errors.New("the target parameter is required")
+	}
+
+	edition := utils.JavaEdition
+	if given := query.Get("edition"); given != "" {
+		if !utils.ValidEdition(given) {
+			return nil, fmt.Errorf("invalid edition '%s', must be java or bedrock", given)
+		}
+		edition = utils.ServerEdition(given)
+	}
+	if strings.Contains(value, "://") {
+		return nil, fmt.Errorf("invalid target '%s': only a [host:port] address is allowed, where the options are given by a module", value)
+	}
+	host, port, explicit, err := utils.ParseHostPort(value, utils.DefaultPort(edition))
+	if err != nil {
+		return nil, fmt.Errorf("invalid target '%s': %w", value, err)
+	}
+	target := &utils.Target{Edition: edition, Host: host, Port: port, ExplicitPort: explicit}
+
+	if name := query.Get("module"); name != "" {
+		h.mu.RLock()
+		module, exists := h.modules[name]
+		h.mu.RUnlock()
+		if !exists {
+			return nil, fmt.Errorf("unknown module '%s'", name)
+		}
+		if err := module.Apply(target); err != nil {
+			return nil, fmt.Errorf("module %s: %w", name, err)
+		}
+	}
+	return target, nil
+}
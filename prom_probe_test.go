@@ -0,0 +1,103 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/itzg/mc-monitor/config"
+	"github.com/itzg/mc-monitor/slp/slptest"
+	"github.com/itzg/mc-monitor/utils"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestPromProbeHandler(t *testing.T) {
+	server := slptest.NewServer(`{"version":{"name":"1.20.4","protocol":765},"players":{"max":20,"online":3},"description":"A server"}`)
+	defer server.Close()
+
+	handler := newPromProbeHandler(promCollectorOptions{timeout: 5 * time.Second}, zap.NewNop())
+	address := server.Addr()
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/probe?target="+url.QueryEscape(address), nil))
+
+	require.Equal(t, http.StatusOK, recorder.Code)
+	port := strconv.Itoa(int(server.Port()))
+	assert.Contains(t, recorder.Body.String(),
+		`minecraft_status_healthy{server_edition="java",server_host="127.0.0.1",server_port="`+port+`",server_resolved_address="",server_version="1.20.4"} 1`)
+	assert.Contains(t, recorder.Body.String(),
+		`minecraft_status_players_online_count{server_edition="java",server_host="127.0.0.1",server_port="`+port+`",server_resolved_address="",server_version="1.20.4"} 3`)
+
+	// each request uses a registry of its own
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/probe?target="+url.QueryEscape(address), nil))
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), `minecraft_status_healthy{server_edition="java"`)
+	assert.Equal(t, 2, server.Pings())
+
+	// the options of a URI would let anyone reaching the endpoint send PROXY headers or add labels
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet,
+		"/probe?target="+url.QueryEscape("java://"+address+"?proxy=2&label.env=prod"), nil))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+	assert.Equal(t, 2, server.Pings())
+}
+
+func TestPromProbeHandlerTarget(t *testing.T) {
+	file, err := config.Parse("mc-monitor.yaml", []byte(`
+modules:
+  quick:
+    timeout: 2s
+    proxy: 2
+  legacy:
+    probe: legacy
+`))
+	require.NoError(t, err)
+	handler := newPromProbeHandler(promCollectorOptions{}, zap.NewNop())
+	handler.setModules(file.Modules)
+
+	target, err := handler.target(url.Values{"target": {"mc.example.com"}})
+	require.NoError(t, err)
+	assert.Equal(t, &utils.Target{Edition: utils.JavaEdition, Host: "mc.example.com", Port: 25565}, target)
+
+	target, err = handler.target(url.Values{"target": {"bedrock.example.com:19133"}, "edition": {"bedrock"}, "module": {"quick"}})
+	require.NoError(t, err)
+	assert.Equal(t, utils.BedrockEdition, target.Edition)
+	assert.Equal(t, uint16(19133), target.Port)
+	assert.Equal(t, 2*time.Second, target.Timeout)
+	require.NotNil(t, target.ProxyVersion)
+	assert.Equal(t, byte(2), *target.ProxyVersion)
+
+	tests := []struct {
+		name   string
+		query  url.Values
+		expect string
+	}{
+		{name: "missing target", query: url.Values{}, expect: "the target parameter is required"},
+		{name: "invalid edition", query: url.Values{"target": {"mc.example.com"}, "edition": {"pocket"}},
+			expect: "invalid edition 'pocket', must be java or bedrock"},
+		{name: "URI target", query: url.Values{"target": {"java://mc.example.com?proxy=2&proxy-source=203.0.113.7:40000&label.env=prod"}},
+			expect: "invalid target 'java://mc.example.com?proxy=2&proxy-source=203.0.113.7:40000&label.env=prod': only a [host:port] address is allowed, where the options are given by a module"},
+		{name: "invalid port", query: url.Values{"target": {"mc.example.com:mc"}},
+			expect: "invalid target 'mc.example.com:mc': invalid port 'mc'"},
+		{name: "unknown module", query: url.Values{"target": {"mc.example.com"}, "module": {"slow"}},
+			expect: "unknown module 'slow'"},
+		{name: "module not applicable", query: url.Values{"target": {"bedrock.example.com"}, "edition": {"bedrock"}, "module": {"legacy"}},
+			expect: "module legacy: slp only applies to Java servers"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := handler.target(tt.query)
+			assert.EqualError(t, err, tt.expect)
+		})
+	}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/probe?module=quick", nil))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"strconv"
+
+	"github.com/itzg/mc-monitor/rcon"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+const promRconMetricPrefix = "minecraft_rcon_"
+
+var (
+	promRconLabels = []string{promLabelHost, promLabelPort}
+	promDescRconUp = prometheus.NewDesc(promRconMetricPrefix+"up",
+		"Indicates if the RCON commands could be run (1) or not (0) during the most recent poll",
+		promRconLabels, nil)
+)
+
+// promRconCollector reports the samples retained by RCON pollers, which run in the background
+type promRconCollector struct {
+	pollers []*rcon.Poller
+	descs   map[string]*prometheus.Desc
+	logger  *zap.Logger
+}
+
+func newPromRconCollector(pollers []*rcon.Poller, logger *zap.Logger) *promRconCollector {
+	descs := make(map[string]*prometheus.Desc, len(rcon.Samples))
+	for name, info := range rcon.Samples {
+		descs[name] = prometheus.NewDesc(promRconMetricPrefix+name, info.Description,
+			append(append([]string{}, promRconLabels...), info.Labels...), nil)
+	}
+
+	return &promRconCollector{
+		pollers: pollers,
+		descs:   descs,
+		logger:  logger,
+	}
+}
+
+func (c *promRconCollector) Describe(descs chan<- *prometheus.Desc) {
+	descs <- promDescRconUp
+	for _, desc := range c.descs {
+		descs <- desc
+	}
+}
+
+func (c *promRconCollector) Collect(metrics chan<- prometheus.Metric) {
+	for _, poller := range c.pollers {
+		host, port := poller.Host(), strconv.Itoa(int(poller.Port()))
+
+		up, samples := poller.Snapshot()
+		upValue := 0.0
+		if up {
+			upValue = 1
+		}
+		c.sendMetric(metrics, promDescRconUp, upValue, host, port)
+
+		for _, sample := range samples {
+			desc, ok := c.descs[sample.Name]
+			if !ok {
+				c.logger.Debug("skipping unknown RCON sample", zap.String("name", sample.Name))
+				continue
+			}
+			labelValues := []string{host, port}
+			for _, label := range rcon.Samples[sample.Name].Labels {
+				labelValues = append(labelValues, sample.Labels[label])
+			}
+			c.sendMetric(metrics, desc, sample.Value, labelValues...)
+		}
+	}
+}
+
+func (c *promRconCollector) sendMetric(metrics chan<- prometheus.Metric, desc *prometheus.Desc,
+	value float64, labelValues ...string) {
+
+	metric, err := prometheus.NewConstMetric(desc, prometheus.GaugeValue, value, labelValues...)
+	if err != nil {
+		c.logger.Error("failed to build metric", zap.Error(err), zap.String("name", desc.String()))
+	} else {
+		metrics <- metric
+	}
+}
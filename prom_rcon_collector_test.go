@@ -0,0 +1,59 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/itzg/mc-monitor/rcon"
+	"github.com/itzg/mc-monitor/rcon/rcontest"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestPromRconCollector(t *testing.T) {
+	server := rcontest.NewServer("secret", func(command string) string {
+		switch command {
+		case "forge tps":
+			return "minecraft:overworld: Mean tick time: 1.5 ms. Mean TPS: 20.000"
+		case "list":
+			return "There are 1 of a max of 10 players online: alice"
+		}
+		return ""
+	})
+	defer server.Close()
+
+	t.Setenv("TEST_RCON_PASSWORD", "secret")
+	config := rcon.Config{
+		Servers:     []string{server.Addr()},
+		ServerType:  rcon.ServerTypeForge,
+		Timeout:     time.Second,
+		PasswordEnv: "TEST_RCON_PASSWORD",
+	}
+	pollers, err := config.NewPollers(zap.NewNop())
+	require.NoError(t, err)
+	require.Len(t, pollers, 1)
+	pollers[0].Poll()
+
+	collector := newPromRconCollector(pollers, zap.NewNop())
+
+	port := strings.Split(server.Addr(), ":")[1]
+	expected := `
+# HELP minecraft_rcon_mspt Milliseconds per tick reported by the server
+# TYPE minecraft_rcon_mspt gauge
+minecraft_rcon_mspt{dimension="minecraft:overworld",server_host="127.0.0.1",server_port="PORT",stat="",window=""} 1.5
+# HELP minecraft_rcon_players_online_count Number of players currently online, as reported by the list command
+# TYPE minecraft_rcon_players_online_count gauge
+minecraft_rcon_players_online_count{server_host="127.0.0.1",server_port="PORT"} 1
+# HELP minecraft_rcon_tps Ticks per second reported by the server
+# TYPE minecraft_rcon_tps gauge
+minecraft_rcon_tps{dimension="minecraft:overworld",server_host="127.0.0.1",server_port="PORT",window=""} 20
+# HELP minecraft_rcon_up Indicates if the RCON commands could be run (1) or not (0) during the most recent poll
+# TYPE minecraft_rcon_up gauge
+minecraft_rcon_up{server_host="127.0.0.1",server_port="PORT"} 1
+`
+	err = testutil.CollectAndCompare(collector, strings.NewReader(strings.ReplaceAll(expected, "PORT", port)),
+		"minecraft_rcon_up", "minecraft_rcon_tps", "minecraft_rcon_mspt", "minecraft_rcon_players_online_count")
+	require.NoError(t, err)
+}
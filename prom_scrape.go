@@ -0,0 +1,175 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// promScrapeTimeoutHeader is sent by Prometheus with the timeout of each scrape
+const promScrapeTimeoutHeader = "X-Prometheus-Scrape-Timeout-Seconds"
+
+// promScrapeTimeoutOffset is subtracted from the scrape timeout to leave time for responding
+const promScrapeTimeoutOffset = 500 * time.Millisecond
+
+// promScrape collects the targets of one scrape concurrently, where targets that haven't been collected by the
+// deadline are reported as not healthy with the timeout reason. Pings are given up at the deadline when their
+// own timeout is longer, so that pings of unresponsive servers don't build up across scrapes.
+type promScrape struct {
+	collectors promCollectors
+	// labelSets are the labels of each collector, or nil when there are none
+	labelSets []prometheus.Labels
+	// concurrency limits the number of targets pinged at the same time, where less than one is treated as one
+	concurrency int
+	// deadline is when the pending targets are reported as timed out, where zero waits for every target
+	deadline time.Time
+}
+
+func (s *promScrape) Describe(chan<- *prometheus.Desc) {
+}
+
+func (s *promScrape) Collect(metrics chan<- prometheus.Metric) {
+	if len(s.collectors) == 0 {
+		return
+	}
+	var expired <-chan time.Time
+	if !s.deadline.IsZero() {
+		timer := time.NewTimer(time.Until(s.deadline))
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	type result struct {
+		index   int
+		metrics []prometheus.Metric
+	}
+	// buffered so that targets finishing after the deadline don't block
+	results := make(chan result, len(s.collectors))
+	workers := make(chan struct{}, max(s.concurrency, 1))
+	// closed at the deadline so that targets waiting for a worker are not started
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for i := range s.collectors {
+			select {
+			case workers <- struct{}{}:
+			case <-stop:
+				return
+			}
+			go func() {
+				defer func() { <-workers }()
+				results <- result{index: i, metrics: collectMetrics(s.labeled(i, s.pinger(s.collectors[i])))}
+			}()
+		}
+	}()
+
+	collected := make([]bool, len(s.collectors))
+	for range s.collectors {
+		select {
+		case r := <-results:
+			collected[r.index] = true
+			for _, metric := range r.metrics {
+				metrics <- metric
+			}
+		case <-expired:
+			for i, collector := range s.collectors {
+				if !collected[i] {
+					s.labeled(i, promUnhealthyCollector{collector: collector, reason: promReasonTimeout}).Collect(metrics)
+				}
+			}
+			return
+		}
+	}
+}
+
+// collectMetrics gathers the metrics of the given collector, such as of one target, since they can only be sent
+// to the registry while Collect hasn't returned
+func collectMetrics(collector prometheus.Collector) []prometheus.Metric {
+	target := make(chan prometheus.Metric)
+	go func() {
+		collector.Collect(target)
+		close(target)
+	}()
+	var metrics []prometheus.Metric
+	for metric := range target {
+		metrics = append(metrics, metric)
+	}
+	return metrics
+}
+
+// pinger returns the collector that pings the given target within the time left until the deadline
+func (s *promScrape) pinger(collector specificPromCollector) prometheus.Collector {
+	if s.deadline.IsZero() {
+		return promCollectors{collector}
+	}
+	remaining := time.Until(s.deadline)
+	if remaining <= 0 {
+		return promUnhealthyCollector{collector: collector, reason: promReasonTimeout}
+	}
+	return promWithinCollector{collector: collector, timeout: remaining}
+}
+
+// labeled adds the labels of the collector at the given index to the metrics of the given collector
+func (s *promScrape) labeled(index int, collector prometheus.Collector) prometheus.Collector {
+	if s.labelSets == nil {
+		return collector
+	}
+	return prometheus.WrapCollectorWith(s.labelSets[index], collector)
+}
+
+// promUnhealthyCollector reports a server as not healthy for the given reason without pinging it
+type promUnhealthyCollector struct {
+	collector specificPromCollector
+	reason    string
+}
+
+func (c promUnhealthyCollector) Describe(descs chan<- *prometheus.Desc) {
+	promCollectors{}.Describe(descs)
+}
+
+func (c promUnhealthyCollector) Collect(metrics chan<- prometheus.Metric) {
+	c.collector.CollectUnhealthy(metrics, c.reason)
+}
+
+// promWithinCollector pings a server like its collector, but gives up after the given timeout when that is shorter
+type promWithinCollector struct {
+	collector specificPromCollector
+	timeout   time.Duration
+}
+
+func (c promWithinCollector) Describe(descs chan<- *prometheus.Desc) {
+	promCollectors{}.Describe(descs)
+}
+
+func (c promWithinCollector) Collect(metrics chan<- prometheus.Metric) {
+	c.collector.CollectWithin(metrics, c.timeout)
+}
+
+// newPromMetricsHandler serves the metrics of the default registry along with those of the targets, which
+// are collected within the scrape timeout given by Prometheus
+func newPromMetricsHandler(targets *promTargetCollectors) http.Handler {
+	return promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer,
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			registry := prometheus.NewRegistry()
+			registry.MustRegister(targets.scrape(promScrapeDeadline(r)))
+			promhttp.HandlerFor(prometheus.Gatherers{prometheus.DefaultGatherer, registry}, promhttp.HandlerOpts{}).
+				ServeHTTP(w, r)
+		}))
+}
+
+// promScrapeDeadline returns when the targets of a scrape need to have been collected, which is zero when the
+// request doesn't give the scrape timeout
+func promScrapeDeadline(r *http.Request) time.Time {
+	seconds, err := strconv.ParseFloat(r.Header.Get(promScrapeTimeoutHeader), 64)
+	if err != nil || seconds <= 0 {
+		return time.Time{}
+	}
+	timeout := time.Duration(seconds * float64(time.Second))
+	if timeout > 2*promScrapeTimeoutOffset {
+		timeout -= promScrapeTimeoutOffset
+	}
+	return time.Now().Add(timeout)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/itzg/mc-monitor/utils"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// delayedPromCollector reports a healthy server after the delay, or a timeout when it is given less time
+type delayedPromCollector struct {
+	host   string
+	delay  time.Duration
+	labels map[string]string
+	// pings counts the calls of Collect
+	pings atomic.Int32
+	// running counts the collectors pinging at the same time, where peak is the most seen
+	running, peak *atomic.Int32
+}
+
+func (c *delayedPromCollector) Collect(metrics chan<- prometheus.Metric) {
+	c.CollectWithin(metrics, 0)
+}
+
+func (c *delayedPromCollector) CollectWithin(metrics chan<- prometheus.Metric, timeout time.Duration) {
+	c.pings.Add(1)
+	if c.running != nil {
+		running := c.running.Add(1)
+		defer c.running.Add(-1)
+		for peak := c.peak.Load(); running > peak && !c.peak.CompareAndSwap(peak, running); peak = c.peak.Load() {
+		}
+	}
+	if timeout > 0 && timeout < c.delay {
+		time.Sleep(timeout)
+		c.CollectUnhealthy(metrics, promReasonTimeout)
+		return
+	}
+	time.Sleep(c.delay)
+	metrics <- prometheus.MustNewConstMetric(promDescHealthy, prometheus.GaugeValue, 1,
+		c.host, "25565", string(JavaEdition), "1.20.4", "")
+}
+
+func (c *delayedPromCollector) CollectUnhealthy(metrics chan<- prometheus.Metric, reason string) {
+	metrics <- prometheus.MustNewConstMetric(promDescHealthy, prometheus.GaugeValue, 0,
+		c.host, "25565", string(JavaEdition), "", "")
+	metrics <- prometheus.MustNewConstMetric(promDescUnhealthyReason, prometheus.GaugeValue, 1,
+		c.host, "25565", string(JavaEdition), "", "", reason)
+}
+
+func (c *delayedPromCollector) SetTimeout(time.Duration) {
+}
+
+func (c *delayedPromCollector) Server() (string, uint16, utils.ServerEdition) {
+	return c.host, 25565, utils.JavaEdition
+}
+
+func (c *delayedPromCollector) Labels() map[string]string {
+	return c.labels
+}
+
+func TestPromScrapeDeadline(t *testing.T) {
+	collectors := promCollectors{
+		&delayedPromCollector{host: "fast.example.com", labels: map[string]string{"env": "prod"}},
+		&delayedPromCollector{host: "dead.example.com", delay: 5 * time.Second},
+	}
+	registry := prometheus.NewRegistry()
+	require.NoError(t, registry.Register(&promScrape{
+		collectors:  collectors,
+		labelSets:   collectors.labelSets(),
+		concurrency: 2,
+		deadline:    time.Now().Add(200 * time.Millisecond),
+	}))
+
+	expected := `
+# HELP minecraft_status_healthy Indicates if the server is healthy (1) or not (0)
+# TYPE minecraft_status_healthy gauge
+minecraft_status_healthy{env="",server_edition="java",server_host="dead.example.com",server_port="25565",server_resolved_address="",server_version=""} 0
+minecraft_status_healthy{env="prod",server_edition="java",server_host="fast.example.com",server_port="25565",server_resolved_address="",server_version="1.20.4"} 1
+# HELP minecraft_status_unhealthy_reason Has the value 1 with the reason the server is not healthy
+# TYPE minecraft_status_unhealthy_reason gauge
+minecraft_status_unhealthy_reason{env="",reason="timeout",server_edition="java",server_host="dead.example.com",server_port="25565",server_resolved_address="",server_version=""} 1
+`
+	start := time.Now()
+	err := testutil.GatherAndCompare(registry, strings.NewReader(expected))
+	require.NoError(t, err)
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
+
+func TestPromScrapeDeadlineEndsPings(t *testing.T) {
+	var running, peak atomic.Int32
+	collector := &delayedPromCollector{host: "dead.example.com", delay: 5 * time.Second, running: &running, peak: &peak}
+
+	for range 3 {
+		scrape := &promScrape{
+			collectors:  promCollectors{collector},
+			concurrency: 1,
+			deadline:    time.Now().Add(200 * time.Millisecond),
+		}
+		assert.Equal(t, 1, testutil.CollectAndCount(scrape, "minecraft_status_unhealthy_reason"))
+	}
+	assert.Equal(t, int32(3), collector.pings.Load())
+	// the ping of each scrape ends at the deadline rather than after the delay of the server
+	require.Eventually(t, func() bool {
+		return running.Load() == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestPromScrapeConcurrency(t *testing.T) {
+	var running, peak atomic.Int32
+	var collectors promCollectors
+	for _, host := range []string{"a", "b", "c", "d", "e", "f"} {
+		collectors = append(collectors, &delayedPromCollector{host: host, delay: 50 * time.Millisecond,
+			running: &running, peak: &peak})
+	}
+
+	count := testutil.CollectAndCount(&promScrape{collectors: collectors, concurrency: 3}, "minecraft_status_healthy")
+	assert.Equal(t, 6, count)
+	assert.Equal(t, int32(3), peak.Load())
+}
+
+func TestPromMetricsHandlerScrapeTimeout(t *testing.T) {
+	targets := &promTargetCollectors{concurrency: 10}
+	targets.set(promCollectors{&delayedPromCollector{host: "dead.example.com", delay: 5 * time.Second}})
+
+	request := httptest.NewRequest(http.MethodGet, promExportPath, nil)
+	request.Header.Set(promScrapeTimeoutHeader, "1.5")
+	recorder := httptest.NewRecorder()
+	start := time.Now()
+	newPromMetricsHandler(targets).ServeHTTP(recorder, request)
+
+	assert.Less(t, time.Since(start), 1500*time.Millisecond)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	assert.Contains(t, recorder.Body.String(), `minecraft_status_unhealthy_reason{reason="timeout",server_edition="java",server_host="dead.example.com"`)
+	// the metrics of the default registry are included
+	assert.Contains(t, recorder.Body.String(), "go_goroutines")
+}
+
+func TestPromScrapeDeadlineHeader(t *testing.T) {
+	request := httptest.NewRequest(http.MethodGet, promExportPath, nil)
+	assert.True(t, promScrapeDeadline(request).IsZero())
+
+	request.Header.Set(promScrapeTimeoutHeader, "10")
+	assert.WithinDuration(t, time.Now().Add(9500*time.Millisecond), promScrapeDeadline(request), 100*time.Millisecond)
+
+	// short timeouts are used as given
+	request.Header.Set(promScrapeTimeoutHeader, "0.5")
+	assert.WithinDuration(t, time.Now().Add(500*time.Millisecond), promScrapeDeadline(request), 100*time.Millisecond)
+
+	request.Header.Set(promScrapeTimeoutHeader, "soon")
+	assert.True(t, promScrapeDeadline(request).IsZero())
+}
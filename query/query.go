@@ -0,0 +1,324 @@
+// Package query implements the UDP based GameSpy4 Query protocol that Java Edition servers
+// expose when enable-query is set in server.properties.
+// See https://wiki.vg/Query
+package query
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	packetTypeHandshake byte = 0x09
+	packetTypeStat      byte = 0x00
+
+	// sessionIdMask is applied since servers only consider the lower 4 bits of each byte
+	sessionIdMask int32 = 0x0F0F0F0F
+
+	maxPacketSize = 65535
+)
+
+var magic = []byte{0xFE, 0xFD}
+
+// fullStatPadding precedes the key/value section of a full stat response
+var fullStatPadding = []byte("splitnum\x00\x80\x00")
+
+// playersPadding precedes the player list section of a full stat response
+var playersPadding = []byte("\x01player_\x00\x00")
+
+type BasicStat struct {
+	MessageOfTheDay    string `json:"motd"`
+	GameType           string `json:"game_type"`
+	Map                string `json:"map"`
+	CurrentPlayerCount int    `json:"current_player_count"`
+	MaxPlayers         int    `json:"max_players"`
+	HostPort           uint16 `json:"host_port"`
+	HostIp             string `json:"host_ip"`
+}
+
+type FullStat struct {
+	BasicStat
+	GameId  string `json:"game_id"`
+	Version string `json:"version"`
+	// ServerMod is the server software and version, such as "Paper on 1.20.4", when reported
+	ServerMod string   `json:"server_mod,omitempty"`
+	Plugins   []string `json:"plugins"`
+	Players   []string `json:"players"`
+	// Properties contains every key/value pair reported by the server, including ones not mapped above
+	Properties map[string]string `json:"properties"`
+}
+
+// BasicQuery performs a handshake and basic stat request against the query port of the given server
+func BasicQuery(host string, port int, timeout time.Duration) (*BasicStat, error) {
+	conn, sessionId, token, err := open(host, port, timeout)
+	if err != nil {
+		return nil, err
+	}
+	//goland:noinspection GoUnhandledErrorResult
+	defer conn.Close()
+
+	payload, err := exchange(conn, packetTypeStat, sessionId, encodeStatRequest(token, false))
+	if err != nil {
+		return nil, fmt.Errorf("failed to request basic stat: %w", err)
+	}
+
+	return decodeBasicStat(payload)
+}
+
+// FullQuery performs a handshake and full stat request against the query port of the given server
+func FullQuery(host string, port int, timeout time.Duration) (*FullStat, error) {
+	conn, sessionId, token, err := open(host, port, timeout)
+	if err != nil {
+		return nil, err
+	}
+	//goland:noinspection GoUnhandledErrorResult
+	defer conn.Close()
+
+	payload, err := exchange(conn, packetTypeStat, sessionId, encodeStatRequest(token, true))
+	if err != nil {
+		return nil, fmt.Errorf("failed to request full stat: %w", err)
+	}
+
+	return decodeFullStat(payload)
+}
+
+// open dials the server and completes the handshake to obtain a challenge token
+func open(host string, port int, timeout time.Duration) (net.Conn, int32, int32, error) {
+	conn, err := net.DialTimeout("udp", net.JoinHostPort(host, strconv.Itoa(port)), timeout)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("failed to connect: %w", err)
+	}
+	if timeout > 0 {
+		_ = conn.SetDeadline(time.Now().Add(timeout))
+	}
+
+	sessionId := rand.Int31() & sessionIdMask
+
+	payload, err := exchange(conn, packetTypeHandshake, sessionId, nil)
+	if err != nil {
+		_ = conn.Close()
+		return nil, 0, 0, fmt.Errorf("failed to handshake: %w", err)
+	}
+
+	token, err := decodeChallengeToken(payload)
+	if err != nil {
+		_ = conn.Close()
+		return nil, 0, 0, err
+	}
+
+	return conn, sessionId, token, nil
+}
+
+// exchange sends a request packet and returns the payload of the response after validating
+// the response type and session ID
+func exchange(conn net.Conn, packetType byte, sessionId int32, payload []byte) ([]byte, error) {
+	_, err := conn.Write(encodeRequest(packetType, sessionId, payload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+
+	buf := make([]byte, maxPacketSize)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if n < 5 {
+		return nil, fmt.Errorf("response too short: %d bytes", n)
+	}
+
+	if buf[0] != packetType {
+		return nil, fmt.Errorf("invalid packet type received from server: %x", buf[0])
+	}
+	if gotSessionId := int32(binary.BigEndian.Uint32(buf[1:5])); gotSessionId != sessionId {
+		return nil, fmt.Errorf("mismatched session ID received from server: %x", gotSessionId)
+	}
+
+	return buf[5:n], nil
+}
+
+func encodeRequest(packetType byte, sessionId int32, payload []byte) []byte {
+	buf := new(bytes.Buffer)
+	buf.Write(magic)
+	buf.WriteByte(packetType)
+	_ = binary.Write(buf, binary.BigEndian, sessionId)
+	buf.Write(payload)
+	return buf.Bytes()
+}
+
+func encodeStatRequest(token int32, full bool) []byte {
+	buf := new(bytes.Buffer)
+	_ = binary.Write(buf, binary.BigEndian, token)
+	if full {
+		// the extra padding is what distinguishes a full stat request
+		buf.Write([]byte{0, 0, 0, 0})
+	}
+	return buf.Bytes()
+}
+
+func decodeChallengeToken(payload []byte) (int32, error) {
+	tokenStr, err := readString(bytes.NewBuffer(payload))
+	if err != nil {
+		return 0, fmt.Errorf("failed to read challenge token: %w", err)
+	}
+	// the token is sent as the decimal form of a signed 32-bit integer
+	token, err := strconv.ParseInt(tokenStr, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid challenge token %q: %w", tokenStr, err)
+	}
+	return int32(token), nil
+}
+
+func decodeBasicStat(payload []byte) (*BasicStat, error) {
+	buf := bytes.NewBuffer(payload)
+
+	var fields [5]string
+	for i := range fields {
+		value, err := readString(buf)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read basic stat field %d: %w", i, err)
+		}
+		fields[i] = value
+	}
+
+	var hostPort uint16
+	// this is the only little-endian value in the protocol
+	err := binary.Read(buf, binary.LittleEndian, &hostPort)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read host port: %w", err)
+	}
+	hostIp, err := readString(buf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read host IP: %w", err)
+	}
+
+	return &BasicStat{
+		MessageOfTheDay:    fields[0],
+		GameType:           fields[1],
+		Map:                fields[2],
+		CurrentPlayerCount: safeParseInt(fields[3]),
+		MaxPlayers:         safeParseInt(fields[4]),
+		HostPort:           hostPort,
+		HostIp:             hostIp,
+	}, nil
+}
+
+func decodeFullStat(payload []byte) (*FullStat, error) {
+	if !bytes.HasPrefix(payload, fullStatPadding) {
+		return nil, errors.New("invalid full stat response, missing key/value section")
+	}
+	buf := bytes.NewBuffer(payload[len(fullStatPadding):])
+
+	properties := make(map[string]string)
+	for {
+		key, err := readString(buf)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read key: %w", err)
+		}
+		if key == "" {
+			break
+		}
+		value, err := readString(buf)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read value of %s: %w", key, err)
+		}
+		properties[key] = value
+	}
+
+	if !bytes.HasPrefix(buf.Bytes(), playersPadding) {
+		return nil, errors.New("invalid full stat response, missing players section")
+	}
+	buf.Next(len(playersPadding))
+
+	players := make([]string, 0)
+	for {
+		player, err := readString(buf)
+		if err != nil {
+			// some servers omit the final terminator
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("failed to read player: %w", err)
+		}
+		if player == "" {
+			break
+		}
+		players = append(players, player)
+	}
+
+	serverMod, plugins := parsePlugins(properties["plugins"])
+
+	return &FullStat{
+		BasicStat: BasicStat{
+			MessageOfTheDay:    properties["hostname"],
+			GameType:           properties["gametype"],
+			Map:                properties["map"],
+			CurrentPlayerCount: safeParseInt(properties["numplayers"]),
+			MaxPlayers:         safeParseInt(properties["maxplayers"]),
+			HostPort:           uint16(safeParseInt(properties["hostport"])),
+			HostIp:             properties["hostip"],
+		},
+		GameId:     properties["game_id"],
+		Version:    properties["version"],
+		ServerMod:  serverMod,
+		Plugins:    plugins,
+		Players:    players,
+		Properties: properties,
+	}, nil
+}
+
+// parsePlugins splits the plugins value, which is formatted as
+// "ServerMod: Plugin1 1.0; Plugin2 2.0" when plugins are reported
+func parsePlugins(value string) (string, []string) {
+	plugins := make([]string, 0)
+	if value == "" {
+		return "", plugins
+	}
+
+	serverMod, list, found := strings.Cut(value, ":")
+	if !found {
+		return strings.TrimSpace(value), plugins
+	}
+
+	for _, plugin := range strings.Split(list, ";") {
+		if plugin = strings.TrimSpace(plugin); plugin != "" {
+			plugins = append(plugins, plugin)
+		}
+	}
+	return strings.TrimSpace(serverMod), plugins
+}
+
+// readString reads a null terminated string. Modern servers encode strings as UTF-8, but the
+// protocol originally specified ISO-8859-1, so that is used as a fallback.
+func readString(buf *bytes.Buffer) (string, error) {
+	raw, err := buf.ReadBytes(0)
+	if err != nil {
+		return "", err
+	}
+	raw = raw[:len(raw)-1]
+
+	if utf8.Valid(raw) {
+		return string(raw), nil
+	}
+	runes := make([]rune, len(raw))
+	for i, b := range raw {
+		runes[i] = rune(b)
+	}
+	return string(runes), nil
+}
+
+func safeParseInt(s string) int {
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		return -1
+	}
+	return i
+}
@@ -0,0 +1,153 @@
+package query
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testChallengeToken = 9513307
+
+// startFakeServer starts a UDP server that answers handshake, basic, and full stat
+// requests with canned responses
+func startFakeServer(t *testing.T) int {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+
+	go func() {
+		buf := make([]byte, 1500)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			request := buf[:n]
+			if n < 7 || !bytes.Equal(request[:2], magic) {
+				continue
+			}
+			sessionId := request[3:7]
+
+			response := new(bytes.Buffer)
+			response.WriteByte(request[2])
+			response.Write(sessionId)
+
+			switch {
+			case request[2] == packetTypeHandshake:
+				response.WriteString("9513307\x00")
+			case n == 11 && int32(binary.BigEndian.Uint32(request[7:11])) == testChallengeToken:
+				response.WriteString("A Minecraft Server\x00SMP\x00world\x002\x0020\x00")
+				_ = binary.Write(response, binary.LittleEndian, uint16(25565))
+				response.WriteString("127.0.0.1\x00")
+			case n == 15 && int32(binary.BigEndian.Uint32(request[7:11])) == testChallengeToken:
+				response.Write(fullStatPadding)
+				for _, kv := range [][2]string{
+					{"hostname", "A Minecraft Server"},
+					{"gametype", "SMP"},
+					{"game_id", "MINECRAFT"},
+					{"version", "1.20.4"},
+					{"plugins", "Paper on 1.20.4: LuckPerms 5.4.102; EssentialsX 2.20.1"},
+					{"map", "world"},
+					{"numplayers", "2"},
+					{"maxplayers", "20"},
+					{"hostport", "25565"},
+					{"hostip", "127.0.0.1"},
+				} {
+					response.WriteString(kv[0] + "\x00" + kv[1] + "\x00")
+				}
+				response.WriteByte(0)
+				response.Write(playersPadding)
+				response.WriteString("alice\x00bob\x00\x00")
+			default:
+				continue
+			}
+
+			_, _ = conn.WriteTo(response.Bytes(), addr)
+		}
+	}()
+
+	return conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+func TestBasicQuery(t *testing.T) {
+	port := startFakeServer(t)
+
+	stat, err := BasicQuery("127.0.0.1", port, 2*time.Second)
+	require.NoError(t, err)
+
+	assert.Equal(t, &BasicStat{
+		MessageOfTheDay:    "A Minecraft Server",
+		GameType:           "SMP",
+		Map:                "world",
+		CurrentPlayerCount: 2,
+		MaxPlayers:         20,
+		HostPort:           25565,
+		HostIp:             "127.0.0.1",
+	}, stat)
+}
+
+func TestFullQuery(t *testing.T) {
+	port := startFakeServer(t)
+
+	stat, err := FullQuery("127.0.0.1", port, 2*time.Second)
+	require.NoError(t, err)
+
+	assert.Equal(t, "A Minecraft Server", stat.MessageOfTheDay)
+	assert.Equal(t, "MINECRAFT", stat.GameId)
+	assert.Equal(t, "1.20.4", stat.Version)
+	assert.Equal(t, 2, stat.CurrentPlayerCount)
+	assert.Equal(t, 20, stat.MaxPlayers)
+	assert.Equal(t, uint16(25565), stat.HostPort)
+	assert.Equal(t, "Paper on 1.20.4", stat.ServerMod)
+	assert.Equal(t, []string{"LuckPerms 5.4.102", "EssentialsX 2.20.1"}, stat.Plugins)
+	assert.Equal(t, []string{"alice", "bob"}, stat.Players)
+	assert.Len(t, stat.Properties, 10)
+}
+
+func TestQueryTimeout(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	//goland:noinspection GoUnhandledErrorResult
+	defer conn.Close()
+
+	_, err = BasicQuery("127.0.0.1", conn.LocalAddr().(*net.UDPAddr).Port, 100*time.Millisecond)
+	assert.Error(t, err)
+}
+
+func Test_parsePlugins(t *testing.T) {
+	tests := []struct {
+		name              string
+		value             string
+		expectedServerMod string
+		expectedPlugins   []string
+	}{
+		{name: "vanilla", value: "", expectedPlugins: []string{}},
+		{name: "server mod only", value: "CraftBukkit on Bukkit 1.2.5-R4.0", expectedServerMod: "CraftBukkit on Bukkit 1.2.5-R4.0", expectedPlugins: []string{}},
+		{
+			name:              "with plugins",
+			value:             "CraftBukkit on Bukkit 1.2.5-R4.0: WorldEdit 5.3; CommandBook 2.1",
+			expectedServerMod: "CraftBukkit on Bukkit 1.2.5-R4.0",
+			expectedPlugins:   []string{"WorldEdit 5.3", "CommandBook 2.1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serverMod, plugins := parsePlugins(tt.value)
+			assert.Equal(t, tt.expectedServerMod, serverMod)
+			assert.Equal(t, tt.expectedPlugins, plugins)
+		})
+	}
+}
+
+func Test_encodeRequest(t *testing.T) {
+	frame := encodeRequest(packetTypeStat, 1, encodeStatRequest(testChallengeToken, true))
+	assert.Equal(t, "fefd00000000010091295b00000000", fmt.Sprintf("%x", frame))
+}
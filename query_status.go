@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/avast/retry-go"
+	"github.com/google/subcommands"
+	"github.com/itzg/go-flagsfiller"
+	"github.com/itzg/mc-monitor/query"
+	"go.uber.org/zap"
+)
+
+type statusQueryCmd struct {
+	Host string `default:"localhost" usage:"hostname of the Minecraft server" env:"MC_HOST"`
+	Port int    `default:"25565" usage:"query port of the Minecraft server, which is the server port unless query.port is set" env:"MC_QUERY_PORT"`
+
+	Basic bool `usage:"only request the basic stat, which excludes plugins and the player list"`
+
+	RetryInterval time.Duration `usage:"if retry-limit is non-zero, status will be retried at this interval" default:"10s"`
+	RetryLimit    int           `usage:"if non-zero, failed status will be retried this many times before exiting"`
+	Timeout       time.Duration `usage:"the timeout the query can take as a maximum" default:"15s"`
+
+	ShowPlayers bool `usage:"show just the names of online players, one per line, which are only included in the full stat and so can't be combined with basic"`
+	Json        bool `usage:"output server status as JSON"`
+}
+
+func (c *statusQueryCmd) Name() string {
+	return "status-query"
+}
+
+func (c *statusQueryCmd) Synopsis() string {
+	return "Retrieves and displays the status of the given Minecraft server using the Query protocol"
+}
+
+func (c *statusQueryCmd) Usage() string {
+	return ""
+}
+
+func (c *statusQueryCmd) SetFlags(flags *flag.FlagSet) {
+	filler := flagsfiller.New()
+	err := filler.Fill(flags, c)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+type statusQueryResult struct {
+	Host  string           `json:"host"`
+	Port  int              `json:"port"`
+	Basic *query.BasicStat `json:"basic,omitempty"`
+	Full  *query.FullStat  `json:"full,omitempty"`
+}
+
+func (c *statusQueryCmd) Execute(_ context.Context, _ *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
+	logger := args[0].(*zap.Logger)
+
+	if c.Basic && c.ShowPlayers {
+		printUsageError("show-players can't be combined with basic, since the basic stat has no player list")
+		return subcommands.ExitUsageError
+	}
+
+	if c.RetryInterval <= 0 {
+		c.RetryInterval = 1 * time.Second
+	}
+
+	err := retry.Do(func() error {
+		logger.Debug("querying", zap.String("host", c.Host), zap.Int("port", c.Port))
+		if c.Basic {
+			stat, err := query.BasicQuery(c.Host, c.Port, c.Timeout)
+			logger.Debug("query returned", zap.Error(err), zap.Any("stat", stat))
+			if err != nil {
+				return err
+			}
+			return c.outputBasic(stat)
+		} else {
+			stat, err := query.FullQuery(c.Host, c.Port, c.Timeout)
+			logger.Debug("query returned", zap.Error(err), zap.Any("stat", stat))
+			if err != nil {
+				return err
+			}
+			return c.outputFull(stat)
+		}
+	},
+		retry.Delay(c.RetryInterval),
+		retry.DelayType(retry.FixedDelay),
+		retry.Attempts(uint(c.RetryLimit+1)),
+		retry.LastErrorOnly(true))
+
+	if err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "failed to query %s:%d : %s", c.Host, c.Port, err)
+		return subcommands.ExitFailure
+	}
+
+	// regular output is within Do function
+	return subcommands.ExitSuccess
+}
+
+func (c *statusQueryCmd) outputBasic(stat *query.BasicStat) error {
+	if c.Json {
+		return json.NewEncoder(os.Stdout).Encode(statusQueryResult{
+			Host:  c.Host,
+			Port:  c.Port,
+			Basic: stat,
+		})
+	}
+
+	fmt.Printf("%s:%d : online=%d max=%d map='%s' motd='%s'\n",
+		c.Host, c.Port,
+		stat.CurrentPlayerCount, stat.MaxPlayers, stat.Map, stat.MessageOfTheDay)
+	return nil
+}
+
+func (c *statusQueryCmd) outputFull(stat *query.FullStat) error {
+	if c.Json {
+		return json.NewEncoder(os.Stdout).Encode(statusQueryResult{
+			Host: c.Host,
+			Port: c.Port,
+			Full: stat,
+		})
+	}
+
+	if c.ShowPlayers {
+		for _, player := range stat.Players {
+			fmt.Println(player)
+		}
+		return nil
+	}
+
+	fmt.Printf("%s:%d : version=%s online=%d max=%d map='%s' motd='%s' players=[%s] plugins=[%s]\n",
+		c.Host, c.Port,
+		stat.Version, stat.CurrentPlayerCount, stat.MaxPlayers, stat.Map, stat.MessageOfTheDay,
+		strings.Join(stat.Players, ","), strings.Join(stat.Plugins, ","))
+	return nil
+}
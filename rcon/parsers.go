@@ -0,0 +1,283 @@
+package rcon
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Names of the samples produced by the built-in parsers
+const (
+	SampleTps                = "tps"
+	SampleMspt               = "mspt"
+	SamplePlayersOnlineCount = "players_online_count"
+	SamplePlayersMaxCount    = "players_max_count"
+	SampleEntitiesCount      = "entities_loaded_count"
+)
+
+// SampleInfo describes a kind of sample along with every label key that samples of that kind may include
+type SampleInfo struct {
+	Description string
+	Labels      []string
+}
+
+// Samples describes each of the samples produced by the built-in parsers. Custom parsers registered
+// with RegisterParser should add entries for the samples they produce.
+var Samples = map[string]SampleInfo{
+	SampleTps: {
+		Description: "Ticks per second reported by the server",
+		Labels:      []string{"window", "dimension"},
+	},
+	SampleMspt: {
+		Description: "Milliseconds per tick reported by the server",
+		Labels:      []string{"window", "stat", "dimension"},
+	},
+	SamplePlayersOnlineCount: {
+		Description: "Number of players currently online, as reported by the list command",
+	},
+	SamplePlayersMaxCount: {
+		Description: "Maximum number of players allowed, as reported by the list command",
+	},
+	SampleEntitiesCount: {
+		Description: "Number of entities currently loaded",
+	},
+}
+
+// Sample is a single value parsed from the response of a command
+type Sample struct {
+	Name   string
+	Labels map[string]string
+	Value  float64
+}
+
+// Parser converts the response of a command into samples
+type Parser func(response string) ([]Sample, error)
+
+// Command pairs a command to run with the name of the parser of its response
+type Command struct {
+	Command string
+	Parser  string
+}
+
+const (
+	ServerTypeVanilla = "vanilla"
+	ServerTypePaper   = "paper"
+	ServerTypeForge   = "forge"
+)
+
+// ServerTypeCommands are the commands that are run by default for each type of server
+var ServerTypeCommands = map[string][]Command{
+	ServerTypeVanilla: {
+		{Command: "list", Parser: "list"},
+	},
+	ServerTypePaper: {
+		{Command: "tps", Parser: "paper-tps"},
+		{Command: "mspt", Parser: "paper-mspt"},
+		{Command: "list", Parser: "list"},
+	},
+	ServerTypeForge: {
+		{Command: "forge tps", Parser: "forge-tps"},
+		{Command: "forge entity list", Parser: "forge-entities"},
+		{Command: "list", Parser: "list"},
+	},
+}
+
+var (
+	parsersMu sync.RWMutex
+	parsers   = map[string]Parser{
+		"list":           ParseList,
+		"paper-tps":      ParsePaperTps,
+		"paper-mspt":     ParsePaperMspt,
+		"forge-tps":      ParseForgeTps,
+		"forge-entities": ParseForgeEntities,
+	}
+)
+
+// RegisterParser adds or replaces the parser with the given name
+func RegisterParser(name string, parser Parser) {
+	parsersMu.Lock()
+	defer parsersMu.Unlock()
+	parsers[name] = parser
+}
+
+// LookupParser returns the parser registered with the given name
+func LookupParser(name string) (Parser, bool) {
+	parsersMu.RLock()
+	defer parsersMu.RUnlock()
+	parser, ok := parsers[name]
+	return parser, ok
+}
+
+// ParserNames returns the sorted names of the registered parsers
+func ParserNames() []string {
+	parsersMu.RLock()
+	defer parsersMu.RUnlock()
+	names := make([]string, 0, len(parsers))
+	for name := range parsers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParseCommands parses entries of the form [command=parser]. When the parser is omitted,
+// the command itself is used as the parser name.
+func ParseCommands(entries []string) ([]Command, error) {
+	commands := make([]Command, 0, len(entries))
+	for _, entry := range entries {
+		command, parser, found := strings.Cut(entry, "=")
+		command = strings.TrimSpace(command)
+		if !found {
+			parser = command
+		}
+		parser = strings.TrimSpace(parser)
+		if _, ok := LookupParser(parser); !ok {
+			return nil, fmt.Errorf("unknown parser '%s' for command '%s', must be one of %s",
+				parser, command, strings.Join(ParserNames(), ", "))
+		}
+		commands = append(commands, Command{Command: command, Parser: parser})
+	}
+	return commands, nil
+}
+
+var (
+	formattingCodePattern = regexp.MustCompile("§.")
+	numberPattern         = `(-?[0-9]+(?:\.[0-9]+)?)`
+
+	// There are 3 of a max of 20 players online: a, b, c
+	// There are 3/20 players online: a, b, c
+	listPattern = regexp.MustCompile(`There are ` + numberPattern + `(?: of a max of |/)` + numberPattern + ` players online`)
+	// TPS from last 1m, 5m, 15m: 20.0, 19.98, *20.0
+	paperTpsPattern = regexp.MustCompile(`TPS from last ([^:]+):\s*(.+)`)
+	// Server tick times (avg/min/max) from last 5s, 10s, 1m:
+	// ◴ 1.2/0.5/3.4, 1.1/0.5/3.4, 1.3/0.4/5.6
+	paperMsptWindowsPattern = regexp.MustCompile(`from last ([^:]+):`)
+	paperMsptValuesPattern  = regexp.MustCompile(numberPattern + `/` + numberPattern + `/` + numberPattern)
+	// Dim  0 (overworld): Mean tick time: 0.456 ms. Mean TPS: 20.000
+	// minecraft:overworld: Mean tick time: 0.456 ms. Mean TPS: 20.000
+	// Overall: Mean tick time: 0.456 ms. Mean TPS: 20.000
+	forgeTpsPattern = regexp.MustCompile(`(?m)^\s*(.+?)\s*: Mean tick time: ` + numberPattern + ` ms\. Mean TPS: ` + numberPattern)
+	forgeDimPattern = regexp.MustCompile(`^Dim\s+-?[0-9]+\s+\((.+)\)$`)
+	// Total: 1234
+	forgeEntitiesPattern = regexp.MustCompile(`Total: ` + numberPattern)
+)
+
+func stripFormatting(s string) string {
+	return formattingCodePattern.ReplaceAllString(s, "")
+}
+
+// ParseList parses the response of the vanilla list command
+func ParseList(response string) ([]Sample, error) {
+	m := listPattern.FindStringSubmatch(stripFormatting(response))
+	if m == nil {
+		return nil, fmt.Errorf("unexpected list response: %q", response)
+	}
+	online, _ := strconv.ParseFloat(m[1], 64)
+	max, _ := strconv.ParseFloat(m[2], 64)
+	return []Sample{
+		{Name: SamplePlayersOnlineCount, Value: online},
+		{Name: SamplePlayersMaxCount, Value: max},
+	}, nil
+}
+
+// ParsePaperTps parses the response of the tps command of Paper and Spigot servers
+func ParsePaperTps(response string) ([]Sample, error) {
+	m := paperTpsPattern.FindStringSubmatch(stripFormatting(response))
+	if m == nil {
+		return nil, fmt.Errorf("unexpected tps response: %q", response)
+	}
+	windows := splitList(m[1])
+	values := splitList(m[2])
+	if len(windows) != len(values) {
+		return nil, fmt.Errorf("mismatched tps windows and values: %q", response)
+	}
+
+	samples := make([]Sample, 0, len(values))
+	for i, value := range values {
+		// values above 20 are prefixed with an asterisk since they are capped for display
+		tps, err := strconv.ParseFloat(strings.TrimPrefix(value, "*"), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tps value %q: %w", value, err)
+		}
+		samples = append(samples, Sample{Name: SampleTps, Labels: map[string]string{"window": windows[i]}, Value: tps})
+	}
+	return samples, nil
+}
+
+// ParsePaperMspt parses the response of the mspt command of Paper servers
+func ParsePaperMspt(response string) ([]Sample, error) {
+	stripped := stripFormatting(response)
+	loc := paperMsptWindowsPattern.FindStringSubmatchIndex(stripped)
+	if loc == nil {
+		return nil, fmt.Errorf("unexpected mspt response: %q", response)
+	}
+	windows := splitList(stripped[loc[2]:loc[3]])
+
+	valuesMatches := paperMsptValuesPattern.FindAllStringSubmatch(stripped[loc[1]:], -1)
+	if len(valuesMatches) != len(windows) {
+		return nil, fmt.Errorf("mismatched mspt windows and values: %q", response)
+	}
+
+	samples := make([]Sample, 0, len(windows)*3)
+	for i, values := range valuesMatches {
+		for j, stat := range []string{"avg", "min", "max"} {
+			value, _ := strconv.ParseFloat(values[j+1], 64)
+			samples = append(samples, Sample{
+				Name:   SampleMspt,
+				Labels: map[string]string{"window": windows[i], "stat": stat},
+				Value:  value,
+			})
+		}
+	}
+	return samples, nil
+}
+
+// ParseForgeTps parses the response of the forge tps command, which reports each dimension
+// along with an overall entry
+func ParseForgeTps(response string) ([]Sample, error) {
+	matches := forgeTpsPattern.FindAllStringSubmatch(stripFormatting(response), -1)
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("unexpected forge tps response: %q", response)
+	}
+
+	samples := make([]Sample, 0, len(matches)*2)
+	for _, m := range matches {
+		dimension := m[1]
+		if dm := forgeDimPattern.FindStringSubmatch(dimension); dm != nil {
+			dimension = dm[1]
+		}
+		dimension = strings.ToLower(dimension)
+		mspt, _ := strconv.ParseFloat(m[2], 64)
+		tps, _ := strconv.ParseFloat(m[3], 64)
+		labels := map[string]string{"dimension": dimension}
+		samples = append(samples,
+			Sample{Name: SampleTps, Labels: labels, Value: tps},
+			Sample{Name: SampleMspt, Labels: labels, Value: mspt},
+		)
+	}
+	return samples, nil
+}
+
+// ParseForgeEntities parses the total from the response of the forge entity list command
+func ParseForgeEntities(response string) ([]Sample, error) {
+	m := forgeEntitiesPattern.FindStringSubmatch(stripFormatting(response))
+	if m == nil {
+		return nil, fmt.Errorf("unexpected forge entity list response: %q", response)
+	}
+	total, _ := strconv.ParseFloat(m[1], 64)
+	return []Sample{{Name: SampleEntitiesCount, Value: total}}, nil
+}
+
+func splitList(s string) []string {
+	parts := strings.Split(s, ",")
+	result := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if part = strings.TrimSpace(part); part != "" {
+			result = append(result, part)
+		}
+	}
+	return result
+}
@@ -0,0 +1,124 @@
+package rcon
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsers(t *testing.T) {
+	tests := []struct {
+		name     string
+		parser   Parser
+		response string
+		expected []Sample
+	}{
+		{
+			name:     "list",
+			parser:   ParseList,
+			response: "There are 3 of a max of 20 players online: a, b, c",
+			expected: []Sample{
+				{Name: SamplePlayersOnlineCount, Value: 3},
+				{Name: SamplePlayersMaxCount, Value: 20},
+			},
+		},
+		{
+			name:     "legacy list",
+			parser:   ParseList,
+			response: "There are 0/10 players online:",
+			expected: []Sample{
+				{Name: SamplePlayersOnlineCount, Value: 0},
+				{Name: SamplePlayersMaxCount, Value: 10},
+			},
+		},
+		{
+			name:     "paper tps",
+			parser:   ParsePaperTps,
+			response: "§6TPS from last 5s, 1m, 5m, 15m: §a20.0, §a*20.0, §e17.53, §a19.99",
+			expected: []Sample{
+				{Name: SampleTps, Labels: map[string]string{"window": "5s"}, Value: 20},
+				{Name: SampleTps, Labels: map[string]string{"window": "1m"}, Value: 20},
+				{Name: SampleTps, Labels: map[string]string{"window": "5m"}, Value: 17.53},
+				{Name: SampleTps, Labels: map[string]string{"window": "15m"}, Value: 19.99},
+			},
+		},
+		{
+			name:     "paper mspt",
+			parser:   ParsePaperMspt,
+			response: "§6Server tick times §e(§7avg§e/§7min§e/§7max§e)§6 from last 5s§7,§6 10s§7,§6 1m§e:\n§6◴ §a1.2§7/§a0.5§7/§a3.4§e, §a1.1§7/§a0.4§7/§a3.4§e, §a1.3§7/§a0.4§7/§c55.6",
+			expected: []Sample{
+				{Name: SampleMspt, Labels: map[string]string{"window": "5s", "stat": "avg"}, Value: 1.2},
+				{Name: SampleMspt, Labels: map[string]string{"window": "5s", "stat": "min"}, Value: 0.5},
+				{Name: SampleMspt, Labels: map[string]string{"window": "5s", "stat": "max"}, Value: 3.4},
+				{Name: SampleMspt, Labels: map[string]string{"window": "10s", "stat": "avg"}, Value: 1.1},
+				{Name: SampleMspt, Labels: map[string]string{"window": "10s", "stat": "min"}, Value: 0.4},
+				{Name: SampleMspt, Labels: map[string]string{"window": "10s", "stat": "max"}, Value: 3.4},
+				{Name: SampleMspt, Labels: map[string]string{"window": "1m", "stat": "avg"}, Value: 1.3},
+				{Name: SampleMspt, Labels: map[string]string{"window": "1m", "stat": "min"}, Value: 0.4},
+				{Name: SampleMspt, Labels: map[string]string{"window": "1m", "stat": "max"}, Value: 55.6},
+			},
+		},
+		{
+			name:   "forge tps",
+			parser: ParseForgeTps,
+			response: "minecraft:overworld: Mean tick time: 1.234 ms. Mean TPS: 20.000\n" +
+				"minecraft:the_nether: Mean tick time: 0.100 ms. Mean TPS: 19.500\n" +
+				"Overall: Mean tick time: 1.400 ms. Mean TPS: 20.000",
+			expected: []Sample{
+				{Name: SampleTps, Labels: map[string]string{"dimension": "minecraft:overworld"}, Value: 20},
+				{Name: SampleMspt, Labels: map[string]string{"dimension": "minecraft:overworld"}, Value: 1.234},
+				{Name: SampleTps, Labels: map[string]string{"dimension": "minecraft:the_nether"}, Value: 19.5},
+				{Name: SampleMspt, Labels: map[string]string{"dimension": "minecraft:the_nether"}, Value: 0.1},
+				{Name: SampleTps, Labels: map[string]string{"dimension": "overall"}, Value: 20},
+				{Name: SampleMspt, Labels: map[string]string{"dimension": "overall"}, Value: 1.4},
+			},
+		},
+		{
+			name:     "legacy forge tps",
+			parser:   ParseForgeTps,
+			response: "Dim  0 (Overworld) : Mean tick time: 0.456 ms. Mean TPS: 20.000",
+			expected: []Sample{
+				{Name: SampleTps, Labels: map[string]string{"dimension": "overworld"}, Value: 20},
+				{Name: SampleMspt, Labels: map[string]string{"dimension": "overworld"}, Value: 0.456},
+			},
+		},
+		{
+			name:     "forge entities",
+			parser:   ParseForgeEntities,
+			response: "Total: 1234\n  512: minecraft:zombie\n  722: minecraft:item",
+			expected: []Sample{
+				{Name: SampleEntitiesCount, Value: 1234},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			samples, err := tt.parser(tt.response)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, samples)
+		})
+	}
+}
+
+func TestParsersRejectUnexpected(t *testing.T) {
+	for _, name := range ParserNames() {
+		t.Run(name, func(t *testing.T) {
+			parser, _ := LookupParser(name)
+			_, err := parser("Unknown or incomplete command, see below for error")
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestParseCommands(t *testing.T) {
+	commands, err := ParseCommands([]string{"tps=paper-tps", "list"})
+	require.NoError(t, err)
+	assert.Equal(t, []Command{
+		{Command: "tps", Parser: "paper-tps"},
+		{Command: "list", Parser: "list"},
+	}, commands)
+
+	_, err = ParseCommands([]string{"tps=unknown"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,197 @@
+package rcon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/itzg/mc-monitor/utils"
+	"go.uber.org/zap"
+)
+
+// Config declares the RCON collection options of the commands that support it
+type Config struct {
+	Servers      []string      `usage:"one or more [host:port] RCON addresses of servers to run commands against, when port is omitted 25575 is used"`
+	ServerType   string        `default:"vanilla" usage:"type of server that selects the default commands: vanilla, paper, or forge"`
+	Commands     []string      `usage:"commands to run instead of the server type defaults, each given as [command=parser]"`
+	Interval     time.Duration `default:"30s" usage:"interval at which the commands are run"`
+	Timeout      time.Duration `default:"10s" usage:"timeout of connecting and running each command"`
+	PasswordFile string        `usage:"file containing the RCON password"`
+	PasswordEnv  string        `default:"RCON_PASSWORD" usage:"name of the environment variable containing the RCON password, used when password-file is not set"`
+}
+
+// Password reads the password from the configured file or environment variable
+func (c *Config) Password() (string, error) {
+	if c.PasswordFile != "" {
+		content, err := os.ReadFile(c.PasswordFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read RCON password file: %w", err)
+		}
+		return strings.TrimSpace(string(content)), nil
+	}
+
+	if c.PasswordEnv != "" {
+		if password, ok := os.LookupEnv(c.PasswordEnv); ok {
+			return password, nil
+		}
+	}
+	return "", errors.New("RCON password requires a password file or environment variable")
+}
+
+// ResolveCommands returns the configured commands or the defaults of the configured server type
+func (c *Config) ResolveCommands() ([]Command, error) {
+	if len(c.Commands) > 0 {
+		return ParseCommands(c.Commands)
+	}
+
+	commands, ok := ServerTypeCommands[strings.ToLower(c.ServerType)]
+	if !ok {
+		return nil, fmt.Errorf("unknown RCON server type '%s'", c.ServerType)
+	}
+	return commands, nil
+}
+
+// NewPollers creates a Poller for each of the configured servers
+func (c *Config) NewPollers(logger *zap.Logger) ([]*Poller, error) {
+	if len(c.Servers) == 0 {
+		return nil, nil
+	}
+
+	password, err := c.Password()
+	if err != nil {
+		return nil, err
+	}
+	commands, err := c.ResolveCommands()
+	if err != nil {
+		return nil, err
+	}
+
+	pollers := make([]*Poller, 0, len(c.Servers))
+	for _, server := range c.Servers {
+		host, port, _, err := utils.ParseHostPort(server, utils.DefaultRconPort)
+		if err != nil {
+			return nil, fmt.Errorf("failed to process RCON server entry '%s': %w", server, err)
+		}
+		pollers = append(pollers, NewPoller(host, port, password, commands, c.Timeout, logger))
+	}
+	return pollers, nil
+}
+
+// Poller periodically runs commands against a server and retains the samples parsed from the
+// most recent responses.
+type Poller struct {
+	host     string
+	port     uint16
+	password string
+	commands []Command
+	timeout  time.Duration
+	logger   *zap.Logger
+
+	client *Client
+
+	mu      sync.RWMutex
+	up      bool
+	samples []Sample
+}
+
+func NewPoller(host string, port uint16, password string, commands []Command, timeout time.Duration, logger *zap.Logger) *Poller {
+	return &Poller{
+		host:     host,
+		port:     port,
+		password: password,
+		commands: commands,
+		timeout:  timeout,
+		logger:   logger,
+	}
+}
+
+func (p *Poller) Host() string {
+	return p.host
+}
+
+func (p *Poller) Port() uint16 {
+	return p.port
+}
+
+// Run polls immediately and then at the given interval until the context is done
+func (p *Poller) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		p.Poll()
+
+		select {
+		case <-ctx.Done():
+			if p.client != nil {
+				_ = p.client.Close()
+				p.client = nil
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Poll runs each command once, re-using the connection from the previous poll when possible.
+// Only a single Poll may run at a time.
+func (p *Poller) Poll() {
+	address := net.JoinHostPort(p.host, strconv.Itoa(int(p.port)))
+
+	if p.client == nil {
+		client, err := Dial(address, p.password, p.timeout)
+		if err != nil {
+			p.logger.Warn("failed to connect to RCON", zap.String("address", address), zap.Error(err))
+			p.update(false, nil)
+			return
+		}
+		p.client = client
+	}
+
+	var samples []Sample
+	for _, command := range p.commands {
+		response, err := p.client.Execute(command.Command)
+		if err != nil {
+			p.logger.Warn("failed to run RCON command",
+				zap.String("address", address), zap.String("command", command.Command), zap.Error(err))
+			_ = p.client.Close()
+			p.client = nil
+			p.update(false, nil)
+			return
+		}
+		p.logger.Debug("RCON command returned",
+			zap.String("address", address), zap.String("command", command.Command), zap.String("response", response))
+
+		parser, _ := LookupParser(command.Parser)
+		parsed, err := parser(response)
+		if err != nil {
+			// the server is still reachable, but may not support the command
+			p.logger.Warn("failed to parse RCON response",
+				zap.String("address", address), zap.String("command", command.Command), zap.Error(err))
+			continue
+		}
+		samples = append(samples, parsed...)
+	}
+
+	p.update(true, samples)
+}
+
+func (p *Poller) update(up bool, samples []Sample) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.up = up
+	p.samples = samples
+}
+
+// Snapshot returns if the server was reachable during the most recent poll and the samples parsed from that poll
+func (p *Poller) Snapshot() (bool, []Sample) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.up, p.samples
+}
@@ -0,0 +1,184 @@
+// Package rcon implements a client of the Source RCON protocol as implemented by Minecraft Java Edition servers
+// along with parsers that turn the responses of common commands into metric samples.
+// See https://wiki.vg/RCON
+package rcon
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	PacketTypeResponse = 0
+	PacketTypeCommand  = 2
+	PacketTypeLogin    = 3
+
+	// maxFragmentSize is the size of response bodies at which vanilla servers split responses into
+	// multiple packets
+	maxFragmentSize = 4096
+	// maxPacketLength guards against a corrupt length prefix
+	maxPacketLength = 1024 * 1024
+	// fragmentWait is how long to wait for a possible continuation of a response at maxFragmentSize
+	fragmentWait = 250 * time.Millisecond
+
+	// authFailedId is the request ID servers respond with when authentication fails
+	authFailedId = -1
+)
+
+var ErrAuthenticationFailed = errors.New("RCON authentication failed")
+
+type Packet struct {
+	RequestId int32
+	Type      int32
+	Body      string
+}
+
+// Client is a connection to an RCON server. Commands are serialized, so a Client can be shared across goroutines.
+type Client struct {
+	conn    net.Conn
+	timeout time.Duration
+	nextId  int32
+	mu      sync.Mutex
+}
+
+// Dial connects to the RCON server at the given [host:port] address and authenticates with the given password.
+// The timeout is applied to the connection and each subsequent command.
+func Dial(address string, password string, timeout time.Duration) (*Client, error) {
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect: %w", err)
+	}
+
+	c := &Client{conn: conn, timeout: timeout}
+	err = c.authenticate(password)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+func (c *Client) authenticate(password string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	id := c.allocateId()
+	c.setDeadline()
+	err := WritePacket(c.conn, Packet{RequestId: id, Type: PacketTypeLogin, Body: password})
+	if err != nil {
+		return fmt.Errorf("failed to send login: %w", err)
+	}
+
+	for {
+		response, err := ReadPacket(c.conn)
+		if err != nil {
+			return fmt.Errorf("failed to read login response: %w", err)
+		}
+		if response.RequestId == authFailedId {
+			return ErrAuthenticationFailed
+		}
+		// some servers precede the auth response with an empty response value packet
+		if response.Type == PacketTypeCommand && response.RequestId == id {
+			return nil
+		}
+	}
+}
+
+// Execute runs the given command and returns the response, which is reassembled when the server
+// split it into multiple packets.
+func (c *Client) Execute(command string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	id := c.allocateId()
+	c.setDeadline()
+	err := WritePacket(c.conn, Packet{RequestId: id, Type: PacketTypeCommand, Body: command})
+	if err != nil {
+		return "", fmt.Errorf("failed to send command: %w", err)
+	}
+
+	var body bytes.Buffer
+	for {
+		response, err := ReadPacket(c.conn)
+		if err != nil {
+			var netErr net.Error
+			if body.Len() > 0 && errors.As(err, &netErr) && netErr.Timeout() {
+				// no continuation arrived for a response that happened to be exactly a fragment in size
+				break
+			}
+			return "", fmt.Errorf("failed to read response: %w", err)
+		}
+		if response.RequestId == authFailedId {
+			return "", ErrAuthenticationFailed
+		}
+		if response.RequestId != id {
+			continue
+		}
+		body.WriteString(response.Body)
+		if len(response.Body) < maxFragmentSize {
+			break
+		}
+		_ = c.conn.SetReadDeadline(time.Now().Add(fragmentWait))
+	}
+
+	return body.String(), nil
+}
+
+func (c *Client) allocateId() int32 {
+	c.nextId++
+	return c.nextId
+}
+
+func (c *Client) setDeadline() {
+	if c.timeout > 0 {
+		_ = c.conn.SetDeadline(time.Now().Add(c.timeout))
+	}
+}
+
+// WritePacket encodes the given packet, which is little-endian length prefixed and
+// terminated by two null bytes
+func WritePacket(w io.Writer, packet Packet) error {
+	buf := new(bytes.Buffer)
+	_ = binary.Write(buf, binary.LittleEndian, int32(4+4+len(packet.Body)+2))
+	_ = binary.Write(buf, binary.LittleEndian, packet.RequestId)
+	_ = binary.Write(buf, binary.LittleEndian, packet.Type)
+	buf.WriteString(packet.Body)
+	buf.Write([]byte{0, 0})
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// ReadPacket decodes a packet written by WritePacket
+func ReadPacket(r io.Reader) (Packet, error) {
+	var length int32
+	err := binary.Read(r, binary.LittleEndian, &length)
+	if err != nil {
+		return Packet{}, err
+	}
+	if length < 10 || length > maxPacketLength {
+		return Packet{}, fmt.Errorf("invalid packet length: %d", length)
+	}
+
+	payload := make([]byte, length)
+	_, err = io.ReadFull(r, payload)
+	if err != nil {
+		return Packet{}, err
+	}
+
+	return Packet{
+		RequestId: int32(binary.LittleEndian.Uint32(payload[0:4])),
+		Type:      int32(binary.LittleEndian.Uint32(payload[4:8])),
+		Body:      string(bytes.TrimRight(payload[8:], "\x00")),
+	}, nil
+}
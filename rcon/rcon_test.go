@@ -0,0 +1,122 @@
+package rcon_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/itzg/mc-monitor/rcon"
+	"github.com/itzg/mc-monitor/rcon/rcontest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestClientExecute(t *testing.T) {
+	server := rcontest.NewServer("secret", func(command string) string {
+		return "ran " + command
+	})
+	defer server.Close()
+
+	client, err := rcon.Dial(server.Addr(), "secret", time.Second)
+	require.NoError(t, err)
+	//goland:noinspection GoUnhandledErrorResult
+	defer client.Close()
+
+	response, err := client.Execute("list")
+	require.NoError(t, err)
+	assert.Equal(t, "ran list", response)
+
+	response, err = client.Execute("tps")
+	require.NoError(t, err)
+	assert.Equal(t, "ran tps", response)
+
+	assert.Equal(t, []string{"list", "tps"}, server.Commands())
+}
+
+func TestClientFragmentedResponse(t *testing.T) {
+	long := strings.Repeat("x", 4096*2+10)
+	exact := strings.Repeat("y", 4096)
+	server := rcontest.NewServer("secret", func(command string) string {
+		if command == "exact" {
+			return exact
+		}
+		return long
+	})
+	defer server.Close()
+
+	client, err := rcon.Dial(server.Addr(), "secret", time.Second)
+	require.NoError(t, err)
+	//goland:noinspection GoUnhandledErrorResult
+	defer client.Close()
+
+	response, err := client.Execute("long")
+	require.NoError(t, err)
+	assert.Equal(t, long, response)
+
+	response, err = client.Execute("exact")
+	require.NoError(t, err)
+	assert.Equal(t, exact, response)
+}
+
+func TestClientAuthenticationFailed(t *testing.T) {
+	server := rcontest.NewServer("secret", func(command string) string {
+		return ""
+	})
+	defer server.Close()
+
+	_, err := rcon.Dial(server.Addr(), "wrong", time.Second)
+	assert.ErrorIs(t, err, rcon.ErrAuthenticationFailed)
+}
+
+func TestPollerPoll(t *testing.T) {
+	server := rcontest.NewServer("secret", func(command string) string {
+		switch command {
+		case "tps":
+			return "§6TPS from last 1m, 5m, 15m: §a19.5, §a*20.0, §a20.0"
+		case "list":
+			return "There are 2 of a max of 20 players online: alice, bob"
+		}
+		return "Unknown command"
+	})
+	defer server.Close()
+
+	poller := rcon.NewPoller(server.Host(), server.Port(), "secret", []rcon.Command{
+		{Command: "tps", Parser: "paper-tps"},
+		{Command: "mspt", Parser: "paper-mspt"},
+		{Command: "list", Parser: "list"},
+	}, time.Second, zap.NewNop())
+
+	poller.Poll()
+
+	up, samples := poller.Snapshot()
+	assert.True(t, up)
+	assert.Equal(t, []rcon.Sample{
+		{Name: rcon.SampleTps, Labels: map[string]string{"window": "1m"}, Value: 19.5},
+		{Name: rcon.SampleTps, Labels: map[string]string{"window": "5m"}, Value: 20},
+		{Name: rcon.SampleTps, Labels: map[string]string{"window": "15m"}, Value: 20},
+		{Name: rcon.SamplePlayersOnlineCount, Value: 2},
+		{Name: rcon.SamplePlayersMaxCount, Value: 20},
+	}, samples)
+
+	server.Close()
+	poller.Poll()
+	// existing connection is still usable after the listener is closed
+	up, _ = poller.Snapshot()
+	assert.True(t, up)
+}
+
+func TestPollerUnreachable(t *testing.T) {
+	server := rcontest.NewServer("secret", func(command string) string {
+		return ""
+	})
+	host, port := server.Host(), server.Port()
+	server.Close()
+
+	poller := rcon.NewPoller(host, port, "secret", []rcon.Command{{Command: "list", Parser: "list"}}, time.Second, zap.NewNop())
+	poller.Poll()
+
+	up, samples := poller.Snapshot()
+	assert.False(t, up)
+	assert.Empty(t, samples)
+}
@@ -0,0 +1,138 @@
+// Package rcontest provides an in-process RCON server for use in tests, similar to httptest
+package rcontest
+
+import (
+	"net"
+	"strconv"
+	"sync"
+
+	"github.com/itzg/mc-monitor/rcon"
+)
+
+// Handler returns the response of the given command
+type Handler func(command string) string
+
+// Server is a fake RCON server that accepts connections on a loopback port
+type Server struct {
+	listener net.Listener
+	password string
+	handler  Handler
+
+	mu       sync.Mutex
+	commands []string
+	wg       sync.WaitGroup
+}
+
+// NewServer starts a server that requires the given password and responds to commands using the handler
+func NewServer(password string, handler Handler) *Server {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic("rcontest: failed to listen: " + err.Error())
+	}
+
+	s := &Server{
+		listener: listener,
+		password: password,
+		handler:  handler,
+	}
+	s.wg.Add(1)
+	go s.serve()
+	return s
+}
+
+// Addr returns the [host:port] address of the server
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Host returns the host of the server's address
+func (s *Server) Host() string {
+	host, _, _ := net.SplitHostPort(s.Addr())
+	return host
+}
+
+// Port returns the port of the server's address
+func (s *Server) Port() uint16 {
+	_, port, _ := net.SplitHostPort(s.Addr())
+	parsed, _ := strconv.ParseUint(port, 10, 16)
+	return uint16(parsed)
+}
+
+// Commands returns the commands that have been received so far
+func (s *Server) Commands() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.commands...)
+}
+
+// Close stops accepting connections
+func (s *Server) Close() {
+	_ = s.listener.Close()
+	s.wg.Wait()
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	//goland:noinspection GoUnhandledErrorResult
+	defer conn.Close()
+
+	authenticated := false
+	for {
+		packet, err := rcon.ReadPacket(conn)
+		if err != nil {
+			return
+		}
+
+		switch packet.Type {
+		case rcon.PacketTypeLogin:
+			if packet.Body == s.password {
+				authenticated = true
+				err = rcon.WritePacket(conn, rcon.Packet{RequestId: packet.RequestId, Type: rcon.PacketTypeCommand})
+			} else {
+				err = rcon.WritePacket(conn, rcon.Packet{RequestId: -1, Type: rcon.PacketTypeCommand})
+			}
+
+		case rcon.PacketTypeCommand:
+			if !authenticated {
+				err = rcon.WritePacket(conn, rcon.Packet{RequestId: -1, Type: rcon.PacketTypeResponse})
+				break
+			}
+			s.mu.Lock()
+			s.commands = append(s.commands, packet.Body)
+			s.mu.Unlock()
+			err = s.respond(conn, packet.RequestId, s.handler(packet.Body))
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// respond splits the response into fragments the same way as vanilla servers
+func (s *Server) respond(conn net.Conn, requestId int32, response string) error {
+	const fragmentSize = 4096
+	for {
+		fragment := response
+		if len(fragment) > fragmentSize {
+			fragment = fragment[:fragmentSize]
+		}
+		err := rcon.WritePacket(conn, rcon.Packet{RequestId: requestId, Type: rcon.PacketTypeResponse, Body: fragment})
+		if err != nil {
+			return err
+		}
+		response = response[len(fragment):]
+		if len(fragment) < fragmentSize || response == "" {
+			return nil
+		}
+	}
+}
@@ -1,8 +1,10 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"time"
 )
 
 const (
@@ -35,3 +37,19 @@ func ValidEdition(v string) bool {
 func printUsageError(msg string) {
 	_, _ = fmt.Fprintln(os.Stderr, msg)
 }
+
+// withOptionalTimeout applies the timeout to the context only when the timeout is positive
+func withOptionalTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// limitTimeout returns the timeout limited to the given limit, where a timeout of zero has no limit of its own
+func limitTimeout(timeout time.Duration, limit time.Duration) time.Duration {
+	if timeout <= 0 || limit < timeout {
+		return limit
+	}
+	return timeout
+}
@@ -0,0 +1,37 @@
+package slp
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+// faviconDataPrefix is the start of the data URI of favicons, which are always 64x64 PNG images
+const faviconDataPrefix = "data:image/png;base64,"
+
+// FaviconPng decodes the favicon into a PNG image. A nil result is returned when the server
+// did not report a favicon.
+func (r *StatusResponse) FaviconPng() ([]byte, error) {
+	if r.Favicon == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(r.Favicon, faviconDataPrefix) {
+		return nil, errors.New("favicon is not a base64 encoded PNG data URI")
+	}
+	// some servers wrap the encoded content across lines
+	encoded := strings.NewReplacer("\n", "", "\r", "").Replace(r.Favicon[len(faviconDataPrefix):])
+	return base64.StdEncoding.DecodeString(encoded)
+}
+
+// FaviconHash returns the hex encoded SHA-256 hash of the favicon image or an empty string when the
+// server did not report a favicon.
+func (r *StatusResponse) FaviconHash() (string, error) {
+	image, err := r.FaviconPng()
+	if err != nil || image == nil {
+		return "", err
+	}
+	sum := sha256.Sum256(image)
+	return hex.EncodeToString(sum[:]), nil
+}
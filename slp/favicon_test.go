@@ -0,0 +1,41 @@
+package slp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFavicon(t *testing.T) {
+	response := &StatusResponse{Favicon: "data:image/png;base64,iVBORw0K\nGgo="}
+
+	image, err := response.FaviconPng()
+	require.NoError(t, err)
+	assert.Equal(t, []byte("\x89PNG\r\n\x1a\n"), image)
+
+	hash, err := response.FaviconHash()
+	require.NoError(t, err)
+	assert.Equal(t, "4c4b6a3be1314ab86138bef4314dde022e600960d8689a2c8f8631802d20dab6", hash)
+}
+
+func TestFaviconMissing(t *testing.T) {
+	response := &StatusResponse{}
+
+	image, err := response.FaviconPng()
+	require.NoError(t, err)
+	assert.Nil(t, image)
+
+	hash, err := response.FaviconHash()
+	require.NoError(t, err)
+	assert.Empty(t, hash)
+}
+
+func TestFaviconInvalid(t *testing.T) {
+	response := &StatusResponse{Favicon: "data:image/jpeg;base64,AAAA"}
+
+	_, err := response.FaviconPng()
+	assert.Error(t, err)
+	_, err = response.FaviconHash()
+	assert.Error(t, err)
+}
@@ -0,0 +1,199 @@
+package slp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"unicode/utf16"
+)
+
+// Mod is a mod reported in the status response of a Forge or NeoForge server
+type Mod struct {
+	Id string `json:"id"`
+	// Version is empty when the mod does not need to be present on clients
+	Version string `json:"version,omitempty"`
+}
+
+// ForgeInfo is the mod metadata of Forge and NeoForge servers, which is reported in the forgeData field
+// since 1.13 and the modinfo field before then.
+type ForgeInfo struct {
+	// FmlNetworkVersion is the version of the FML network protocol or zero for the legacy modinfo format
+	FmlNetworkVersion int `json:"fml_network_version"`
+	// Type is only reported by the legacy modinfo format, such as "FML"
+	Type string `json:"type,omitempty"`
+	Mods []Mod  `json:"mods"`
+	// Truncated indicates the server omitted some mods to keep the response small
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// forgeIgnoreServerOnly is the FML2 mod marker of mods that are not required on clients
+const forgeIgnoreServerOnly = "OHNOES\U0001f631\U0001f631\U0001f631\U0001f631\U0001f631\U0001f631\U0001f631\U0001f631\U0001f631\U0001f631\U0001f631\U0001f631\U0001f631\U0001f631\U0001f631\U0001f631\U0001f631"
+
+type forgeStatus struct {
+	ForgeData *struct {
+		FmlNetworkVersion int  `json:"fmlNetworkVersion"`
+		Truncated         bool `json:"truncated"`
+		Mods              []struct {
+			ModId     string `json:"modId"`
+			ModMarker string `json:"modmarker"`
+		} `json:"mods"`
+		// D is the optimized encoding of the mod list used since FML3
+		D string `json:"d"`
+	} `json:"forgeData"`
+	ModInfo *struct {
+		Type    string `json:"type"`
+		ModList []struct {
+			ModId   string `json:"modid"`
+			Version string `json:"version"`
+		} `json:"modList"`
+	} `json:"modinfo"`
+}
+
+// ForgeInfo parses the mod metadata from the raw status response. A nil result is returned
+// when the server did not report any.
+func (r *StatusResponse) ForgeInfo() (*ForgeInfo, error) {
+	if r.Raw == nil {
+		return nil, nil
+	}
+
+	var status forgeStatus
+	err := json.Unmarshal(r.Raw, &status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse forge metadata: %w", err)
+	}
+
+	switch {
+	case status.ForgeData != nil:
+		info := &ForgeInfo{
+			FmlNetworkVersion: status.ForgeData.FmlNetworkVersion,
+			Truncated:         status.ForgeData.Truncated,
+			Mods:              make([]Mod, 0, len(status.ForgeData.Mods)),
+		}
+		if status.ForgeData.D != "" {
+			decoded, err := decodeForgeOptimized(status.ForgeData.D)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode forge mod list: %w", err)
+			}
+			info.Mods, info.Truncated, err = parseForgeModList(decoded)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse forge mod list: %w", err)
+			}
+			return info, nil
+		}
+		for _, mod := range status.ForgeData.Mods {
+			version := mod.ModMarker
+			if version == forgeIgnoreServerOnly {
+				version = ""
+			}
+			info.Mods = append(info.Mods, Mod{Id: mod.ModId, Version: version})
+		}
+		return info, nil
+
+	case status.ModInfo != nil:
+		info := &ForgeInfo{
+			Type: status.ModInfo.Type,
+			Mods: make([]Mod, 0, len(status.ModInfo.ModList)),
+		}
+		for _, mod := range status.ModInfo.ModList {
+			info.Mods = append(info.Mods, Mod{Id: mod.ModId, Version: mod.Version})
+		}
+		return info, nil
+	}
+
+	return nil, nil
+}
+
+// decodeForgeOptimized unpacks the binary payload that FML3 packs into the 15 low bits of each character
+// of a string. The first two characters encode the length of the payload.
+func decodeForgeOptimized(s string) ([]byte, error) {
+	chars := utf16.Encode([]rune(s))
+	if len(chars) < 2 {
+		return nil, errors.New("encoded data is too short")
+	}
+	size := int(chars[0]&0x7FFF) | int(chars[1]&0x7FFF)<<15
+
+	decoded := make([]byte, 0, size)
+	var buffer uint32
+	bits := 0
+	for _, c := range chars[2:] {
+		for bits >= 8 {
+			decoded = append(decoded, byte(buffer))
+			buffer >>= 8
+			bits -= 8
+		}
+		buffer |= uint32(c&0x7FFF) << bits
+		bits += 15
+	}
+	for len(decoded) < size && bits > 0 {
+		decoded = append(decoded, byte(buffer))
+		buffer >>= 8
+		bits -= 8
+	}
+
+	if len(decoded) < size {
+		return nil, fmt.Errorf("encoded data has %d bytes, but expected %d", len(decoded), size)
+	}
+	return decoded[:size], nil
+}
+
+// parseForgeModList parses the mod list written by FML3's ServerStatusPing serializer
+func parseForgeModList(data []byte) ([]Mod, bool, error) {
+	r := bufio.NewReader(bytes.NewReader(data))
+
+	truncated, err := r.ReadByte()
+	if err != nil {
+		return nil, false, err
+	}
+	var modCount uint16
+	err = binary.Read(r, binary.BigEndian, &modCount)
+	if err != nil {
+		return nil, false, err
+	}
+
+	mods := make([]Mod, 0, modCount)
+	for i := 0; i < int(modCount); i++ {
+		flags, err := readVarInt(r)
+		if err != nil {
+			return nil, false, err
+		}
+		channelCount := int(flags >> 1)
+		ignoreServerOnly := flags&1 != 0
+
+		var mod Mod
+		mod.Id, err = readVarString(r, 0)
+		if err != nil {
+			return nil, false, err
+		}
+		if !ignoreServerOnly {
+			mod.Version, err = readVarString(r, 0)
+			if err != nil {
+				return nil, false, err
+			}
+		}
+		// channels of the mod are not retained
+		for j := 0; j < channelCount; j++ {
+			err = skipForgeChannel(r)
+			if err != nil {
+				return nil, false, err
+			}
+		}
+
+		mods = append(mods, mod)
+	}
+
+	return mods, truncated != 0, nil
+}
+
+// skipForgeChannel reads past a channel entry, which is the name, version, and required-on-client flag
+func skipForgeChannel(r *bufio.Reader) error {
+	for i := 0; i < 2; i++ {
+		if _, err := readVarString(r, 0); err != nil {
+			return err
+		}
+	}
+	_, err := r.ReadByte()
+	return err
+}
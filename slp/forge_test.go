@@ -0,0 +1,141 @@
+package slp
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// encodeForgeOptimized packs data like FML3's ServerStatusPing serializer
+func encodeForgeOptimized(data []byte) string {
+	chars := []uint16{uint16(len(data) & 0x7FFF), uint16(len(data) >> 15 & 0x7FFF)}
+	var buffer uint32
+	bits := 0
+	for _, b := range data {
+		buffer |= uint32(b) << bits
+		bits += 8
+		if bits >= 15 {
+			chars = append(chars, uint16(buffer&0x7FFF))
+			buffer >>= 15
+			bits -= 15
+		}
+	}
+	if bits > 0 {
+		chars = append(chars, uint16(buffer&0x7FFF))
+	}
+	return string(utf16.Decode(chars))
+}
+
+func TestForgeInfoFml3(t *testing.T) {
+	payload := new(bytes.Buffer)
+	payload.WriteByte(1) // truncated
+	encodeUnsignedShort(payload, 2)
+	// a mod with one channel
+	_ = writeVarInt(payload, 1<<1)
+	writeVarString(payload, "examplemod")
+	writeVarString(payload, "1.2.3")
+	writeVarString(payload, "examplemod:main")
+	writeVarString(payload, "1")
+	payload.WriteByte(1)
+	// a server-only mod without a version or channels
+	_ = writeVarInt(payload, 1)
+	writeVarString(payload, "serveronly")
+	// non-mod channels
+	_ = writeVarInt(payload, 0)
+
+	forgeData, err := json.Marshal(map[string]any{
+		"channels":          []any{},
+		"mods":              []any{},
+		"truncated":         false,
+		"fmlNetworkVersion": 3,
+		"d":                 encodeForgeOptimized(payload.Bytes()),
+	})
+	require.NoError(t, err)
+	response := &StatusResponse{Raw: json.RawMessage(`{"forgeData":` + string(forgeData) + `}`)}
+
+	info, err := response.ForgeInfo()
+	require.NoError(t, err)
+	require.NotNil(t, info)
+
+	assert.Equal(t, 3, info.FmlNetworkVersion)
+	assert.True(t, info.Truncated)
+	assert.Equal(t, []Mod{
+		{Id: "examplemod", Version: "1.2.3"},
+		{Id: "serveronly"},
+	}, info.Mods)
+}
+
+func TestForgeInfoFml2(t *testing.T) {
+	response := &StatusResponse{Raw: json.RawMessage(`{
+		"forgeData": {
+			"channels": [{"res": "forge:tier_sorting", "version": "1.0", "required": false}],
+			"mods": [
+				{"modId": "forge", "modmarker": "36.2.39"},
+				{"modId": "serveronly", "modmarker": "` + forgeIgnoreServerOnly + `"}
+			],
+			"fmlNetworkVersion": 2
+		}
+	}`)}
+
+	info, err := response.ForgeInfo()
+	require.NoError(t, err)
+	require.NotNil(t, info)
+
+	assert.Equal(t, 2, info.FmlNetworkVersion)
+	assert.False(t, info.Truncated)
+	assert.Equal(t, []Mod{
+		{Id: "forge", Version: "36.2.39"},
+		{Id: "serveronly"},
+	}, info.Mods)
+}
+
+func TestForgeInfoModInfo(t *testing.T) {
+	response := &StatusResponse{Raw: json.RawMessage(`{
+		"modinfo": {
+			"type": "FML",
+			"modList": [
+				{"modid": "mcp", "version": "9.19"},
+				{"modid": "FML", "version": "8.0.99.99"}
+			]
+		}
+	}`)}
+
+	info, err := response.ForgeInfo()
+	require.NoError(t, err)
+	require.NotNil(t, info)
+
+	assert.Equal(t, 0, info.FmlNetworkVersion)
+	assert.Equal(t, "FML", info.Type)
+	assert.Equal(t, []Mod{
+		{Id: "mcp", Version: "9.19"},
+		{Id: "FML", Version: "8.0.99.99"},
+	}, info.Mods)
+}
+
+func TestForgeInfoVanilla(t *testing.T) {
+	response := &StatusResponse{Raw: json.RawMessage(`{"version":{"name":"1.20.4","protocol":765},"players":{"max":20,"online":0},"description":"A Minecraft Server"}`)}
+
+	info, err := response.ForgeInfo()
+	require.NoError(t, err)
+	assert.Nil(t, info)
+}
+
+func TestForgeInfoTruncatedPayload(t *testing.T) {
+	payload := new(bytes.Buffer)
+	payload.WriteByte(0)
+	encodeUnsignedShort(payload, 5)
+
+	forgeData, err := json.Marshal(map[string]any{
+		"fmlNetworkVersion": 3,
+		"d":                 encodeForgeOptimized(payload.Bytes()),
+	})
+	require.NoError(t, err)
+	response := &StatusResponse{Raw: json.RawMessage(`{"forgeData":` + string(forgeData) + `}`)}
+
+	_, err = response.ForgeInfo()
+	assert.Error(t, err)
+}
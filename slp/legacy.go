@@ -0,0 +1,73 @@
+package slp
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Variants of the legacy server list ping accepted by LegacyPing
+const (
+	LegacyVariant16   = "1.6"
+	LegacyVariant14   = "1.4"
+	LegacyVariantBeta = "beta"
+	// LegacyVariantAuto tries each legacy variant from newest to oldest until one succeeds
+	LegacyVariantAuto = "auto"
+)
+
+// LegacyPing pings with the given legacy variant and returns the response along with the variant that
+// succeeded, which is only different when auto tries each variant in turn. Any other variant is treated as auto.
+// The beta variant does not report the protocol or server version.
+func LegacyPing(host string, port int, timeout time.Duration, variant string, options *LegacyPingOptions) (*ServerListResponse, string, error) {
+	switch variant {
+	case LegacyVariant16:
+		response, err := ServerListPing(host, port, timeout, options)
+		return response, variant, err
+
+	case LegacyVariant14:
+		response, err := ServerListPing14(host, port, timeout, options)
+		return response, variant, err
+
+	case LegacyVariantBeta:
+		response, err := OldServerListPing(host, port, timeout, options)
+		if err != nil {
+			return nil, variant, err
+		}
+		return &ServerListResponse{
+			MessageOfTheDay:    response.MessageOfTheDay,
+			CurrentPlayerCount: response.CurrentPlayerCount,
+			MaxPlayers:         response.MaxPlayers,
+		}, variant, nil
+
+	default:
+		var errs []error
+		for _, legacyVariant := range []string{LegacyVariant16, LegacyVariant14, LegacyVariantBeta} {
+			response, _, err := LegacyPing(host, port, timeout, legacyVariant, options)
+			if err == nil {
+				return response, legacyVariant, nil
+			}
+			errs = append(errs, fmt.Errorf("%s: %w", legacyVariant, err))
+		}
+		return nil, variant, errors.Join(errs...)
+	}
+}
+
+// StatusResponse converts the legacy response into the equivalent of a modern status response, where
+// counts and the protocol version that could not be parsed are zero
+func (r *ServerListResponse) StatusResponse() *StatusResponse {
+	protocol, _ := strconv.Atoi(r.ProtocolVersion)
+	online, _ := strconv.Atoi(r.CurrentPlayerCount)
+	maxPlayers, _ := strconv.Atoi(r.MaxPlayers)
+	return &StatusResponse{
+		Version: StatusVersion{
+			Name:     r.ServerVersion,
+			Protocol: protocol,
+		},
+		Players: StatusPlayers{
+			Max:    maxPlayers,
+			Online: online,
+		},
+		Description: Description{Text: r.MessageOfTheDay},
+	}
+}
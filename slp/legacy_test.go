@@ -0,0 +1,48 @@
+package slp
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLegacyPing(t *testing.T) {
+	port, _ := startFakeLegacyServer(t)
+
+	response, variant, err := LegacyPing("127.0.0.1", port, 5*time.Second, LegacyVariant14, nil)
+	require.NoError(t, err)
+	assert.Equal(t, LegacyVariant14, variant)
+	assert.Equal(t, "1.5.2", response.ServerVersion)
+}
+
+func TestLegacyPingAutoReportsEachVariant(t *testing.T) {
+	// grab a free port and then release it so that each connection is refused
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	port := listener.Addr().(*net.TCPAddr).Port
+	_ = listener.Close()
+
+	_, _, err = LegacyPing("127.0.0.1", port, time.Second, LegacyVariantAuto, nil)
+	require.Error(t, err)
+	for _, variant := range []string{LegacyVariant16, LegacyVariant14, LegacyVariantBeta} {
+		assert.ErrorContains(t, err, variant+": ")
+	}
+}
+
+func TestServerListResponseStatusResponse(t *testing.T) {
+	status := (&ServerListResponse{
+		ProtocolVersion:    "61",
+		ServerVersion:      "1.5.2",
+		MessageOfTheDay:    "An archive server",
+		CurrentPlayerCount: "3",
+		MaxPlayers:         "20",
+	}).StatusResponse()
+
+	assert.Equal(t, StatusVersion{Name: "1.5.2", Protocol: 61}, status.Version)
+	assert.Equal(t, 3, status.Players.Online)
+	assert.Equal(t, 20, status.Players.Max)
+	assert.Equal(t, "An archive server", status.Description.Text)
+}
@@ -0,0 +1,201 @@
+package slp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// LoginResult classifies how the server replied to a Login Start
+type LoginResult string
+
+const (
+	// LoginOnlineMode indicates the server sent an Encryption Request, so players are authenticated with Mojang
+	LoginOnlineMode LoginResult = "online_mode"
+	// LoginDisconnected indicates the server rejected the login, such as due to a whitelist or version mismatch
+	LoginDisconnected LoginResult = "disconnected"
+	// LoginAccepted indicates the server sent Set Compression or Login Success
+	LoginAccepted LoginResult = "accepted"
+	// LoginPluginRequest indicates a proxy or mod loader sent a Login Plugin Request before deciding
+	LoginPluginRequest LoginResult = "plugin_request"
+)
+
+// LoginResults are all the results that ProbeLogin may classify
+var LoginResults = []LoginResult{LoginOnlineMode, LoginDisconnected, LoginAccepted, LoginPluginRequest}
+
+// DefaultLoginUsername is the offline username sent by ProbeLogin when none is given
+const DefaultLoginUsername = "mcmonitor"
+
+const (
+	nextStateLogin int32 = 2
+
+	packetIdLoginStart             int32 = 0x00
+	packetIdLoginDisconnect        int32 = 0x00
+	packetIdLoginEncryptionRequest int32 = 0x01
+	packetIdLoginSuccess           int32 = 0x02
+	packetIdLoginSetCompression    int32 = 0x03
+	packetIdLoginPluginRequest     int32 = 0x04
+
+	// maxLoginReplySize bounds the reply, which is at most a disconnect reason or an encryption request
+	maxLoginReplySize = 1024 * 1024
+)
+
+// Protocol versions where the content of Login Start changed
+const (
+	protocolVersion1_19   int32 = 759
+	protocolVersion1_19_1 int32 = 760
+	protocolVersion1_19_3 int32 = 761
+	protocolVersion1_20_2 int32 = 764
+)
+
+var usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_]{3,16}$`)
+
+// LoginOptions configures ProbeLogin
+type LoginOptions struct {
+	// ProtocolVersion is required since servers reject logins from other versions, and is typically
+	// the protocol version from the status response
+	ProtocolVersion int32
+	// Username is the offline username to send and defaults to DefaultLoginUsername when empty
+	Username string
+	// ProxyVersion enables sending a PROXY protocol header of the given version, 1 or 2, when non-zero
+	ProxyVersion byte
+	// ProxySource is reported as the address of the client in the PROXY header instead of the local address, when valid
+	ProxySource netip.AddrPort
+}
+
+// LoginResponse is the classified reply to the Login Start
+type LoginResponse struct {
+	Result LoginResult `json:"result"`
+	// Reason is the text component given by the server when the result is LoginDisconnected
+	Reason json.RawMessage `json:"reason,omitempty"`
+}
+
+// ProbeLogin sends a Login Start with an offline username and classifies the first reply from the server.
+// The connection is closed as soon as the reply is classified, so no player actually joins.
+// The deadline of the context bounds the entire exchange.
+func ProbeLogin(ctx context.Context, host string, port int, options *LoginOptions) (*LoginResponse, error) {
+	if options == nil || options.ProtocolVersion <= 0 {
+		return nil, errors.New("login probe requires the protocol version of the server")
+	}
+	username := options.Username
+	if username == "" {
+		username = DefaultLoginUsername
+	}
+	if !usernamePattern.MatchString(username) {
+		return nil, fmt.Errorf("invalid username '%s', must be 3 to 16 letters, digits, or underscores", username)
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect: %w", err)
+	}
+	//goland:noinspection GoUnhandledErrorResult
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	// unblock any reads or writes when the context is cancelled
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	response, err := probeLoginConn(conn, host, port, username, options)
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+	return response, nil
+}
+
+func probeLoginConn(conn net.Conn, host string, port int, username string, options *LoginOptions) (*LoginResponse, error) {
+	if options.ProxyVersion != 0 {
+		err := writeProxyHeader(conn, options.ProxyVersion, options.ProxySource)
+		if err != nil {
+			return nil, fmt.Errorf("failed to write PROXY header: %w", err)
+		}
+	}
+
+	err := writeHandshake(conn, host, port, options.ProtocolVersion, nextStateLogin)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send handshake: %w", err)
+	}
+	err = writeLoginStart(conn, username, options.ProtocolVersion)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send login start: %w", err)
+	}
+
+	reader := bufio.NewReader(conn)
+	packetId, remaining, err := readPacketHeader(reader, maxLoginReplySize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read login reply: %w", err)
+	}
+
+	switch packetId {
+	case packetIdLoginDisconnect:
+		reason, err := readVarString(reader, remaining)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read disconnect reason: %w", err)
+		}
+		return &LoginResponse{Result: LoginDisconnected, Reason: textComponentJson(reason)}, nil
+	case packetIdLoginEncryptionRequest:
+		return &LoginResponse{Result: LoginOnlineMode}, nil
+	case packetIdLoginSuccess, packetIdLoginSetCompression:
+		return &LoginResponse{Result: LoginAccepted}, nil
+	case packetIdLoginPluginRequest:
+		return &LoginResponse{Result: LoginPluginRequest}, nil
+	}
+	return nil, fmt.Errorf("unexpected login packet ID received from server: %x", packetId)
+}
+
+// writeLoginStart sends the username along with the player UUID and signature fields expected by the
+// given protocol version
+func writeLoginStart(w io.Writer, username string, protocolVersion int32) error {
+	payload := new(bytes.Buffer)
+	writeVarString(payload, username)
+
+	uuid := offlinePlayerUUID(username)
+	switch {
+	case protocolVersion >= protocolVersion1_20_2:
+		payload.Write(uuid[:])
+	case protocolVersion >= protocolVersion1_19_3:
+		payload.WriteByte(1) // has UUID
+		payload.Write(uuid[:])
+	case protocolVersion >= protocolVersion1_19_1:
+		payload.WriteByte(0) // no signature data
+		payload.WriteByte(1) // has UUID
+		payload.Write(uuid[:])
+	case protocolVersion >= protocolVersion1_19:
+		payload.WriteByte(0) // no signature data
+	}
+
+	return writePacket(w, packetIdLoginStart, payload.Bytes())
+}
+
+// offlinePlayerUUID is the version 3 UUID that offline-mode servers assign to the given username
+func offlinePlayerUUID(username string) [16]byte {
+	uuid := md5.Sum([]byte("OfflinePlayer:" + username))
+	uuid[6] = uuid[6]&0x0F | 0x30
+	uuid[8] = uuid[8]&0x3F | 0x80
+	return uuid
+}
+
+// textComponentJson retains the reason as-is when it is JSON or otherwise encodes it as a JSON string
+func textComponentJson(reason string) json.RawMessage {
+	if json.Valid([]byte(reason)) {
+		return json.RawMessage(reason)
+	}
+	encoded, _ := json.Marshal(reason)
+	return encoded
+}
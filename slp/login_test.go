@@ -0,0 +1,163 @@
+package slp
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProbeLogin(t *testing.T) {
+	tests := []struct {
+		name           string
+		replyId        int32
+		reply          []byte
+		expectedResult LoginResult
+		expectedReason string
+	}{
+		{
+			name:           "encryption request",
+			replyId:        packetIdLoginEncryptionRequest,
+			reply:          []byte{0x00, 0x00, 0x00},
+			expectedResult: LoginOnlineMode,
+		},
+		{
+			name:           "disconnect",
+			replyId:        packetIdLoginDisconnect,
+			reply:          encodeTestString(`{"text":"You are not whitelisted on this server!"}`),
+			expectedResult: LoginDisconnected,
+			expectedReason: `{"text":"You are not whitelisted on this server!"}`,
+		},
+		{
+			name:           "disconnect with plain reason",
+			replyId:        packetIdLoginDisconnect,
+			reply:          encodeTestString(`Outdated client!`),
+			expectedResult: LoginDisconnected,
+			expectedReason: `"Outdated client!"`,
+		},
+		{
+			name:           "set compression",
+			replyId:        packetIdLoginSetCompression,
+			reply:          []byte{0x80, 0x02},
+			expectedResult: LoginAccepted,
+		},
+		{
+			name:           "login success",
+			replyId:        packetIdLoginSuccess,
+			reply:          make([]byte, 20),
+			expectedResult: LoginAccepted,
+		},
+		{
+			name:           "plugin request",
+			replyId:        packetIdLoginPluginRequest,
+			reply:          []byte{0x01},
+			expectedResult: LoginPluginRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := startFakeStatusServer(t, testStatus, func(s *fakeStatusServer) {
+				s.loginReplyId = tt.replyId
+				s.loginReply = tt.reply
+			})
+
+			response, err := ProbeLogin(context.Background(), "127.0.0.1", server.port(), &LoginOptions{ProtocolVersion: 765})
+			require.NoError(t, err)
+
+			handshake := <-server.handshakes
+			assert.Equal(t, nextStateLogin, handshake.nextState)
+			assert.Equal(t, int32(765), handshake.protocolVersion)
+			loginStart := <-server.loginStarts
+			assert.True(t, bytes.HasPrefix(loginStart, encodeTestString(DefaultLoginUsername)))
+
+			assert.Equal(t, tt.expectedResult, response.Result)
+			if tt.expectedReason != "" {
+				assert.JSONEq(t, tt.expectedReason, string(response.Reason))
+			} else {
+				assert.Empty(t, response.Reason)
+			}
+		})
+	}
+}
+
+func TestProbeLoginUnexpectedPacket(t *testing.T) {
+	server := startFakeStatusServer(t, testStatus, func(s *fakeStatusServer) {
+		s.loginReplyId = 0x05
+	})
+
+	_, err := ProbeLogin(context.Background(), "127.0.0.1", server.port(), &LoginOptions{ProtocolVersion: 765})
+	assert.ErrorContains(t, err, "unexpected login packet")
+}
+
+func TestProbeLoginRequiresProtocolVersion(t *testing.T) {
+	_, err := ProbeLogin(context.Background(), "127.0.0.1", 25565, &LoginOptions{})
+	assert.Error(t, err)
+}
+
+func TestProbeLoginInvalidUsername(t *testing.T) {
+	_, err := ProbeLogin(context.Background(), "127.0.0.1", 25565, &LoginOptions{ProtocolVersion: 765, Username: "not-valid"})
+	assert.ErrorContains(t, err, "invalid username")
+}
+
+func TestProbeLoginContextDeadline(t *testing.T) {
+	server := startFakeStatusServer(t, testStatus, func(s *fakeStatusServer) {
+		s.stall = true
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err := ProbeLogin(ctx, "127.0.0.1", server.port(), &LoginOptions{ProtocolVersion: 765})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestWriteLoginStart(t *testing.T) {
+	// the offline UUID of Notch
+	uuid := "b50ad385829d3141a2167e7d7539ba7f"
+
+	tests := []struct {
+		name            string
+		protocolVersion int32
+		expectedFields  string
+	}{
+		{name: "1.18.2", protocolVersion: 758, expectedFields: ""},
+		{name: "1.19", protocolVersion: 759, expectedFields: "00"},
+		{name: "1.19.2", protocolVersion: 760, expectedFields: "0001" + uuid},
+		{name: "1.20.1", protocolVersion: 763, expectedFields: "01" + uuid},
+		{name: "1.20.4", protocolVersion: 765, expectedFields: uuid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := new(bytes.Buffer)
+			err := writeLoginStart(buf, "Notch", tt.protocolVersion)
+			require.NoError(t, err)
+
+			expected := new(bytes.Buffer)
+			writeVarString(expected, "Notch")
+			fields, _ := hex.DecodeString(tt.expectedFields)
+			expected.Write(fields)
+			framed := new(bytes.Buffer)
+			_ = writePacket(framed, packetIdLoginStart, expected.Bytes())
+
+			assert.Equal(t, framed.Bytes(), buf.Bytes())
+		})
+	}
+}
+
+func encodeTestString(s string) []byte {
+	buf := new(bytes.Buffer)
+	writeVarString(buf, s)
+	return buf.Bytes()
+}
+
+func TestLoginResponseJson(t *testing.T) {
+	encoded, err := json.Marshal(&LoginResponse{Result: LoginOnlineMode})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"result":"online_mode"}`, string(encoded))
+}
@@ -7,8 +7,6 @@ import (
 	"fmt"
 	"strings"
 	"io"
-	"net"
-	"strconv"
 	"time"
 )
 
@@ -18,10 +16,10 @@ type OldServerListResponse struct {
 	MaxPlayers         string
 }
 
-func OldServerListPing(host string, port int, timeout time.Duration) (*OldServerListResponse, error) {
-	conn, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+func OldServerListPing(host string, port int, timeout time.Duration, options *LegacyPingOptions) (*OldServerListResponse, error) {
+	conn, err := dialLegacy(host, port, timeout, options)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect: %w", err)
+		return nil, err
 	}
 	//goland:noinspection GoUnhandledErrorResult
 	defer conn.Close()
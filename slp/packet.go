@@ -0,0 +1,126 @@
+package slp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// maxVarIntBytes is the most bytes a 32-bit VarInt can occupy
+const maxVarIntBytes = 5
+
+var errVarIntTooBig = errors.New("VarInt is too big")
+
+// writeVarInt writes the protocol's variable length encoding of a 32-bit integer
+func writeVarInt(w io.ByteWriter, value int32) error {
+	v := uint32(value)
+	for {
+		if v&^0x7F == 0 {
+			return w.WriteByte(byte(v))
+		}
+		err := w.WriteByte(byte(v&0x7F | 0x80))
+		if err != nil {
+			return err
+		}
+		v >>= 7
+	}
+}
+
+func readVarInt(r io.ByteReader) (int32, error) {
+	var result uint32
+	for i := 0; i < maxVarIntBytes; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		result |= uint32(b&0x7F) << (7 * i)
+		if b&0x80 == 0 {
+			return int32(result), nil
+		}
+	}
+	return 0, errVarIntTooBig
+}
+
+// writeVarString writes a VarInt length prefixed UTF-8 string
+func writeVarString(w *bytes.Buffer, s string) {
+	_ = writeVarInt(w, int32(len(s)))
+	w.WriteString(s)
+}
+
+// readVarString reads a VarInt length prefixed UTF-8 string that is no longer than maxLen bytes
+func readVarString(r *bufio.Reader, maxLen int) (string, error) {
+	length, err := readVarInt(r)
+	if err != nil {
+		return "", err
+	}
+	if length < 0 {
+		return "", fmt.Errorf("invalid string length %d", length)
+	}
+	if maxLen > 0 && int(length) > maxLen {
+		return "", fmt.Errorf("string length %d exceeds maximum of %d", length, maxLen)
+	}
+
+	buf := make([]byte, length)
+	_, err = io.ReadFull(r, buf)
+	if err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+// writePacket frames the given packet ID and payload with the VarInt length prefix
+func writePacket(w io.Writer, packetId int32, payload []byte) error {
+	body := new(bytes.Buffer)
+	_ = writeVarInt(body, packetId)
+	body.Write(payload)
+
+	framed := new(bytes.Buffer)
+	_ = writeVarInt(framed, int32(body.Len()))
+	framed.Write(body.Bytes())
+
+	_, err := w.Write(framed.Bytes())
+	return err
+}
+
+// readPacketHeader reads the length and ID of the next packet, returning the length of the
+// remaining payload. Packets longer than maxLen are rejected.
+func readPacketHeader(r *bufio.Reader, maxLen int) (int32, int, error) {
+	length, err := readVarInt(r)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read packet length: %w", err)
+	}
+	if length <= 0 {
+		return 0, 0, fmt.Errorf("invalid packet length %d", length)
+	}
+	if maxLen > 0 && int(length) > maxLen {
+		return 0, 0, fmt.Errorf("packet length %d exceeds maximum of %d", length, maxLen)
+	}
+
+	counter := &countingByteReader{r: r}
+	packetId, err := readVarInt(counter)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read packet ID: %w", err)
+	}
+
+	return packetId, int(length) - counter.count, nil
+}
+
+type countingByteReader struct {
+	r     io.ByteReader
+	count int
+}
+
+func (c *countingByteReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.count++
+	}
+	return b, err
+}
+
+func encodeUnsignedShort(w *bytes.Buffer, v uint16) {
+	_ = binary.Write(w, binary.BigEndian, v)
+}
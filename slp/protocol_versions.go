@@ -0,0 +1,95 @@
+package slp
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"sync"
+)
+
+// protocolVersionsCsv maps each Java Edition release since 1.7.2, which introduced the current
+// handshake, to its protocol version
+//
+//go:embed protocol_versions.csv
+var protocolVersionsCsv []byte
+
+type protocolRelease struct {
+	release  string
+	protocol int32
+}
+
+var loadProtocolReleases = sync.OnceValue(func() []protocolRelease {
+	records, err := csv.NewReader(bytes.NewReader(protocolVersionsCsv)).ReadAll()
+	if err != nil {
+		panic(fmt.Sprintf("invalid embedded protocol versions: %v", err))
+	}
+
+	releases := make([]protocolRelease, 0, len(records))
+	// skip the header
+	for _, record := range records[1:] {
+		protocol, err := strconv.ParseInt(record[1], 10, 32)
+		if err != nil {
+			panic(fmt.Sprintf("invalid embedded protocol version of %s: %v", record[0], err))
+		}
+		releases = append(releases, protocolRelease{release: record[0], protocol: int32(protocol)})
+	}
+	return releases
+})
+
+// ProtocolVersionOf returns the protocol version of the given Java Edition release, such as "1.20.4"
+func ProtocolVersionOf(release string) (int32, bool) {
+	for _, entry := range loadProtocolReleases() {
+		if entry.release == release {
+			return entry.protocol, true
+		}
+	}
+	return 0, false
+}
+
+// ReleasesOf returns the Java Edition releases, oldest first, that use the given protocol version
+func ReleasesOf(protocol int32) []string {
+	var releases []string
+	for _, entry := range loadProtocolReleases() {
+		if entry.protocol == protocol {
+			releases = append(releases, entry.release)
+		}
+	}
+	return releases
+}
+
+// DescribeProtocolVersion formats the protocol version along with its releases, such as "765 (1.20.3-1.20.4)",
+// or just the number when the releases are not known
+func DescribeProtocolVersion(protocol int32) string {
+	releases := ReleasesOf(protocol)
+	switch len(releases) {
+	case 0:
+		return strconv.Itoa(int(protocol))
+	case 1:
+		return fmt.Sprintf("%d (%s)", protocol, releases[0])
+	default:
+		return fmt.Sprintf("%d (%s-%s)", protocol, releases[0], releases[len(releases)-1])
+	}
+}
+
+// ResolveProtocolVersion returns the protocol version given either as a number or as a client release,
+// such as "1.20.4". Zero is returned when neither is given, and an error when the two disagree.
+func ResolveProtocolVersion(protocolVersion int, clientVersion string) (int32, error) {
+	if clientVersion == "" {
+		if protocolVersion < 0 {
+			return 0, fmt.Errorf("invalid protocol version %d", protocolVersion)
+		}
+		return int32(protocolVersion), nil
+	}
+
+	resolved, found := ProtocolVersionOf(clientVersion)
+	if !found {
+		return 0, fmt.Errorf("unknown client version '%s', use the protocol version instead", clientVersion)
+	}
+	if protocolVersion != 0 && int32(protocolVersion) != resolved {
+		return 0, fmt.Errorf("client version %s uses protocol version %d rather than %d",
+			clientVersion, resolved, protocolVersion)
+	}
+	return resolved, nil
+}
@@ -0,0 +1,69 @@
+package slp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProtocolVersionOf(t *testing.T) {
+	protocol, found := ProtocolVersionOf("1.20.4")
+	assert.True(t, found)
+	assert.Equal(t, int32(765), protocol)
+
+	protocol, found = ProtocolVersionOf("1.8")
+	assert.True(t, found)
+	assert.Equal(t, int32(47), protocol)
+
+	_, found = ProtocolVersionOf("1.6.4")
+	assert.False(t, found)
+}
+
+func TestReleasesOf(t *testing.T) {
+	assert.Equal(t, []string{"1.20.3", "1.20.4"}, ReleasesOf(765))
+	assert.Equal(t, []string{"1.12.2"}, ReleasesOf(340))
+	assert.Empty(t, ReleasesOf(-1))
+}
+
+func TestDescribeProtocolVersion(t *testing.T) {
+	assert.Equal(t, "765 (1.20.3-1.20.4)", DescribeProtocolVersion(765))
+	assert.Equal(t, "340 (1.12.2)", DescribeProtocolVersion(340))
+	assert.Equal(t, "9999", DescribeProtocolVersion(9999))
+}
+
+func TestProtocolVersionsAscend(t *testing.T) {
+	releases := loadProtocolReleases()
+	for i := 1; i < len(releases); i++ {
+		assert.GreaterOrEqual(t, releases[i].protocol, releases[i-1].protocol, releases[i].release)
+	}
+}
+
+func TestResolveProtocolVersion(t *testing.T) {
+	tests := []struct {
+		name            string
+		protocolVersion int
+		clientVersion   string
+		expected        int32
+		expectError     bool
+	}{
+		{name: "neither"},
+		{name: "protocol version", protocolVersion: 340, expected: 340},
+		{name: "client version", clientVersion: "1.12.2", expected: 340},
+		{name: "both agree", protocolVersion: 340, clientVersion: "1.12.2", expected: 340},
+		{name: "both disagree", protocolVersion: 765, clientVersion: "1.12.2", expectError: true},
+		{name: "unknown client version", clientVersion: "1.99", expectError: true},
+		{name: "negative protocol version", protocolVersion: -1, expectError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			protocol, err := ResolveProtocolVersion(tt.protocolVersion, tt.clientVersion)
+			if tt.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expected, protocol)
+			}
+		})
+	}
+}
@@ -1,5 +1,6 @@
-// Package slp implements the Server List Ping and Old Server List Ping protocol originally accepted by servers
-// before 1.6; however, modern servers also respond to it.
+// Package slp implements the Server List Ping of 1.7 and newer servers along with the legacy Server List Ping
+// and Old Server List Ping protocols originally accepted by servers before 1.6; however, modern servers also
+// respond to those.
 // Old Server List Ping is used for pre-1.3 versions
 package slp
 
@@ -9,6 +10,7 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"net/netip"
 	"strconv"
 	"time"
 	"unicode/utf16"
@@ -22,10 +24,18 @@ type ServerListResponse struct {
 	MaxPlayers         string
 }
 
-func ServerListPing(host string, port int, timeout time.Duration) (*ServerListResponse, error) {
-	conn, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+// LegacyPingOptions configures ServerListPing, ServerListPing14, and OldServerListPing. The zero value is usable.
+type LegacyPingOptions struct {
+	// ProxyVersion enables sending a PROXY protocol header of the given version, 1 or 2, when non-zero
+	ProxyVersion byte
+	// ProxySource is reported as the address of the client in the PROXY header instead of the local address, when valid
+	ProxySource netip.AddrPort
+}
+
+func ServerListPing(host string, port int, timeout time.Duration, options *LegacyPingOptions) (*ServerListResponse, error) {
+	conn, err := dialLegacy(host, port, timeout, options)
 	if err != nil {
-		return nil, fmt.Errorf("failed to connect: %w", err)
+		return nil, err
 	}
 	//goland:noinspection GoUnhandledErrorResult
 	defer conn.Close()
@@ -35,9 +45,31 @@ func ServerListPing(host string, port int, timeout time.Duration) (*ServerListRe
 		return nil, fmt.Errorf("failed to send ping: %w", err)
 	}
 
+	return readServerListResponse(conn, timeout)
+}
+
+// dialLegacy connects to the server and sends the PROXY header, if enabled
+func dialLegacy(host string, port int, timeout time.Duration, options *LegacyPingOptions) (net.Conn, error) {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(host, strconv.Itoa(port)), timeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect: %w", err)
+	}
+
+	if options != nil && options.ProxyVersion != 0 {
+		err := writeProxyHeader(conn, options.ProxyVersion, options.ProxySource)
+		if err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("failed to write PROXY header: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+// readServerListResponse reads the kick packet that 1.4 and newer servers send in response to a legacy ping
+func readServerListResponse(conn net.Conn, timeout time.Duration) (*ServerListResponse, error) {
 	var packetId = make([]byte, 1)
 	_ = conn.SetReadDeadline(time.Now().Add(timeout))
-	_, err = conn.Read(packetId)
+	_, err := conn.Read(packetId)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read response packet ID: %w", err)
 	}
@@ -0,0 +1,37 @@
+package slp
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// ServerListPing14 implements the legacy Server List Ping of 1.4 and 1.5 servers, which is the same
+// as ServerListPing without the MC|PingHost plugin message that was added in 1.6
+func ServerListPing14(host string, port int, timeout time.Duration, options *LegacyPingOptions) (*ServerListResponse, error) {
+	conn, err := dialLegacy(host, port, timeout, options)
+	if err != nil {
+		return nil, err
+	}
+	//goland:noinspection GoUnhandledErrorResult
+	defer conn.Close()
+
+	err = encodePing14(conn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send ping: %w", err)
+	}
+
+	return readServerListResponse(conn, timeout)
+}
+
+func encodePing14(conn io.Writer) error {
+	// see https://wiki.vg/Server_List_Ping#1.4_to_1.5
+	err := writeBinarySlice(conn, []interface{}{
+		uint8(0xFE),
+		uint8(1),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode server list ping: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package slp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf16"
+
+	"github.com/pires/go-proxyproto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_encodePing14(t *testing.T) {
+	buf := new(bytes.Buffer)
+	err := encodePing14(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "fe01", fmt.Sprintf("%x", buf.Bytes()))
+}
+
+// startFakeLegacyServer responds to the 1.4 ping, which is exactly FE 01, with the kick packet of a 1.5 server.
+// A PROXY protocol header ahead of the ping is accepted and sent to the returned channel.
+func startFakeLegacyServer(t *testing.T) (int, <-chan *proxyproto.Header) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = listener.Close()
+	})
+
+	headers := make(chan *proxyproto.Header, 1)
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		//goland:noinspection GoUnhandledErrorResult
+		defer conn.Close()
+
+		reader := bufio.NewReader(conn)
+		header, err := proxyproto.Read(reader)
+		if err == nil {
+			headers <- header
+		} else if !errors.Is(err, proxyproto.ErrNoProxyProtocol) {
+			return
+		}
+
+		request := make([]byte, 2)
+		_, err = io.ReadFull(reader, request)
+		if err != nil || !bytes.Equal(request, []byte{0xFE, 0x01}) {
+			return
+		}
+
+		content := utf16.Encode([]rune(strings.Join([]string{"§1", "61", "1.5.2", "An archive server", "3", "20"}, "\x00")))
+		response := new(bytes.Buffer)
+		response.WriteByte(0xFF)
+		_ = binary.Write(response, binary.BigEndian, uint16(len(content)))
+		_ = writeBinaryUtf16(response, content)
+		_, _ = conn.Write(response.Bytes())
+	}()
+
+	return listener.Addr().(*net.TCPAddr).Port, headers
+}
+
+func TestServerListPing14(t *testing.T) {
+	port, _ := startFakeLegacyServer(t)
+
+	response, err := ServerListPing14("127.0.0.1", port, 5*time.Second, nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, &ServerListResponse{
+		ProtocolVersion:    "61",
+		ServerVersion:      "1.5.2",
+		MessageOfTheDay:    "An archive server",
+		CurrentPlayerCount: "3",
+		MaxPlayers:         "20",
+	}, response)
+}
+
+func TestServerListPing14ProxyHeader(t *testing.T) {
+	port, headers := startFakeLegacyServer(t)
+
+	response, err := ServerListPing14("127.0.0.1", port, 5*time.Second, &LegacyPingOptions{
+		ProxyVersion: 2,
+		ProxySource:  netip.MustParseAddrPort("203.0.113.7:40000"),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "1.5.2", response.ServerVersion)
+
+	header := <-headers
+	assert.Equal(t, byte(2), header.Version)
+	assert.Equal(t, proxyproto.TCPv4, header.TransportProtocol)
+	assert.Equal(t, "203.0.113.7:40000", header.SourceAddr.String())
+	assert.Equal(t, "127.0.0.1:"+strconv.Itoa(port), header.DestinationAddr.String())
+}
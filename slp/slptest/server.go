@@ -0,0 +1,244 @@
+// Package slptest provides an in-process Java Edition server for use in tests, similar to httptest.
+// It responds to the Server List Ping and to the Login Start of a login probe.
+package slptest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	nextStateStatus = 1
+	nextStateLogin  = 2
+
+	// PacketIdLoginDisconnect and the following are the replies to a Login Start
+	PacketIdLoginDisconnect        int32 = 0x00
+	PacketIdLoginEncryptionRequest int32 = 0x01
+	PacketIdLoginSuccess           int32 = 0x02
+	PacketIdLoginSetCompression    int32 = 0x03
+)
+
+// LoginReply is the packet sent in response to a Login Start
+type LoginReply struct {
+	PacketId int32
+	Payload  []byte
+}
+
+// Server is a fake Java Edition server that accepts connections on a loopback port
+type Server struct {
+	listener net.Listener
+	// closed ends the delay of status responses still pending when the server is closed
+	closed    chan struct{}
+	closeOnce sync.Once
+
+	mu          sync.Mutex
+	status      string
+	statusDelay time.Duration
+	ignorePing  bool
+	loginReply  LoginReply
+	pings       int
+	logins      int
+	wg          sync.WaitGroup
+}
+
+// NewServer starts a server that responds to status requests with the given status JSON and
+// to logins with an Encryption Request
+func NewServer(status string) *Server {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic("slptest: failed to listen: " + err.Error())
+	}
+
+	s := &Server{
+		listener:   listener,
+		closed:     make(chan struct{}),
+		status:     status,
+		loginReply: LoginReply{PacketId: PacketIdLoginEncryptionRequest, Payload: []byte{0, 0, 0}},
+	}
+	s.wg.Add(1)
+	go s.serve()
+	return s
+}
+
+// DisconnectReply creates the reply that rejects a login with the given text component JSON
+func DisconnectReply(reason string) LoginReply {
+	payload := new(bytes.Buffer)
+	writeVarString(payload, reason)
+	return LoginReply{PacketId: PacketIdLoginDisconnect, Payload: payload.Bytes()}
+}
+
+// SetStatus replaces the status JSON of subsequent status requests
+func (s *Server) SetStatus(status string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = status
+}
+
+// SetStatusDelay delays subsequent status responses by the given duration, such as to stall pings until they
+// time out
+func (s *Server) SetStatusDelay(delay time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.statusDelay = delay
+}
+
+// SetIgnorePing keeps subsequent connections open after the status response without answering the ping, like
+// servers and proxies that don't implement the ping/pong exchange
+func (s *Server) SetIgnorePing(ignore bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ignorePing = ignore
+}
+
+// SetLoginReply replaces the reply to subsequent Login Start packets
+func (s *Server) SetLoginReply(reply LoginReply) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.loginReply = reply
+}
+
+// Pings returns the number of status requests received so far
+func (s *Server) Pings() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pings
+}
+
+// Logins returns the number of Login Start packets received so far
+func (s *Server) Logins() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.logins
+}
+
+// Addr returns the [host:port] address of the server
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Host returns the host of the server's address
+func (s *Server) Host() string {
+	host, _, _ := net.SplitHostPort(s.Addr())
+	return host
+}
+
+// Port returns the port of the server's address
+func (s *Server) Port() uint16 {
+	_, port, _ := net.SplitHostPort(s.Addr())
+	parsed, _ := strconv.ParseUint(port, 10, 16)
+	return uint16(parsed)
+}
+
+// Close stops accepting connections
+func (s *Server) Close() {
+	s.closeOnce.Do(func() { close(s.closed) })
+	_ = s.listener.Close()
+	s.wg.Wait()
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	//goland:noinspection GoUnhandledErrorResult
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	handshake, err := readPacket(reader)
+	if err != nil {
+		return
+	}
+	// the next state is the last field of the handshake
+	nextState := handshake[len(handshake)-1]
+
+	switch nextState {
+	case nextStateStatus:
+		if _, err := readPacket(reader); err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.pings++
+		status, delay, ignorePing := s.status, s.statusDelay, s.ignorePing
+		s.mu.Unlock()
+
+		if delay > 0 {
+			select {
+			case <-time.After(delay):
+			case <-s.closed:
+				return
+			}
+		}
+
+		payload := new(bytes.Buffer)
+		writeVarString(payload, status)
+		if writePacket(conn, 0x00, payload.Bytes()) != nil {
+			return
+		}
+
+		ping, err := readPacket(reader)
+		if err != nil || len(ping) == 0 {
+			return
+		}
+		if ignorePing {
+			// hold the connection until the client gives up on the pong
+			_, _ = io.Copy(io.Discard, reader)
+			return
+		}
+		// the pong echoes the payload that follows the packet ID
+		_ = writePacket(conn, 0x01, ping[1:])
+
+	case nextStateLogin:
+		if _, err := readPacket(reader); err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.logins++
+		reply := s.loginReply
+		s.mu.Unlock()
+
+		_ = writePacket(conn, reply.PacketId, reply.Payload)
+	}
+}
+
+// readPacket returns the content of the next packet, which starts with the packet ID
+func readPacket(reader *bufio.Reader) ([]byte, error) {
+	length, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return nil, err
+	}
+	if length == 0 || length > 1024*1024 {
+		return nil, errors.New("invalid packet length")
+	}
+	content := make([]byte, length)
+	_, err = io.ReadFull(reader, content)
+	return content, err
+}
+
+func writePacket(w io.Writer, packetId int32, payload []byte) error {
+	body := binary.AppendUvarint(nil, uint64(uint32(packetId)))
+	body = append(body, payload...)
+	framed := binary.AppendUvarint(nil, uint64(len(body)))
+	framed = append(framed, body...)
+	_, err := w.Write(framed)
+	return err
+}
+
+func writeVarString(w *bytes.Buffer, s string) {
+	w.Write(binary.AppendUvarint(nil, uint64(len(s))))
+	w.WriteString(s)
+}
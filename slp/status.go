@@ -0,0 +1,294 @@
+package slp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"time"
+
+	"github.com/itzg/mc-monitor/utils"
+)
+
+const (
+	// UnknownProtocolVersion is sent in the handshake to indicate the client is only interested in the status
+	UnknownProtocolVersion int32 = -1
+
+	// DefaultMaxResponseSize is large enough for the status of heavily modded servers, which include
+	// their mod list
+	DefaultMaxResponseSize = 4 * 1024 * 1024
+
+	// DefaultPingPongTimeout bounds the wait for the pong, since the status is usable without it
+	DefaultPingPongTimeout = 2 * time.Second
+
+	packetIdHandshake      int32 = 0x00
+	packetIdStatusRequest  int32 = 0x00
+	packetIdStatusResponse int32 = 0x00
+	packetIdPing           int32 = 0x01
+	packetIdPong           int32 = 0x01
+
+	nextStateStatus int32 = 1
+)
+
+// PingOptions configures the behavior of Ping. The zero value is usable.
+type PingOptions struct {
+	// ProtocolVersion is sent in the handshake and defaults to UnknownProtocolVersion when zero
+	ProtocolVersion int32
+	// MaxResponseSize limits the length of the status JSON and defaults to DefaultMaxResponseSize when zero
+	MaxResponseSize int
+	// ProxyVersion enables sending a PROXY protocol header of the given version, 1 or 2, when non-zero
+	ProxyVersion byte
+	// ProxySource is reported as the address of the client in the PROXY header instead of the local address, when valid
+	ProxySource netip.AddrPort
+	// SkipPingPong skips the ping/pong exchange that follows the status response
+	SkipPingPong bool
+	// PingPongTimeout limits the wait for the pong within the deadline of the context and defaults to
+	// DefaultPingPongTimeout when zero
+	PingPongTimeout time.Duration
+}
+
+type StatusVersion struct {
+	Name     string `json:"name"`
+	Protocol int    `json:"protocol"`
+}
+
+type StatusPlayer struct {
+	Name string `json:"name"`
+	Id   string `json:"id"`
+}
+
+type StatusPlayers struct {
+	Max    int            `json:"max"`
+	Online int            `json:"online"`
+	Sample []StatusPlayer `json:"sample,omitempty"`
+}
+
+// Description is the message of the day chat component, which is retained as-is since it can either
+// be a plain string or a nested component.
+type Description struct {
+	// Text is the top-level text of the component
+	Text string
+	raw  json.RawMessage
+}
+
+func (d *Description) UnmarshalJSON(data []byte) error {
+	d.raw = append(json.RawMessage(nil), data...)
+	if len(data) > 0 && data[0] == '"' {
+		return json.Unmarshal(data, &d.Text)
+	}
+
+	var component struct {
+		Text string `json:"text"`
+	}
+	// the description may also be an array of components, where the top-level text is empty
+	if err := json.Unmarshal(data, &component); err == nil {
+		d.Text = component.Text
+	}
+	return nil
+}
+
+func (d Description) MarshalJSON() ([]byte, error) {
+	if d.raw == nil {
+		return json.Marshal(d.Text)
+	}
+	return d.raw, nil
+}
+
+// Raw returns the description JSON exactly as returned by the server
+func (d Description) Raw() json.RawMessage {
+	return d.raw
+}
+
+// StatusResponse is the status reported by 1.7 and newer servers.
+// See https://wiki.vg/Server_List_Ping#Status_Response
+type StatusResponse struct {
+	Version            StatusVersion `json:"version"`
+	Players            StatusPlayers `json:"players"`
+	Description        Description   `json:"description"`
+	Favicon            string        `json:"favicon,omitempty"`
+	EnforcesSecureChat bool          `json:"enforcesSecureChat,omitempty"`
+
+	// Raw is the status JSON exactly as returned by the server, which includes any fields not mapped here
+	Raw json.RawMessage `json:"-"`
+	// Latency is the round trip time of the ping/pong exchange or zero if it was skipped or not supported
+	Latency time.Duration `json:"-"`
+	// Timings breaks down the time taken by each phase of the ping
+	Timings Timings `json:"-"`
+}
+
+// ResponseTime returns the time taken until the status response was read, which excludes the ping/pong
+// exchange that follows it. The given elapsed time of the whole ping is returned instead when the phases
+// were not measured, such as for the conversion of a legacy response.
+func (r *StatusResponse) ResponseTime(elapsed time.Duration) time.Duration {
+	if r.Timings.Handshake == 0 {
+		return elapsed
+	}
+	return r.Timings.Status()
+}
+
+// Ping performs the handshake, status request, and ping/pong exchange of the Server List Ping implemented by
+// 1.7 and newer servers. The deadline of the context bounds the entire exchange.
+func Ping(ctx context.Context, host string, port int, options *PingOptions) (*StatusResponse, error) {
+	if options == nil {
+		options = &PingOptions{}
+	}
+
+	var timings Timings
+	conn, err := dialTimed(ctx, host, port, &timings)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect: %w", err)
+	}
+	//goland:noinspection GoUnhandledErrorResult
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	// unblock any reads or writes when the context is cancelled
+	stop := context.AfterFunc(ctx, func() {
+		_ = conn.SetDeadline(time.Now())
+	})
+	defer stop()
+
+	response, err := pingConn(ctx, conn, host, port, options, &timings)
+	if err != nil {
+		return nil, contextError(ctx, err)
+	}
+	return response, nil
+}
+
+// contextError attributes the given error to the context when the context is done or its deadline
+// has passed, since the connection deadline can trip slightly before the context's own timer
+func contextError(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return fmt.Errorf("%w: %w", ctxErr, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok && !time.Now().Before(deadline) {
+		return fmt.Errorf("%w: %w", context.DeadlineExceeded, err)
+	}
+	return err
+}
+
+func pingConn(ctx context.Context, conn net.Conn, host string, port int, options *PingOptions, timings *Timings) (*StatusResponse, error) {
+	if options.ProxyVersion != 0 {
+		err := writeProxyHeader(conn, options.ProxyVersion, options.ProxySource)
+		if err != nil {
+			return nil, fmt.Errorf("failed to write PROXY header: %w", err)
+		}
+	}
+
+	handshakeStart := time.Now()
+	err := writeHandshake(conn, host, port, options.ProtocolVersion, nextStateStatus)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send handshake: %w", err)
+	}
+	err = writePacket(conn, packetIdStatusRequest, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send status request: %w", err)
+	}
+
+	maxResponseSize := options.MaxResponseSize
+	if maxResponseSize <= 0 {
+		maxResponseSize = DefaultMaxResponseSize
+	}
+
+	reader := bufio.NewReader(conn)
+	// allow for the packet ID and string length prefix in addition to the JSON itself
+	packetId, _, err := readPacketHeader(reader, maxResponseSize+2*maxVarIntBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read status response: %w", err)
+	}
+	if packetId != packetIdStatusResponse {
+		return nil, fmt.Errorf("invalid packet ID received from server: %x", packetId)
+	}
+	content, err := readVarString(reader, maxResponseSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read status response: %w", err)
+	}
+
+	var response StatusResponse
+	err = json.Unmarshal([]byte(content), &response)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse status response: %w", err)
+	}
+	response.Raw = json.RawMessage(content)
+	timings.Handshake = time.Since(handshakeStart)
+
+	if !options.SkipPingPong {
+		// not all servers and proxies respond to the ping, so the status is still usable without it
+		response.Latency, _ = pingPong(ctx, conn, reader, options.PingPongTimeout)
+		timings.PingPong = response.Latency
+	}
+	response.Timings = *timings
+
+	return &response, nil
+}
+
+// writeHandshake sends the handshake packet that switches the connection to the given state
+func writeHandshake(w io.Writer, host string, port int, protocolVersion int32, nextState int32) error {
+	if protocolVersion == 0 {
+		protocolVersion = UnknownProtocolVersion
+	}
+
+	payload := new(bytes.Buffer)
+	_ = writeVarInt(payload, protocolVersion)
+	writeVarString(payload, host)
+	encodeUnsignedShort(payload, uint16(port))
+	_ = writeVarInt(payload, nextState)
+
+	return writePacket(w, packetIdHandshake, payload.Bytes())
+}
+
+// pingPong sends a ping with the current time as the payload and waits for the matching pong until the
+// given timeout, which is capped by the deadline of the context
+func pingPong(ctx context.Context, conn net.Conn, reader *bufio.Reader, timeout time.Duration) (time.Duration, error) {
+	if timeout <= 0 {
+		timeout = DefaultPingPongTimeout
+	}
+	start := time.Now()
+	deadline := start.Add(timeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	_ = conn.SetDeadline(deadline)
+	// the context may have been cancelled before the deadline above replaced the one set on cancellation
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	payload := make([]byte, 8)
+	binary.BigEndian.PutUint64(payload, uint64(start.UnixMilli()))
+
+	err := writePacket(conn, packetIdPing, payload)
+	if err != nil {
+		return 0, err
+	}
+
+	packetId, remaining, err := readPacketHeader(reader, 64)
+	if err != nil {
+		return 0, err
+	}
+	if packetId != packetIdPong || remaining != len(payload) {
+		return 0, fmt.Errorf("invalid pong packet %x of length %d", packetId, remaining)
+	}
+	echoed := make([]byte, remaining)
+	_, err = io.ReadFull(reader, echoed)
+	if err != nil {
+		return 0, err
+	}
+	if !bytes.Equal(echoed, payload) {
+		return 0, errors.New("pong payload did not match ping")
+	}
+
+	return time.Since(start), nil
+}
+
+func writeProxyHeader(conn net.Conn, version byte, source netip.AddrPort) error {
+	return utils.WriteProxyHeader(conn, utils.ProxyOptions{Version: version, Source: source})
+}
@@ -0,0 +1,302 @@
+package slp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeStatusServer struct {
+	listener net.Listener
+	status   string
+	// skipPong closes the connection after the status response
+	skipPong bool
+	// ignorePing keeps the connection open after the status response without answering the ping
+	ignorePing bool
+	// stall accepts connections but never responds
+	stall bool
+	// handshakes receives the host, port, and protocol version from each handshake
+	handshakes chan fakeHandshake
+	// proxyHeaders receives the first line of a PROXY v1 header, if any
+	proxyHeaders chan string
+	// loginStarts receives the payload of each Login Start
+	loginStarts chan []byte
+	// loginReplyId and loginReply are sent in response to a Login Start
+	loginReplyId int32
+	loginReply   []byte
+}
+
+type fakeHandshake struct {
+	protocolVersion int32
+	host            string
+	port            uint16
+	nextState       int32
+}
+
+func startFakeStatusServer(t *testing.T, status string, configure ...func(s *fakeStatusServer)) *fakeStatusServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	s := &fakeStatusServer{
+		listener:     listener,
+		status:       status,
+		handshakes:   make(chan fakeHandshake, 10),
+		proxyHeaders: make(chan string, 10),
+		loginStarts:  make(chan []byte, 10),
+	}
+	for _, c := range configure {
+		c(s)
+	}
+	t.Cleanup(func() {
+		_ = listener.Close()
+	})
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.handle(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeStatusServer) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *fakeStatusServer) handle(conn net.Conn) {
+	//goland:noinspection GoUnhandledErrorResult
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	if s.stall {
+		_, _ = io.Copy(io.Discard, reader)
+		return
+	}
+
+	if peek, _ := reader.Peek(5); string(peek) == "PROXY" {
+		line, _ := reader.ReadString('\n')
+		s.proxyHeaders <- strings.TrimSpace(line)
+	}
+
+	_, _, err := readPacketHeader(reader, 0)
+	if err != nil {
+		return
+	}
+	var handshake fakeHandshake
+	handshake.protocolVersion, _ = readVarInt(reader)
+	handshake.host, _ = readVarString(reader, 255)
+	portBytes := make([]byte, 2)
+	_, _ = io.ReadFull(reader, portBytes)
+	handshake.port = uint16(portBytes[0])<<8 | uint16(portBytes[1])
+	handshake.nextState, _ = readVarInt(reader)
+	s.handshakes <- handshake
+
+	if handshake.nextState == nextStateLogin {
+		_, remaining, err := readPacketHeader(reader, 0)
+		if err != nil {
+			return
+		}
+		loginStart := make([]byte, remaining)
+		_, _ = io.ReadFull(reader, loginStart)
+		s.loginStarts <- loginStart
+		_ = writePacket(conn, s.loginReplyId, s.loginReply)
+		return
+	}
+
+	// status request
+	_, _, err = readPacketHeader(reader, 0)
+	if err != nil {
+		return
+	}
+	payload := new(bytes.Buffer)
+	writeVarString(payload, s.status)
+	_ = writePacket(conn, packetIdStatusResponse, payload.Bytes())
+
+	if s.skipPong {
+		return
+	}
+	if s.ignorePing {
+		_, _ = io.Copy(io.Discard, reader)
+		return
+	}
+
+	packetId, remaining, err := readPacketHeader(reader, 0)
+	if err != nil || packetId != packetIdPing {
+		return
+	}
+	ping := make([]byte, remaining)
+	_, _ = io.ReadFull(reader, ping)
+	_ = writePacket(conn, packetIdPong, ping)
+}
+
+const testStatus = `{"version":{"name":"1.20.4","protocol":765},"players":{"max":20,"online":1,"sample":[{"name":"alice","id":"4566e69f-c907-48ee-8d71-d7ba5aa00d20"}]},"description":{"text":"Hello","extra":[{"text":" world","color":"gold"}]},"favicon":"data:image/png;base64,AAAA","modinfo":{"type":"FML","modList":[]}}`
+
+func TestPing(t *testing.T) {
+	server := startFakeStatusServer(t, testStatus)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	response, err := Ping(ctx, "127.0.0.1", server.port(), nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, "1.20.4", response.Version.Name)
+	assert.Equal(t, 765, response.Version.Protocol)
+	assert.Equal(t, 20, response.Players.Max)
+	assert.Equal(t, 1, response.Players.Online)
+	assert.Equal(t, []StatusPlayer{{Name: "alice", Id: "4566e69f-c907-48ee-8d71-d7ba5aa00d20"}}, response.Players.Sample)
+	assert.Equal(t, "Hello", response.Description.Text)
+	assert.JSONEq(t, `{"text":"Hello","extra":[{"text":" world","color":"gold"}]}`, string(response.Description.Raw()))
+	assert.Equal(t, "data:image/png;base64,AAAA", response.Favicon)
+	assert.Equal(t, testStatus, string(response.Raw))
+	assert.Greater(t, response.Latency, time.Duration(0))
+	assert.Equal(t, time.Duration(0), response.Timings.DNS, "IP addresses are not resolved")
+	assert.Greater(t, response.Timings.Connect, time.Duration(0))
+	assert.Greater(t, response.Timings.Handshake, time.Duration(0))
+	assert.Equal(t, response.Latency, response.Timings.PingPong)
+
+	handshake := <-server.handshakes
+	assert.Equal(t, fakeHandshake{protocolVersion: -1, host: "127.0.0.1", port: uint16(server.port()), nextState: 1}, handshake)
+}
+
+func TestPingDescriptionString(t *testing.T) {
+	server := startFakeStatusServer(t, `{"version":{"name":"1.8.9","protocol":47},"players":{"max":10,"online":0},"description":"§aA plain MOTD"}`)
+
+	response, err := Ping(context.Background(), "127.0.0.1", server.port(), &PingOptions{ProtocolVersion: 47})
+	require.NoError(t, err)
+	assert.Equal(t, "§aA plain MOTD", response.Description.Text)
+
+	encoded, err := json.Marshal(response)
+	require.NoError(t, err)
+	assert.Contains(t, string(encoded), `"description":"§aA plain MOTD"`)
+
+	handshake := <-server.handshakes
+	assert.Equal(t, int32(47), handshake.protocolVersion)
+}
+
+func TestPingWithoutPong(t *testing.T) {
+	server := startFakeStatusServer(t, testStatus, func(s *fakeStatusServer) {
+		s.skipPong = true
+	})
+
+	response, err := Ping(context.Background(), "127.0.0.1", server.port(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, "1.20.4", response.Version.Name)
+	assert.Equal(t, time.Duration(0), response.Latency)
+	assert.Equal(t, time.Duration(0), response.Timings.PingPong)
+}
+
+func TestPingIgnoredPing(t *testing.T) {
+	server := startFakeStatusServer(t, testStatus, func(s *fakeStatusServer) {
+		s.ignorePing = true
+	})
+
+	start := time.Now()
+	response, err := Ping(context.Background(), "127.0.0.1", server.port(), &PingOptions{PingPongTimeout: 100 * time.Millisecond})
+	require.NoError(t, err)
+	assert.Less(t, time.Since(start), time.Second, "the wait for the pong is bounded without a context deadline")
+	assert.Equal(t, "1.20.4", response.Version.Name)
+	assert.Equal(t, time.Duration(0), response.Latency)
+	assert.Less(t, response.ResponseTime(time.Since(start)), 100*time.Millisecond, "the wait for the pong is not part of the response time")
+}
+
+func TestPingSkipPingPong(t *testing.T) {
+	server := startFakeStatusServer(t, testStatus, func(s *fakeStatusServer) {
+		s.ignorePing = true
+	})
+
+	start := time.Now()
+	response, err := Ping(context.Background(), "127.0.0.1", server.port(), &PingOptions{SkipPingPong: true})
+	require.NoError(t, err)
+	assert.Less(t, time.Since(start), DefaultPingPongTimeout)
+	assert.Equal(t, time.Duration(0), response.Latency)
+}
+
+func TestPingResolvesHost(t *testing.T) {
+	server := startFakeStatusServer(t, testStatus)
+
+	response, err := Ping(context.Background(), "localhost", server.port(), nil)
+	require.NoError(t, err)
+	assert.Greater(t, response.Timings.DNS, time.Duration(0))
+	assert.Greater(t, response.Timings.Connect, time.Duration(0))
+}
+
+func TestPingMaxResponseSize(t *testing.T) {
+	server := startFakeStatusServer(t, testStatus)
+
+	_, err := Ping(context.Background(), "127.0.0.1", server.port(), &PingOptions{MaxResponseSize: 64})
+	assert.ErrorContains(t, err, "exceeds maximum")
+}
+
+func TestPingContextDeadline(t *testing.T) {
+	server := startFakeStatusServer(t, testStatus, func(s *fakeStatusServer) {
+		s.stall = true
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := Ping(ctx, "127.0.0.1", server.port(), nil)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+func TestPingProxyHeader(t *testing.T) {
+	server := startFakeStatusServer(t, testStatus)
+
+	_, err := Ping(context.Background(), "127.0.0.1", server.port(), &PingOptions{ProxyVersion: 1})
+	require.NoError(t, err)
+
+	header := <-server.proxyHeaders
+	assert.Regexp(t, `^PROXY TCP4 127\.0\.0\.1 127\.0\.0\.1 [0-9]+ [0-9]+$`, header)
+}
+
+func TestPingProxySource(t *testing.T) {
+	server := startFakeStatusServer(t, testStatus)
+
+	_, err := Ping(context.Background(), "127.0.0.1", server.port(), &PingOptions{
+		ProxyVersion: 1,
+		ProxySource:  netip.MustParseAddrPort("203.0.113.7:40000"),
+	})
+	require.NoError(t, err)
+
+	header := <-server.proxyHeaders
+	assert.Equal(t, fmt.Sprintf("PROXY TCP4 203.0.113.7 127.0.0.1 40000 %d", server.port()), header)
+}
+
+func TestVarInt(t *testing.T) {
+	tests := []struct {
+		value   int32
+		encoded string
+	}{
+		{value: 0, encoded: "00"},
+		{value: 1, encoded: "01"},
+		{value: 127, encoded: "7f"},
+		{value: 128, encoded: "8001"},
+		{value: 25565, encoded: "ddc701"},
+		{value: 2147483647, encoded: "ffffffff07"},
+		{value: -1, encoded: "ffffffff0f"},
+	}
+	for _, tt := range tests {
+		buf := new(bytes.Buffer)
+		require.NoError(t, writeVarInt(buf, tt.value))
+		assert.Equal(t, tt.encoded, fmt.Sprintf("%x", buf.Bytes()))
+
+		decoded, err := readVarInt(buf)
+		require.NoError(t, err)
+		assert.Equal(t, tt.value, decoded)
+	}
+}
@@ -0,0 +1,64 @@
+package slp
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"time"
+)
+
+// Timings are the durations of each phase of Ping, where a phase that was skipped is zero
+type Timings struct {
+	// DNS is the time taken to resolve the host, which is zero when the host is an IP address
+	DNS time.Duration
+	// Connect is the time taken to establish the TCP connection, including any failed attempts
+	// to other addresses of the host
+	Connect time.Duration
+	// Handshake is the time from sending the handshake until the status response was read,
+	// which includes the time for the server to prepare the status and transfer its JSON
+	Handshake time.Duration
+	// PingPong is the round trip time of the ping/pong exchange, which is what the client shows
+	// as the latency in the server list
+	PingPong time.Duration
+}
+
+// Status returns the total of the phases until the status response was read
+func (t Timings) Status() time.Duration {
+	return t.DNS + t.Connect + t.Handshake
+}
+
+// dialTimed connects to the host like net.Dialer.DialContext, but resolves the host separately so that
+// the DNS and connect phases can be measured. The addresses of the host are tried in turn.
+func dialTimed(ctx context.Context, host string, port int, timings *Timings) (net.Conn, error) {
+	var addresses []string
+	if net.ParseIP(host) != nil {
+		addresses = []string{host}
+	} else {
+		start := time.Now()
+		resolved, err := net.DefaultResolver.LookupHost(ctx, host)
+		timings.DNS = time.Since(start)
+		if err != nil {
+			return nil, err
+		}
+		addresses = resolved
+	}
+
+	var dialer net.Dialer
+	var errs []error
+	start := time.Now()
+	defer func() {
+		timings.Connect = time.Since(start)
+	}()
+	for _, address := range addresses {
+		conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(address, strconv.Itoa(port)))
+		if err == nil {
+			return conn, nil
+		}
+		errs = append(errs, err)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return nil, errors.Join(errs...)
+}
@@ -1,11 +1,14 @@
 package main
 
 import (
+	"context"
 	"errors"
-	mcpinger "github.com/Raqbit/mc-pinger"
 	lpsender "github.com/itzg/line-protocol-sender"
+	"github.com/itzg/mc-monitor/slp"
+	"github.com/itzg/mc-monitor/utils"
 	"go.uber.org/zap"
 	"log"
+	"net"
 	"strconv"
 	"time"
 )
@@ -17,74 +20,165 @@ const (
 	TagPort    = "port"
 	TagStatus  = "status"
 	TagVersion = "version"
+	// TagResolvedAddress is only included when the address was resolved via SRV lookup
+	TagResolvedAddress = "resolved_address"
 
 	FieldError        = "error"
 	FieldOnline       = "online"
 	FieldMax          = "max"
 	FieldResponseTime = "response_time"
+	// FieldDnsTime includes the time of any SRV lookup
+	FieldDnsTime       = "dns_time"
+	FieldConnectTime   = "connect_time"
+	FieldHandshakeTime = "handshake_time"
+	// FieldPingPongTime is only included when the server responded to the ping
+	FieldPingPongTime = "ping_pong_time"
+	// FieldMods is only included for Forge and NeoForge servers
+	FieldMods = "mods"
 
 	StatusError   = "error"
 	StatusSuccess = "success"
 )
 
 type TelegrafGatherer struct {
-	host     string
-	port     string
-	pinger   mcpinger.Pinger
+	host      string
+	port      uint16
+	srvLookup bool
+	// skipPingPong skips the ping/pong exchange that follows the status response
+	skipPingPong bool
+	proxy        utils.ProxyOptions
+	// timeout bounds each ping when non-zero
+	timeout time.Duration
+	// slpVariant selects a legacy server list ping, when set to other than modern
+	slpVariant string
+	// labels are added as tags
+	labels   map[string]string
+	resolver utils.Resolver
 	logger   *zap.Logger
 	lpClient lpsender.Client
 }
 
-func NewTelegrafGatherer(host string, port uint16, lpClient lpsender.Client, logger *zap.Logger) *TelegrafGatherer {
+// NewTelegrafGatherer creates a gatherer for the given Java server, where the timeout and PROXY protocol
+// options given to the target take precedence over the given ones. When srvLookup is enabled, the server
+// is contacted at the target of its _minecraft._tcp SRV record, if any. A PROXY protocol header is sent
+// ahead of each ping when the version of the proxy options is non-zero. When skipPingPong is enabled, the
+// ping/pong exchange that follows the status is skipped.
+func NewTelegrafGatherer(target *utils.Target, srvLookup bool, skipPingPong bool, timeout time.Duration, proxy utils.ProxyOptions, lpClient lpsender.Client, logger *zap.Logger) *TelegrafGatherer {
 	return &TelegrafGatherer{
-		host:     host,
-		port:     strconv.FormatInt(int64(port), 10),
-		pinger:   mcpinger.New(host, uint16(port)),
-		lpClient: lpClient,
-		logger:   logger,
+		host:         target.Host,
+		port:         target.Port,
+		srvLookup:    srvLookup && !target.ExplicitPort,
+		skipPingPong: skipPingPong,
+		proxy:        target.ProxyOr(proxy),
+		timeout:      target.TimeoutOr(timeout),
+		slpVariant:   target.SlpVariant,
+		labels:       target.Labels,
+		lpClient:     lpClient,
+		logger:       logger,
 	}
 }
 
 func (g *TelegrafGatherer) Gather() {
-	g.logger.Debug("gathering", zap.String("host", g.host), zap.String("port", g.port))
+	g.logger.Debug("gathering", zap.String("host", g.host), zap.Uint16("port", g.port))
+
+	host, port := g.host, g.port
+	resolved := ""
+	resolveStart := time.Now()
+	if g.srvLookup {
+		var found bool
+		host, port, found = utils.ResolveJavaServer(context.Background(), g.resolver, g.host, g.port)
+		if found {
+			resolved = net.JoinHostPort(host, strconv.Itoa(int(port)))
+		}
+	}
+	srvLookup := time.Since(resolveStart)
+
 	startTime := time.Now()
-	info, err := g.pinger.Ping()
+	info, err := g.ping(host, port)
 	elapsed := time.Now().Sub(startTime)
+	if err == nil {
+		// the wait for the pong is not part of the response time
+		elapsed = info.ResponseTime(elapsed)
+	}
 
 	if err != nil {
-		g.sendFailedMetrics(err, elapsed)
+		g.sendFailedMetrics(err, resolved, elapsed)
 	} else if info.Players.Max == 0 {
-		g.sendFailedMetrics(errors.New("server not ready"), elapsed)
+		g.sendFailedMetrics(errors.New("server not ready"), resolved, elapsed)
 	} else {
-		err := g.sendInfoMetrics(info, elapsed)
+		err := g.sendInfoMetrics(info, resolved, elapsed, srvLookup)
 		if err != nil {
 			log.Printf("failed to send metrics: %s", err)
 		}
 	}
 }
 
-func (g *TelegrafGatherer) sendInfoMetrics(info *mcpinger.ServerInfo, elapsed time.Duration) error {
-	m := lpsender.NewSimpleMetric(MetricName)
+func (g *TelegrafGatherer) ping(host string, port uint16) (*slp.StatusResponse, error) {
+	if isLegacySlpVariant(g.slpVariant) {
+		response, _, err := slp.LegacyPing(host, int(port), g.timeout, g.slpVariant, &slp.LegacyPingOptions{
+			ProxyVersion: g.proxy.Version,
+			ProxySource:  g.proxy.Source,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return response.StatusResponse(), nil
+	}
+
+	ctx, cancel := withOptionalTimeout(context.Background(), g.timeout)
+	defer cancel()
+	return slp.Ping(ctx, host, int(port), &slp.PingOptions{
+		ProxyVersion: g.proxy.Version,
+		ProxySource:  g.proxy.Source,
+		SkipPingPong: g.skipPingPong,
+	})
+}
 
+func (g *TelegrafGatherer) addTargetTags(m *lpsender.SimpleMetric, resolved string) {
+	for name, value := range g.labels {
+		m.AddTag(name, value)
+	}
 	m.AddTag(TagHost, g.host)
-	m.AddTag(TagPort, g.port)
+	m.AddTag(TagPort, strconv.Itoa(int(g.port)))
+	if resolved != "" {
+		m.AddTag(TagResolvedAddress, resolved)
+	}
+}
+
+func (g *TelegrafGatherer) sendInfoMetrics(info *slp.StatusResponse, resolved string, elapsed time.Duration, srvLookup time.Duration) error {
+	m := lpsender.NewSimpleMetric(MetricName)
+
+	g.addTargetTags(m, resolved)
 	m.AddTag(TagStatus, StatusSuccess)
 	m.AddTag(TagVersion, info.Version.Name)
 
 	m.AddField(FieldResponseTime, elapsed.Seconds())
+	// the phases of legacy pings are not measured
+	if !isLegacySlpVariant(g.slpVariant) {
+		m.AddField(FieldDnsTime, (srvLookup + info.Timings.DNS).Seconds())
+		m.AddField(FieldConnectTime, info.Timings.Connect.Seconds())
+		m.AddField(FieldHandshakeTime, info.Timings.Handshake.Seconds())
+	}
+	if info.Timings.PingPong > 0 {
+		m.AddField(FieldPingPongTime, info.Timings.PingPong.Seconds())
+	}
 	m.AddField(FieldOnline, uint64(info.Players.Online))
 	m.AddField(FieldMax, uint64(info.Players.Max))
+	if forgeInfo, err := info.ForgeInfo(); err != nil {
+		g.logger.Warn("failed to parse mod metadata", zap.Error(err))
+	} else if forgeInfo != nil {
+		m.AddField(FieldMods, uint64(len(forgeInfo.Mods)))
+	}
 
 	g.lpClient.Send(m)
 
 	return nil
 }
 
-func (g *TelegrafGatherer) sendFailedMetrics(err error, elapsed time.Duration) {
+func (g *TelegrafGatherer) sendFailedMetrics(err error, resolved string, elapsed time.Duration) {
 	m := lpsender.NewSimpleMetric(MetricName)
 
-	m.AddTag(TagHost, g.host)
-	m.AddTag(TagPort, g.port)
+	g.addTargetTags(m, resolved)
 	m.AddTag(TagStatus, StatusError)
 
 	m.AddField(FieldError, err.Error())
@@ -7,16 +7,26 @@ import (
 	"github.com/google/subcommands"
 	"github.com/itzg/go-flagsfiller"
 	lpsender "github.com/itzg/line-protocol-sender"
+	"github.com/itzg/mc-monitor/config"
+	"github.com/itzg/mc-monitor/utils"
 	"go.uber.org/zap"
 	"log"
 	"os"
+	"slices"
 	"time"
 )
 
 type gatherTelegrafCmd struct {
+	Config          string        `usage:"path of a YAML or JSON configuration file declaring targets, defaults, and sink settings, where flags take precedence over the file"`
 	Interval        time.Duration `default:"1m" usage:"gathers and sends metrics at this interval"`
-	Servers         []string      `usage:"one or more [host:port] addresses of servers to monitor"`
+	Servers         []string      `usage:"one or more [host:port] addresses or java:// URIs of servers to monitor. See the README for the options of URIs"`
 	TelegrafAddress string        `default:"localhost:8094" usage:"[host:port] of telegraf accepting Influx line protocol"`
+	Timeout         time.Duration `usage:"timeout of each ping, where zero waits indefinitely"`
+	SkipSrvLookup   bool          `usage:"skips resolving the _minecraft._tcp SRV record of servers given without a port"`
+	SkipPingPong    bool          `usage:"skips the ping/pong exchange after the status, which leaves out the ping_pong_time field"`
+	UseProxy        bool          `usage:"supports contacting servers when proxy_protocol is enabled"`
+	ProxyVersion    uint          `usage:"version of PROXY protocol to use" default:"1"`
+	ProxySource     string        `usage:"[ip:port] reported as the client address in the PROXY protocol header instead of the local address"`
 	logger          *zap.Logger
 }
 
@@ -40,9 +50,28 @@ func (c *gatherTelegrafCmd) SetFlags(f *flag.FlagSet) {
 	}
 }
 
-func (c *gatherTelegrafCmd) Execute(ctx context.Context, _ *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
+func (c *gatherTelegrafCmd) Execute(ctx context.Context, flags *flag.FlagSet, args ...interface{}) subcommands.ExitStatus {
+	flagTargets, err := utils.ParseTargets(c.Servers, utils.JavaEdition)
+	if err != nil {
+		printUsageError(err.Error())
+		return subcommands.ExitUsageError
+	}
 
-	if len(c.Servers) == 0 {
+	// the configuration file may start without targets since they can be added while running
+	var cfg *config.File
+	var fileTargets []*utils.Target
+	if c.Config != "" {
+		cfg, err = config.Load(c.Config)
+		if err != nil {
+			printUsageError(err.Error())
+			return subcommands.ExitUsageError
+		}
+		if err := cfg.ApplyFlags(flags, config.SinkTelegraf); err != nil {
+			printUsageError(err.Error())
+			return subcommands.ExitUsageError
+		}
+		fileTargets = cfg.TargetSpecs()
+	} else if len(flagTargets) == 0 {
 		_, _ = fmt.Fprintln(os.Stderr, "requires at least one server")
 		return subcommands.ExitUsageError
 	}
@@ -55,51 +84,107 @@ func (c *gatherTelegrafCmd) Execute(ctx context.Context, _ *flag.FlagSet, args .
 	c.logger = args[0].(*zap.Logger).Named("gather")
 
 	c.logger.Info("starting monitoring",
-		zap.Strings("servers", c.Servers),
 		zap.Duration("interval", c.Interval),
 		zap.String("telegrafAddress", c.TelegrafAddress))
 
 	ticker := time.NewTicker(c.Interval)
 
-	gatherers, err := c.createGatherers()
+	lpClient, proxy, err := c.setupSender()
 	if err != nil {
 		c.logger.Error("failed to setup gatherers", zap.Error(err))
 		return subcommands.ExitFailure
 	}
 
+	var gatherers utils.TargetSet[*TelegrafGatherer]
+	updateGatherers := func(fileTargets []*utils.Target) error {
+		changes, err := gatherers.Update(slices.Concat(flagTargets, fileTargets),
+			func(added []*utils.Target) ([]*TelegrafGatherer, error) {
+				return c.createGatherers(added, proxy, lpClient)
+			})
+		if err != nil {
+			return err
+		}
+		changes.Log(c.logger)
+		return nil
+	}
+	if err := updateGatherers(fileTargets); err != nil {
+		c.logger.Error("failed to setup gatherers", zap.Error(err))
+		return subcommands.ExitFailure
+	}
+
+	// reloaded targets are applied by the gathering loop, which is the only user of the gatherers
+	reloadedTargets := make(chan []*utils.Target)
+	if cfg != nil {
+		go config.Watch(ctx, cfg, config.NotifyReload(), c.logger, func(cfg *config.File) {
+			select {
+			case reloadedTargets <- cfg.TargetSpecs():
+			case <-ctx.Done():
+			}
+		})
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
 			return subcommands.ExitSuccess
 
+		case fileTargets := <-reloadedTargets:
+			if err := updateGatherers(fileTargets); err != nil {
+				c.logger.Error("failed to apply the reloaded targets", zap.Error(err))
+			}
+
 		case <-ticker.C:
-			for _, gatherer := range gatherers {
+			current := gatherers.Values()
+			for _, gatherer := range current {
 				gatherer.Gather()
 			}
+			// the client only starts once a metric is sent, so flushing before then would block
+			if len(current) > 0 {
+				lpClient.Flush()
+			}
 		}
 	}
 }
 
-func (c *gatherTelegrafCmd) createGatherers() ([]*TelegrafGatherer, error) {
-	gatherers := make([]*TelegrafGatherer, 0, len(c.Servers))
+// setupSender creates the client that sends the metrics of each round of gathering as a batch
+// along with the PROXY protocol options of the command
+func (c *gatherTelegrafCmd) setupSender() (lpsender.Client, utils.ProxyOptions, error) {
+	var proxy utils.ProxyOptions
 
+	// the targets may be reloaded, so each round is flushed explicitly rather than by batch size
 	lpClient, err := lpsender.NewClient(context.Background(), lpsender.Config{
-		Endpoint:  c.TelegrafAddress,
-		BatchSize: len(c.Servers),
+		Endpoint:     c.TelegrafAddress,
+		BatchTimeout: c.Interval,
 		ErrorListener: func(err error) {
 			c.logger.Error("failed to send metrics", zap.Error(err))
 		},
 	})
 	if err != nil {
-		return nil, err
+		return nil, proxy, err
 	}
 
-	for _, addr := range c.Servers {
-		host, port, err := SplitHostPort(addr, DefaultJavaPort)
+	// the source also applies to servers that enable the PROXY protocol in their URI
+	proxy.Source, err = utils.ParseProxySource(c.ProxySource)
+	if err != nil {
+		return nil, proxy, err
+	}
+	if c.UseProxy {
+		err = utils.ValidateProxyVersion(c.ProxyVersion)
 		if err != nil {
-			return nil, err
+			return nil, proxy, err
+		}
+		proxy.Version = byte(c.ProxyVersion)
+	}
+	return lpClient, proxy, nil
+}
+
+func (c *gatherTelegrafCmd) createGatherers(targets []*utils.Target, proxy utils.ProxyOptions, lpClient lpsender.Client) ([]*TelegrafGatherer, error) {
+	gatherers := make([]*TelegrafGatherer, 0, len(targets))
+	for _, target := range targets {
+		if target.Edition != utils.JavaEdition {
+			return nil, fmt.Errorf("server '%s' is not a Java server, which is all that is supported", target)
 		}
-		gatherers = append(gatherers, NewTelegrafGatherer(host, port, lpClient, c.logger))
+		gatherers = append(gatherers, NewTelegrafGatherer(target, !c.SkipSrvLookup, c.SkipPingPong, c.Timeout, proxy, lpClient, c.logger))
 	}
 
 	return gatherers, nil
@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// LatencyConfig declares the buckets of the latency histogram of each edition, which differ since the ping of
+// Bedrock servers is a single RakNet round trip while the ping of Java servers includes connecting over TCP
+// and the handshake
+type LatencyConfig struct {
+	JavaBuckets    []string `usage:"upper bounds in seconds of the buckets of minecraft_status_java_latency_seconds" default:"0.005,0.01,0.025,0.05,0.1,0.25,0.5,1,2.5,5,10" override-value:"true"`
+	BedrockBuckets []string `usage:"upper bounds in seconds of the buckets of minecraft_status_bedrock_latency_seconds" default:"0.001,0.0025,0.005,0.01,0.025,0.05,0.1,0.25,0.5,1,2.5" override-value:"true"`
+}
+
+// LatencyBuckets are the upper bounds in seconds of the buckets of each edition
+type LatencyBuckets map[ServerEdition][]float64
+
+// ParseBuckets parses the buckets of each edition
+func (c *LatencyConfig) ParseBuckets() (LatencyBuckets, error) {
+	java, err := ParseBuckets(c.JavaBuckets)
+	if err != nil {
+		return nil, fmt.Errorf("java buckets: %w", err)
+	}
+	bedrock, err := ParseBuckets(c.BedrockBuckets)
+	if err != nil {
+		return nil, fmt.Errorf("bedrock buckets: %w", err)
+	}
+	return LatencyBuckets{JavaEdition: java, BedrockEdition: bedrock}, nil
+}
+
+// ParseBuckets parses the given upper bounds of histogram buckets, which need to be positive and increasing
+func ParseBuckets(values []string) ([]float64, error) {
+	buckets := make([]float64, 0, len(values))
+	for _, value := range values {
+		bucket, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || bucket <= 0 {
+			return nil, fmt.Errorf("invalid bucket '%s', must be a positive number of seconds", value)
+		}
+		if len(buckets) > 0 && bucket <= buckets[len(buckets)-1] {
+			return nil, fmt.Errorf("bucket %s must be greater than the previous one", value)
+		}
+		buckets = append(buckets, bucket)
+	}
+	return buckets, nil
+}
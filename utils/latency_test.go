@@ -0,0 +1,34 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseBuckets(t *testing.T) {
+	buckets, err := ParseBuckets([]string{"0.01", " 0.1", "1"})
+	require.NoError(t, err)
+	assert.Equal(t, []float64{0.01, 0.1, 1}, buckets)
+
+	_, err = ParseBuckets([]string{"0.1", "soon"})
+	assert.EqualError(t, err, "invalid bucket 'soon', must be a positive number of seconds")
+
+	_, err = ParseBuckets([]string{"0"})
+	assert.EqualError(t, err, "invalid bucket '0', must be a positive number of seconds")
+
+	_, err = ParseBuckets([]string{"0.5", "0.1"})
+	assert.EqualError(t, err, "bucket 0.1 must be greater than the previous one")
+}
+
+func TestLatencyConfigParseBuckets(t *testing.T) {
+	config := &LatencyConfig{JavaBuckets: []string{"0.05", "0.5"}, BedrockBuckets: []string{"0.01"}}
+	buckets, err := config.ParseBuckets()
+	require.NoError(t, err)
+	assert.Equal(t, LatencyBuckets{JavaEdition: {0.05, 0.5}, BedrockEdition: {0.01}}, buckets)
+
+	config.BedrockBuckets = []string{"fast"}
+	_, err = config.ParseBuckets()
+	assert.EqualError(t, err, "bedrock buckets: invalid bucket 'fast', must be a positive number of seconds")
+}
@@ -0,0 +1,111 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+
+	"github.com/pires/go-proxyproto"
+)
+
+// ProxyOptions configures the PROXY protocol header sent ahead of each probe. The zero value sends no header.
+type ProxyOptions struct {
+	// Version is 1 or 2, where zero disables the header
+	Version byte
+	// Source is reported as the address of the client in the header instead of the local address of the
+	// connection, when valid
+	Source netip.AddrPort
+}
+
+// Enabled indicates if a header is sent
+func (o ProxyOptions) Enabled() bool {
+	return o.Version != 0
+}
+
+// ParseProxySource parses the [ip:port] address given to be reported as the source in PROXY protocol headers.
+// An empty value leaves the source as the local address of each connection.
+func ParseProxySource(value string) (netip.AddrPort, error) {
+	if value == "" {
+		return netip.AddrPort{}, nil
+	}
+	source, err := netip.ParseAddrPort(value)
+	if err != nil {
+		return netip.AddrPort{}, fmt.Errorf("invalid PROXY source '%s', must be an [ip:port] address: %w", value, err)
+	}
+	return source, nil
+}
+
+// ValidateProxyVersion checks that the given PROXY protocol version is 1 or 2
+func ValidateProxyVersion(version uint) error {
+	if version != 1 && version != 2 {
+		return errors.New("proxy version must be 1 or 2")
+	}
+	return nil
+}
+
+// ProxyHeader creates the header describing the given connection, where the source is replaced when
+// options.Source is valid
+func ProxyHeader(options ProxyOptions, conn net.Conn) *proxyproto.Header {
+	source := conn.LocalAddr()
+	if options.Source.IsValid() {
+		switch conn.LocalAddr().(type) {
+		case *net.UDPAddr:
+			source = net.UDPAddrFromAddrPort(options.Source)
+		default:
+			source = net.TCPAddrFromAddrPort(options.Source)
+		}
+	}
+	return proxyproto.HeaderProxyFromAddrs(options.Version, source, conn.RemoteAddr())
+}
+
+// WriteProxyHeader writes the PROXY protocol header describing the given stream connection
+func WriteProxyHeader(conn net.Conn, options ProxyOptions) error {
+	_, err := ProxyHeader(options, conn).WriteTo(conn)
+	return err
+}
+
+// ProxyDialer is compatible with net.Dialer and prefixes each datagram written to UDP connections with a
+// PROXY protocol version 2 header, which is how proxies such as Geyser accept the header over UDP
+type ProxyDialer struct {
+	net.Dialer
+	// Source is reported as the address of the client when valid
+	Source netip.AddrPort
+}
+
+func (d *ProxyDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	conn, err := d.Dialer.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	header := new(bytes.Buffer)
+	// version 1 is text based and only describes TCP
+	_, err = ProxyHeader(ProxyOptions{Version: 2, Source: d.Source}, conn).WriteTo(header)
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("failed to create PROXY header: %w", err)
+	}
+	return &proxyPacketConn{Conn: conn, header: header.Bytes()}, nil
+}
+
+type proxyPacketConn struct {
+	net.Conn
+	header []byte
+}
+
+func (c *proxyPacketConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(append(append([]byte{}, c.header...), b...))
+	// report only the portion of the caller's data that was written
+	n -= len(c.header)
+	if n < 0 {
+		n = 0
+	}
+	if err == nil && n < len(b) {
+		err = io.ErrShortWrite
+	}
+	return n, err
+}
@@ -0,0 +1,82 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/pires/go-proxyproto"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseProxySource(t *testing.T) {
+	source, err := ParseProxySource("")
+	require.NoError(t, err)
+	assert.False(t, source.IsValid())
+
+	source, err = ParseProxySource("203.0.113.7:40000")
+	require.NoError(t, err)
+	assert.Equal(t, netip.MustParseAddrPort("203.0.113.7:40000"), source)
+
+	_, err = ParseProxySource("client.example.com:40000")
+	assert.Error(t, err)
+}
+
+func TestProxyHeaderSource(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	//goland:noinspection GoUnhandledErrorResult
+	defer listener.Close()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	//goland:noinspection GoUnhandledErrorResult
+	defer conn.Close()
+
+	header := ProxyHeader(ProxyOptions{Version: 1}, conn)
+	assert.Equal(t, conn.LocalAddr().String(), header.SourceAddr.String())
+
+	header = ProxyHeader(ProxyOptions{Version: 1, Source: netip.MustParseAddrPort("203.0.113.7:40000")}, conn)
+	assert.Equal(t, proxyproto.TCPv4, header.TransportProtocol)
+	assert.Equal(t, "203.0.113.7:40000", header.SourceAddr.String())
+	assert.Equal(t, listener.Addr().String(), header.DestinationAddr.String())
+}
+
+func TestProxyDialer(t *testing.T) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	//goland:noinspection GoUnhandledErrorResult
+	defer listener.Close()
+
+	dialer := &ProxyDialer{Source: netip.MustParseAddrPort("203.0.113.7:40000")}
+	conn, err := dialer.DialContext(context.Background(), "udp", listener.LocalAddr().String())
+	require.NoError(t, err)
+	//goland:noinspection GoUnhandledErrorResult
+	defer conn.Close()
+
+	n, err := conn.Write([]byte("ping"))
+	require.NoError(t, err)
+	assert.Equal(t, 4, n)
+
+	_ = listener.SetReadDeadline(time.Now().Add(5 * time.Second))
+	datagram := make([]byte, 1500)
+	n, _, err = listener.ReadFrom(datagram)
+	require.NoError(t, err)
+
+	reader := bufio.NewReader(bytes.NewReader(datagram[:n]))
+	header, err := proxyproto.Read(reader)
+	require.NoError(t, err)
+	assert.Equal(t, byte(2), header.Version)
+	assert.Equal(t, proxyproto.UDPv4, header.TransportProtocol)
+	assert.Equal(t, "203.0.113.7:40000", header.SourceAddr.String())
+	assert.Equal(t, listener.LocalAddr().String(), header.DestinationAddr.String())
+
+	payload := make([]byte, reader.Buffered())
+	_, _ = reader.Read(payload)
+	assert.Equal(t, "ping", string(payload))
+}
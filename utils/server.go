@@ -2,7 +2,6 @@ package utils
 
 import (
 	"fmt"
-	"strconv"
 	"strings"
 )
 
@@ -14,6 +13,7 @@ const (
 
 	DefaultJavaPort    uint16 = 25565
 	DefaultBedrockPort uint16 = 19132
+	DefaultRconPort    uint16 = 25575
 )
 
 func ValidEdition(v string) bool {
@@ -24,17 +24,10 @@ func ValidEdition(v string) bool {
 	return false
 }
 
+// @deprecated use ParseTarget or ParseHostPort instead
 func SplitHostPort(hostport string, defaultPort uint16) (string, uint16, error) {
-	parts := strings.SplitN(hostport, ":", 2)
-	if len(parts) == 2 {
-		parsed, err := strconv.ParseUint(parts[1], 10, 16)
-		if err != nil {
-			return "", 0, err
-		}
-		return parts[0], uint16(parsed), nil
-	} else {
-		return parts[0], defaultPort, nil
-	}
+	host, port, _, err := ParseHostPort(hostport, defaultPort)
+	return host, port, err
 }
 
 func NormalizeHostPort(hostport string, defaultPort uint16) string {
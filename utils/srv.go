@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	javaSrvService = "minecraft"
+	javaSrvProto   = "tcp"
+
+	// DefaultSrvLookupTimeout bounds the SRV lookup when the caller's context has no deadline
+	DefaultSrvLookupTimeout = 5 * time.Second
+)
+
+// Resolver is the subset of net.Resolver needed for SRV lookups, which allows for tests to
+// provide a fake DNS answer.
+type Resolver interface {
+	LookupSRV(ctx context.Context, service, proto, name string) (cname string, addrs []*net.SRV, err error)
+}
+
+// DefaultResolver is the Resolver used when none is given
+var DefaultResolver Resolver = net.DefaultResolver
+
+// ResolveJavaServer performs the same _minecraft._tcp SRV lookup that the Java Edition client
+// performs when a server address has no explicit port. If a record is found, the target host and port
+// are returned along with true; otherwise, the given host and port are returned unchanged along with false.
+// Lookup failures are not reported as errors since the client also falls back to the given address.
+func ResolveJavaServer(ctx context.Context, resolver Resolver, host string, port uint16) (string, uint16, bool) {
+	if resolver == nil {
+		resolver = DefaultResolver
+	}
+	if net.ParseIP(host) != nil {
+		return host, port, false
+	}
+
+	if _, hasDeadline := ctx.Deadline(); !hasDeadline {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, DefaultSrvLookupTimeout)
+		defer cancel()
+	}
+
+	_, addrs, err := resolver.LookupSRV(ctx, javaSrvService, javaSrvProto, host)
+	if err != nil || len(addrs) == 0 {
+		return host, port, false
+	}
+
+	// records are already sorted by priority and randomized by weight
+	target := strings.TrimSuffix(addrs[0].Target, ".")
+	if target == "" {
+		return host, port, false
+	}
+	return target, addrs[0].Port, true
+}
@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeResolver struct {
+	records map[string][]*net.SRV
+	lookups []string
+}
+
+func (f *fakeResolver) LookupSRV(_ context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	f.lookups = append(f.lookups, "_"+service+"._"+proto+"."+name)
+	if records, ok := f.records[name]; ok {
+		return "", records, nil
+	}
+	return "", nil, errors.New("no such host")
+}
+
+func TestResolveJavaServer(t *testing.T) {
+	resolver := &fakeResolver{records: map[string][]*net.SRV{
+		"play.example.com":  {{Target: "mc1.example.com.", Port: 25570}},
+		"empty.example.com": {{Target: ".", Port: 25565}},
+	}}
+
+	tests := []struct {
+		name          string
+		host          string
+		expectedHost  string
+		expectedPort  uint16
+		expectedFound bool
+	}{
+		{name: "with record", host: "play.example.com", expectedHost: "mc1.example.com", expectedPort: 25570, expectedFound: true},
+		{name: "without record", host: "other.example.com", expectedHost: "other.example.com", expectedPort: 25565},
+		{name: "service not available", host: "empty.example.com", expectedHost: "empty.example.com", expectedPort: 25565},
+		{name: "ip address", host: "127.0.0.1", expectedHost: "127.0.0.1", expectedPort: 25565},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			host, port, found := ResolveJavaServer(context.Background(), resolver, tt.host, DefaultJavaPort)
+			assert.Equal(t, tt.expectedHost, host)
+			assert.Equal(t, tt.expectedPort, port)
+			assert.Equal(t, tt.expectedFound, found)
+		})
+	}
+
+	assert.Contains(t, resolver.lookups, "_minecraft._tcp.play.example.com")
+	assert.NotContains(t, resolver.lookups, "_minecraft._tcp.127.0.0.1")
+}
@@ -0,0 +1,290 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const targetLabelPrefix = "label."
+
+// slpVariants are the variants of server list ping accepted by the slp option, where legacy is the
+// same as auto and tries each legacy variant in turn
+var slpVariants = []string{"modern", "legacy", "1.6", "1.4", "beta", "auto"}
+
+var labelNamePattern = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// Target is a server to monitor. It is given either as a [host:port] address or as a URI, such as
+//
+//	java://host:25565?proxy=2&timeout=5s&slp=legacy&label.env=prod
+//	bedrock://host?timeout=2s
+//
+// where the query overrides the options of the command for just that server.
+type Target struct {
+	Edition ServerEdition
+	Host    string
+	Port    uint16
+	// ExplicitPort indicates the port was given rather than defaulted, which skips the SRV lookup of Java servers
+	ExplicitPort bool
+	// Timeout overrides the timeout of the command when non-zero
+	Timeout time.Duration
+	// ProxyVersion overrides the PROXY protocol version of the command when non-nil, where zero disables the header
+	ProxyVersion *byte
+	// ProxySource overrides the address reported as the client in PROXY headers when valid
+	ProxySource netip.AddrPort
+	// SlpVariant overrides the variant of server list ping of Java servers when non-empty
+	SlpVariant string
+	// ProtocolVersion overrides the protocol version sent in the handshake to Java servers when non-zero
+	ProtocolVersion int32
+	// Labels are added to the metrics of the server
+	Labels map[string]string
+}
+
+// DefaultPort returns the default port of the given edition
+func DefaultPort(edition ServerEdition) uint16 {
+	if edition == BedrockEdition {
+		return DefaultBedrockPort
+	}
+	return DefaultJavaPort
+}
+
+// ParseTarget parses a server given as a [host:port] address or as a java:// or bedrock:// URI.
+// The edition of the URI scheme takes precedence over the given edition, which applies to addresses.
+func ParseTarget(value string, edition ServerEdition) (*Target, error) {
+	if !strings.Contains(value, "://") {
+		host, port, explicit, err := ParseHostPort(value, DefaultPort(edition))
+		if err != nil {
+			return nil, err
+		}
+		return &Target{Edition: edition, Host: host, Port: port, ExplicitPort: explicit}, nil
+	}
+
+	parsed, err := url.Parse(value)
+	if err != nil {
+		return nil, err
+	}
+	target := &Target{Edition: ServerEdition(parsed.Scheme)}
+	if !ValidEdition(parsed.Scheme) {
+		return nil, fmt.Errorf("unsupported scheme '%s', must be java or bedrock", parsed.Scheme)
+	}
+	if parsed.Hostname() == "" {
+		return nil, errors.New("missing host")
+	}
+	if parsed.User != nil || (parsed.Path != "" && parsed.Path != "/") || parsed.Fragment != "" {
+		return nil, errors.New("only a host, port, and query are allowed")
+	}
+
+	target.Host = parsed.Hostname()
+	target.Port = DefaultPort(target.Edition)
+	if parsed.Port() != "" {
+		port, err := strconv.ParseUint(parsed.Port(), 10, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid port '%s'", parsed.Port())
+		}
+		target.Port = uint16(port)
+		target.ExplicitPort = true
+	}
+
+	query, err := url.ParseQuery(parsed.RawQuery)
+	if err != nil {
+		return nil, err
+	}
+	// applied in a consistent order so that the reported error is the same for each run
+	for _, key := range slices.Sorted(maps.Keys(query)) {
+		values := query[key]
+		if err := target.SetOption(key, values[len(values)-1]); err != nil {
+			return nil, err
+		}
+	}
+	return target, nil
+}
+
+// SetOption sets one of the options accepted in the query of a target URI, such as timeout or label.env
+func (t *Target) SetOption(key string, value string) error {
+	switch {
+	case key == "timeout":
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout <= 0 {
+			return fmt.Errorf("invalid timeout '%s'", value)
+		}
+		t.Timeout = timeout
+
+	case key == "proxy":
+		if value == "none" || value == "0" {
+			t.ProxyVersion = new(byte)
+			return nil
+		}
+		version, err := strconv.ParseUint(value, 10, 8)
+		if err != nil {
+			return fmt.Errorf("invalid proxy '%s', must be 1, 2, or none", value)
+		}
+		if err := ValidateProxyVersion(uint(version)); err != nil {
+			return err
+		}
+		if t.Edition == BedrockEdition && version != 2 {
+			return errors.New("bedrock servers only support PROXY protocol version 2")
+		}
+		proxyVersion := byte(version)
+		t.ProxyVersion = &proxyVersion
+
+	case key == "proxy-source":
+		source, err := ParseProxySource(value)
+		if err != nil {
+			return err
+		}
+		t.ProxySource = source
+
+	case key == "slp":
+		if t.Edition != JavaEdition {
+			return errors.New("slp only applies to Java servers")
+		}
+		if !slices.Contains(slpVariants, value) {
+			return fmt.Errorf("invalid slp '%s', must be one of %s", value, strings.Join(slpVariants, ", "))
+		}
+		t.SlpVariant = value
+
+	case strings.HasPrefix(key, targetLabelPrefix):
+		name := strings.TrimPrefix(key, targetLabelPrefix)
+		if !labelNamePattern.MatchString(name) || strings.HasPrefix(name, "__") {
+			return fmt.Errorf("invalid label name '%s'", name)
+		}
+		if t.Labels == nil {
+			t.Labels = make(map[string]string)
+		}
+		t.Labels[name] = value
+
+	default:
+		return fmt.Errorf("unknown option '%s'", key)
+	}
+	return nil
+}
+
+// ParseTargets parses each of the given values with ParseTarget
+func ParseTargets(values []string, edition ServerEdition) ([]*Target, error) {
+	targets := make([]*Target, 0, len(values))
+	for _, value := range values {
+		target, err := ParseTarget(value, edition)
+		if err != nil {
+			return nil, fmt.Errorf("failed to process server entry '%s': %w", value, err)
+		}
+		targets = append(targets, target)
+	}
+	return targets, nil
+}
+
+// ParseServerLists parses the lists of Java and Bedrock server entries given to the commands, where
+// the scheme of a URI takes precedence over the list it was given in
+func ParseServerLists(javaServers, bedrockServers []string) ([]*Target, error) {
+	javaTargets, err := ParseTargets(javaServers, JavaEdition)
+	if err != nil {
+		return nil, err
+	}
+	bedrockTargets, err := ParseTargets(bedrockServers, BedrockEdition)
+	if err != nil {
+		return nil, err
+	}
+	return append(javaTargets, bedrockTargets...), nil
+}
+
+// String formats the target as an address, which is used to identify it in logs and errors
+func (t *Target) String() string {
+	return net.JoinHostPort(t.Host, strconv.Itoa(int(t.Port)))
+}
+
+// Key identifies the target along with its options, which is formatted like its URI with the options in order
+// of their names. The protocol version is included as protocol-version since it is only given by other means.
+func (t *Target) Key() string {
+	host := t.Host
+	if t.ExplicitPort {
+		host = t.String()
+	} else if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+
+	query := url.Values{}
+	if t.Timeout != 0 {
+		query.Set("timeout", t.Timeout.String())
+	}
+	if t.ProxyVersion != nil {
+		if *t.ProxyVersion == 0 {
+			query.Set("proxy", "none")
+		} else {
+			query.Set("proxy", strconv.Itoa(int(*t.ProxyVersion)))
+		}
+	}
+	if t.ProxySource.IsValid() {
+		query.Set("proxy-source", t.ProxySource.String())
+	}
+	if t.SlpVariant != "" {
+		query.Set("slp", t.SlpVariant)
+	}
+	if t.ProtocolVersion != 0 {
+		query.Set("protocol-version", strconv.Itoa(int(t.ProtocolVersion)))
+	}
+	for name, value := range t.Labels {
+		query.Set(targetLabelPrefix+name, value)
+	}
+
+	key := url.URL{Scheme: string(t.Edition), Host: host, RawQuery: query.Encode()}
+	return key.String()
+}
+
+// ProxyOr returns the PROXY protocol options of the command given as defaults with those of the target applied
+func (t *Target) ProxyOr(defaults ProxyOptions) ProxyOptions {
+	proxy := defaults
+	if t.ProxyVersion != nil {
+		proxy.Version = *t.ProxyVersion
+	}
+	if t.ProxySource.IsValid() {
+		proxy.Source = t.ProxySource
+	}
+	return proxy
+}
+
+// TimeoutOr returns the timeout of the target, if given, or else the given default
+func (t *Target) TimeoutOr(timeout time.Duration) time.Duration {
+	if t.Timeout != 0 {
+		return t.Timeout
+	}
+	return timeout
+}
+
+// ParseHostPort parses a [host:port] address, where IPv6 literals with a port are enclosed in brackets.
+// When the port is omitted, the given default is returned and explicit is false.
+func ParseHostPort(hostport string, defaultPort uint16) (host string, port uint16, explicit bool, err error) {
+	if hostport == "" {
+		return "", 0, false, errors.New("missing host")
+	}
+	// an IPv6 literal without brackets has no port
+	if strings.Count(hostport, ":") > 1 && !strings.HasPrefix(hostport, "[") {
+		if net.ParseIP(hostport) == nil {
+			return "", 0, false, fmt.Errorf("invalid address '%s'", hostport)
+		}
+		return hostport, defaultPort, false, nil
+	}
+	if !strings.Contains(strings.TrimPrefix(hostport, "["), ":") ||
+		(strings.HasPrefix(hostport, "[") && strings.HasSuffix(hostport, "]")) {
+		return strings.TrimSuffix(strings.TrimPrefix(hostport, "["), "]"), defaultPort, false, nil
+	}
+
+	host, portStr, err := net.SplitHostPort(hostport)
+	if err != nil {
+		return "", 0, false, err
+	}
+	parsed, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return "", 0, false, fmt.Errorf("invalid port '%s'", portStr)
+	}
+	if host == "" {
+		return "", 0, false, errors.New("missing host")
+	}
+	return host, uint16(parsed), true, nil
+}
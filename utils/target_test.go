@@ -0,0 +1,180 @@
+package utils
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseHostPort(t *testing.T) {
+	tests := []struct {
+		value    string
+		host     string
+		port     uint16
+		explicit bool
+	}{
+		{value: "mc.example.com", host: "mc.example.com", port: 25565},
+		{value: "mc.example.com:25570", host: "mc.example.com", port: 25570, explicit: true},
+		{value: "10.0.0.5:25566", host: "10.0.0.5", port: 25566, explicit: true},
+		{value: "[2001:db8::1]:25570", host: "2001:db8::1", port: 25570, explicit: true},
+		{value: "[2001:db8::1]", host: "2001:db8::1", port: 25565},
+		{value: "2001:db8::1", host: "2001:db8::1", port: 25565},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			host, port, explicit, err := ParseHostPort(tt.value, DefaultJavaPort)
+			require.NoError(t, err)
+			assert.Equal(t, tt.host, host)
+			assert.Equal(t, tt.port, port)
+			assert.Equal(t, tt.explicit, explicit)
+		})
+	}
+}
+
+func TestParseHostPortInvalid(t *testing.T) {
+	for _, value := range []string{"", ":25565", "mc.example.com:port", "mc.example.com:70000", "2001:db8::zz"} {
+		_, _, _, err := ParseHostPort(value, DefaultJavaPort)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestParseTarget(t *testing.T) {
+	two := byte(2)
+	none := byte(0)
+	tests := []struct {
+		name     string
+		value    string
+		edition  ServerEdition
+		expected Target
+	}{
+		{
+			name:     "address",
+			value:    "mc.example.com:25570",
+			edition:  JavaEdition,
+			expected: Target{Edition: JavaEdition, Host: "mc.example.com", Port: 25570, ExplicitPort: true},
+		},
+		{
+			name:     "bedrock address",
+			value:    "mc.example.com",
+			edition:  BedrockEdition,
+			expected: Target{Edition: BedrockEdition, Host: "mc.example.com", Port: 19132},
+		},
+		{
+			name:    "java uri",
+			value:   "java://mc.example.com:25565?proxy=2&timeout=5s&slp=legacy&label.env=prod",
+			edition: JavaEdition,
+			expected: Target{
+				Edition:      JavaEdition,
+				Host:         "mc.example.com",
+				Port:         25565,
+				ExplicitPort: true,
+				Timeout:      5 * time.Second,
+				ProxyVersion: &two,
+				SlpVariant:   "legacy",
+				Labels:       map[string]string{"env": "prod"},
+			},
+		},
+		{
+			name:     "bedrock uri",
+			value:    "bedrock://mc.example.com?timeout=2s",
+			edition:  BedrockEdition,
+			expected: Target{Edition: BedrockEdition, Host: "mc.example.com", Port: 19132, Timeout: 2 * time.Second},
+		},
+		{
+			name:     "scheme takes precedence",
+			value:    "bedrock://mc.example.com",
+			edition:  JavaEdition,
+			expected: Target{Edition: BedrockEdition, Host: "mc.example.com", Port: 19132},
+		},
+		{
+			name:    "ipv6 uri",
+			value:   "java://[2001:db8::1]:25570?proxy=none&proxy-source=203.0.113.7:40000",
+			edition: JavaEdition,
+			expected: Target{
+				Edition:      JavaEdition,
+				Host:         "2001:db8::1",
+				Port:         25570,
+				ExplicitPort: true,
+				ProxyVersion: &none,
+				ProxySource:  netip.MustParseAddrPort("203.0.113.7:40000"),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target, err := ParseTarget(tt.value, tt.edition)
+			require.NoError(t, err)
+			assert.Equal(t, &tt.expected, target)
+		})
+	}
+}
+
+func TestParseTargetInvalid(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected string
+	}{
+		{value: "http://mc.example.com", expected: "unsupported scheme"},
+		{value: "java://", expected: "missing host"},
+		{value: "java://mc.example.com/path", expected: "only a host, port, and query"},
+		{value: "java://mc.example.com:99999", expected: "invalid port"},
+		{value: "java://mc.example.com?timeout=soon", expected: "invalid timeout"},
+		{value: "java://mc.example.com?proxy=3", expected: "proxy version must be 1 or 2"},
+		{value: "bedrock://mc.example.com?proxy=1", expected: "only support PROXY protocol version 2"},
+		{value: "bedrock://mc.example.com?slp=legacy", expected: "slp only applies to Java servers"},
+		{value: "java://mc.example.com?slp=1.2", expected: "invalid slp"},
+		{value: "java://mc.example.com?label.1env=prod", expected: "invalid label name"},
+		{value: "java://mc.example.com?retries=3", expected: "unknown option 'retries'"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			_, err := ParseTarget(tt.value, JavaEdition)
+			assert.ErrorContains(t, err, tt.expected)
+		})
+	}
+}
+
+func TestTargetOverrides(t *testing.T) {
+	defaults := ProxyOptions{Version: 1, Source: netip.MustParseAddrPort("10.0.0.5:40000")}
+
+	target, err := ParseTarget("java://mc.example.com?proxy=2", JavaEdition)
+	require.NoError(t, err)
+	assert.Equal(t, ProxyOptions{Version: 2, Source: defaults.Source}, target.ProxyOr(defaults))
+	assert.Equal(t, time.Minute, target.TimeoutOr(time.Minute))
+
+	target, err = ParseTarget("java://mc.example.com?proxy=none&timeout=5s", JavaEdition)
+	require.NoError(t, err)
+	assert.False(t, target.ProxyOr(defaults).Enabled())
+	assert.Equal(t, 5*time.Second, target.TimeoutOr(time.Minute))
+
+	target, err = ParseTarget("mc.example.com", JavaEdition)
+	require.NoError(t, err)
+	assert.Equal(t, defaults, target.ProxyOr(defaults))
+}
+
+func TestTargetKey(t *testing.T) {
+	tests := []struct {
+		value string
+		key   string
+	}{
+		{value: "mc.example.com", key: "java://mc.example.com"},
+		{value: "mc.example.com:25565", key: "java://mc.example.com:25565"},
+		{value: "[2001:db8::1]", key: "java://[2001:db8::1]"},
+		{value: "java://mc.example.com?timeout=5s&label.env=prod&proxy=none", key: "java://mc.example.com?label.env=prod&proxy=none&timeout=5s"},
+		{value: "bedrock://bedrock.example.com:19133?proxy=2", key: "bedrock://bedrock.example.com:19133?proxy=2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			target, err := ParseTarget(tt.value, JavaEdition)
+			require.NoError(t, err)
+			assert.Equal(t, tt.key, target.Key())
+		})
+	}
+}
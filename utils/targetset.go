@@ -0,0 +1,92 @@
+package utils
+
+import (
+	"go.uber.org/zap"
+)
+
+// TargetSet holds a value, such as a collector, for each monitored target. Targets are identified by
+// their Key, so a target whose options changed is replaced rather than kept.
+type TargetSet[T any] struct {
+	keys   []string
+	values map[string]T
+}
+
+// TargetChanges are the changes made by TargetSet.Update, where the values of the removed targets
+// are given so that they can be torn down
+type TargetChanges[T any] struct {
+	Added         []string
+	Removed       []string
+	RemovedValues []T
+}
+
+// Update replaces the targets with the given ones, where later duplicates of a target are ignored. The values of
+// targets still listed are kept and create is called with the added targets to create their values in the same
+// order. When create fails, the set is left unchanged.
+func (s *TargetSet[T]) Update(targets []*Target, create func([]*Target) ([]T, error)) (TargetChanges[T], error) {
+	var changes TargetChanges[T]
+
+	keys := make([]string, 0, len(targets))
+	listed := make(map[string]bool, len(targets))
+	var added []*Target
+	for _, target := range targets {
+		key := target.Key()
+		if listed[key] {
+			continue
+		}
+		listed[key] = true
+		keys = append(keys, key)
+		if _, exists := s.values[key]; !exists {
+			added = append(added, target)
+			changes.Added = append(changes.Added, key)
+		}
+	}
+
+	var created []T
+	if len(added) > 0 {
+		var err error
+		created, err = create(added)
+		if err != nil {
+			return TargetChanges[T]{}, err
+		}
+	}
+
+	values := make(map[string]T, len(keys))
+	for _, key := range s.keys {
+		if listed[key] {
+			values[key] = s.values[key]
+		} else {
+			changes.Removed = append(changes.Removed, key)
+			changes.RemovedValues = append(changes.RemovedValues, s.values[key])
+		}
+	}
+	for i, key := range changes.Added {
+		values[key] = created[i]
+	}
+
+	s.keys = keys
+	s.values = values
+	return changes, nil
+}
+
+// Values returns the value of each target in the order they were given to Update
+func (s *TargetSet[T]) Values() []T {
+	values := make([]T, 0, len(s.keys))
+	for _, key := range s.keys {
+		values = append(values, s.values[key])
+	}
+	return values
+}
+
+// Log logs each of the added and removed targets, or that the targets are unchanged
+func (c TargetChanges[T]) Log(logger *zap.Logger) {
+	if len(c.Added) == 0 && len(c.Removed) == 0 {
+		logger.Info("targets are unchanged")
+		return
+	}
+	for _, key := range c.Added {
+		logger.Info("added target", zap.String("target", key))
+	}
+	for _, key := range c.Removed {
+		logger.Info("removed target", zap.String("target", key))
+	}
+}
@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTargetSetUpdate(t *testing.T) {
+	var created int
+	create := func(targets []*Target) ([]int, error) {
+		values := make([]int, 0, len(targets))
+		for range targets {
+			created++
+			values = append(values, created)
+		}
+		return values, nil
+	}
+
+	var set TargetSet[int]
+	changes, err := set.Update(mustParseTargets(t, "a.example.com", "b.example.com", "a.example.com"), create)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"java://a.example.com", "java://b.example.com"}, changes.Added)
+	assert.Empty(t, changes.Removed)
+	assert.Equal(t, []int{1, 2}, set.Values())
+
+	// b is kept, a is removed, and c along with b with other options are added
+	changes, err = set.Update(mustParseTargets(t, "b.example.com", "java://b.example.com?timeout=5s", "c.example.com"), create)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"java://b.example.com?timeout=5s", "java://c.example.com"}, changes.Added)
+	assert.Equal(t, []string{"java://a.example.com"}, changes.Removed)
+	assert.Equal(t, []int{1}, changes.RemovedValues)
+	assert.Equal(t, []int{2, 3, 4}, set.Values())
+
+	_, err = set.Update(mustParseTargets(t, "d.example.com"), func([]*Target) ([]int, error) {
+		return nil, errors.New("failed")
+	})
+	require.Error(t, err)
+	assert.Equal(t, []int{2, 3, 4}, set.Values())
+}
+
+func mustParseTargets(t *testing.T, values ...string) []*Target {
+	targets, err := ParseTargets(values, JavaEdition)
+	require.NoError(t, err)
+	return targets
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/google/subcommands"
+	"github.com/itzg/mc-monitor/config"
+	"github.com/itzg/mc-monitor/utils"
+)
+
+type validateConfigCmd struct{}
+
+func (c *validateConfigCmd) Name() string {
+	return "validate-config"
+}
+
+func (c *validateConfigCmd) Synopsis() string {
+	return "Validates configuration files and reports every problem with its line number"
+}
+
+func (c *validateConfigCmd) Usage() string {
+	return `validate-config <file>...
+`
+}
+
+func (c *validateConfigCmd) SetFlags(*flag.FlagSet) {
+}
+
+func (c *validateConfigCmd) Execute(_ context.Context, flags *flag.FlagSet, _ ...interface{}) subcommands.ExitStatus {
+	if flags.NArg() == 0 {
+		utils.PrintUsageError("requires at least one configuration file")
+		return subcommands.ExitUsageError
+	}
+
+	status := subcommands.ExitSuccess
+	for _, path := range flags.Args() {
+		file, err := config.Load(path)
+		if err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			status = subcommands.ExitFailure
+			continue
+		}
+		fmt.Printf("%s: valid with %d targets\n", path, len(file.TargetSpecs()))
+	}
+	return status
+}